@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -92,6 +93,22 @@ type Config struct {
 	// vendors) in case they need to reach out. If this field is empty, push
 	// notifications are not enabled.
 	WebPushSubscriberEmail string `yaml:"webPushSubscriberEmail"`
+
+	// The public URL of the site (like https://discuit.org), used in the links
+	// of emails and syndication feeds. It's required if SMTPAddr is set. If
+	// it's empty, syndication feeds are not served.
+	SiteURL string `yaml:"siteURL"`
+
+	// SMTP server used for sending emails. If SMTPAddr is empty, emails are
+	// not sent. In development, they are written to files in MailDir (or, if
+	// MailDir is empty, to the log) instead; otherwise, the features that
+	// depend on emails (email confirmation, password reset, and notification
+	// digests) are disabled.
+	SMTPAddr     string `yaml:"smtpAddr"` // Of the form host:port.
+	SMTPUsername string `yaml:"smtpUsername"`
+	SMTPPassword string `yaml:"smtpPassword"`
+	MailFrom     string `yaml:"mailFrom"` // The From address of all emails.
+	MailDir      string `yaml:"mailDir"`
 }
 
 // Parse parses the yaml file at path and returns a Config.
@@ -174,6 +191,13 @@ func Parse(path string) (*Config, error) {
 		"DISCUIT_SUBSTACK_URL":    &c.SubstackURL,
 
 		"DISCUIT_USE_HTTP_COOKIES": &c.UseHTTPCookies,
+
+		"DISCUIT_SITE_URL":      &c.SiteURL,
+		"DISCUIT_SMTP_ADDR":     &c.SMTPAddr,
+		"DISCUIT_SMTP_USERNAME": &c.SMTPUsername,
+		"DISCUIT_SMTP_PASSWORD": &c.SMTPPassword,
+		"DISCUIT_MAIL_FROM":     &c.MailFrom,
+		"DISCUIT_MAIL_DIR":      &c.MailDir,
 	}
 
 	// Attempt to unmarshal the YAML file if it exists
@@ -221,6 +245,16 @@ func Parse(path string) (*Config, error) {
 	if c.MaxForumsPerUser == -1 {
 		return nil, errors.New("MaxForumsPerUser cannot be (-1)")
 	}
+	if c.SiteURL != "" {
+		if u, err := url.Parse(c.SiteURL); err != nil || !(u.Scheme == "http" || u.Scheme == "https") || u.Host == "" {
+			return nil, errors.New("SiteURL must be an absolute http or https URL")
+		}
+	}
+	if c.SMTPAddr != "" && c.SiteURL == "" {
+		// The links in emails are never derived from requests (their Host
+		// header cannot be trusted).
+		return nil, errors.New("SiteURL cannot be empty if SMTPAddr is set")
+	}
 
 	return c, nil
 }
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	// APITokenPrefix is the prefix of all API tokens. It makes leaked tokens
+	// easy to identify.
+	APITokenPrefix = "dct_"
+
+	maxAPITokenNameLength = 128
+	maxAPITokensPerUser   = 25
+)
+
+// APITokenScope is a permission granted to an API token.
+type APITokenScope string
+
+const (
+	APITokenScopeRead     = APITokenScope("read")
+	APITokenScopePost     = APITokenScope("post")
+	APITokenScopeVote     = APITokenScope("vote")
+	APITokenScopeModerate = APITokenScope("moderate")
+	APITokenScopeAdmin    = APITokenScope("admin")
+)
+
+// Valid reports whether s is a valid APITokenScope.
+func (s APITokenScope) Valid() bool {
+	switch s {
+	case APITokenScopeRead, APITokenScopePost, APITokenScopeVote, APITokenScopeModerate, APITokenScopeAdmin:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrInvalidAPIToken    = &httperr.Error{HTTPStatus: http.StatusUnauthorized, Code: "invalid-api-token", Message: "Invalid API token."}
+	errAPITokenNotFound   = httperr.NewNotFound("api-token-not-found", "API token not found.")
+	errInvalidTokenScope  = httperr.NewBadRequest("invalid-api-token-scope", "Invalid API token scope.")
+	errTooManyAPITokens   = httperr.NewForbidden("too-many-api-tokens", "Maximum number of API tokens reached.")
+	errAPITokenNameLength = httperr.NewBadRequest("api-token-name-length", "API token name must be between 1 and 128 characters.")
+)
+
+// APIToken is a personal access token of a user, which can be used, in place
+// of a session, to access the API with the permissions in Scopes.
+type APIToken struct {
+	ID         int             `json:"id"`
+	UserID     uid.ID          `json:"userId"`
+	Name       string          `json:"name"`
+	Scopes     []APITokenScope `json:"scopes"`
+	LastUsedAt msql.NullTime   `json:"lastUsedAt"`
+	LastUsedIP msql.NullIP     `json:"lastUsedIp"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// HasScope reports whether t was granted scope.
+func (t *APIToken) HasScope(scope APITokenScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func hashAPIToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+func parseAPITokenScopes(s string) []APITokenScope {
+	scopes := []APITokenScope{}
+	for _, scope := range strings.Split(s, ",") {
+		if scope != "" {
+			scopes = append(scopes, APITokenScope(scope))
+		}
+	}
+	return scopes
+}
+
+var selectAPITokenCols = []string{
+	"api_tokens.id",
+	"api_tokens.user_id",
+	"api_tokens.name",
+	"api_tokens.scopes",
+	"api_tokens.last_used_at",
+	"api_tokens.last_used_ip",
+	"api_tokens.created_at",
+}
+
+func scanAPITokens(rows *sql.Rows) ([]*APIToken, error) {
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t := &APIToken{}
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.LastUsedAt, &t.LastUsedIP, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = parseAPITokenScopes(scopes)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CreateAPIToken creates a new API token for user. The token itself is
+// returned only once, here, and only its hash is stored.
+func CreateAPIToken(ctx context.Context, db *sql.DB, user uid.ID, name string, scopes []APITokenScope) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPITokenNameLength {
+		return nil, "", errAPITokenNameLength
+	}
+	if len(scopes) == 0 {
+		return nil, "", errInvalidTokenScope
+	}
+
+	var cleaned []APITokenScope
+	for _, scope := range scopes {
+		if !scope.Valid() {
+			return nil, "", errInvalidTokenScope
+		}
+		if scope == APITokenScopeAdmin {
+			if is, err := IsAdmin(db, &user); err != nil {
+				return nil, "", err
+			} else if !is {
+				return nil, "", errNotAdmin
+			}
+		}
+		if !slices.Contains(cleaned, scope) {
+			cleaned = append(cleaned, scope)
+		}
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_tokens WHERE user_id = ?", user).Scan(&count); err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPITokensPerUser {
+		return nil, "", errTooManyAPITokens
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	strScopes := make([]string, len(cleaned))
+	for i, scope := range cleaned {
+		strScopes[i] = string(scope)
+	}
+
+	res, err := db.ExecContext(ctx, "INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES (?, ?, ?, ?)", user, name, hashAPIToken(token), strings.Join(strScopes, ","))
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	t, err := GetAPIToken(ctx, db, user, int(id))
+	if err != nil {
+		return nil, "", err
+	}
+	return t, token, nil
+}
+
+// GetAPIToken returns the API token of user with the given id.
+func GetAPIToken(ctx context.Context, db *sql.DB, user uid.ID, id int) (*APIToken, error) {
+	query := msql.BuildSelectQuery("api_tokens", selectAPITokenCols, nil, "WHERE api_tokens.id = ? AND api_tokens.user_id = ?")
+	rows, err := db.QueryContext(ctx, query, id, user)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanAPITokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errAPITokenNotFound
+	}
+	return tokens[0], nil
+}
+
+// GetAPITokens returns all the API tokens of user, latest first.
+func GetAPITokens(ctx context.Context, db *sql.DB, user uid.ID) ([]*APIToken, error) {
+	query := msql.BuildSelectQuery("api_tokens", selectAPITokenCols, nil, "WHERE api_tokens.user_id = ? ORDER BY api_tokens.id DESC")
+	rows, err := db.QueryContext(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPITokens(rows)
+}
+
+// DeleteAPIToken revokes the API token of user with the given id.
+func DeleteAPIToken(ctx context.Context, db *sql.DB, user uid.ID, id int) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, user)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errAPITokenNotFound
+	}
+	return nil
+}
+
+// DeleteAllAPITokensOfUser revokes all the API tokens of user.
+func DeleteAllAPITokensOfUser(ctx context.Context, db *sql.DB, user uid.ID) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM api_tokens WHERE user_id = ?", user)
+	return err
+}
+
+// AuthenticateAPIToken returns the APIToken of token, if token is valid, and
+// records its use from the IP address ip. The owner of the token must not be
+// banned or deleted.
+func AuthenticateAPIToken(ctx context.Context, db *sql.DB, token, ip string) (*APIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	query := msql.BuildSelectQuery("api_tokens", selectAPITokenCols, []string{
+		"INNER JOIN users ON users.id = api_tokens.user_id",
+	}, "WHERE api_tokens.token_hash = ? AND users.deleted_at IS NULL AND users.banned_at IS NULL")
+	rows, err := db.QueryContext(ctx, query, hashAPIToken(token))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanAPITokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrInvalidAPIToken
+	}
+
+	t := tokens[0]
+	now := time.Now()
+	if _, err := db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?", now, ip, t.ID); err != nil {
+		return nil, err
+	}
+	t.LastUsedAt = msql.NewNullTime(now)
+	t.LastUsedIP = msql.NullIP{IP: net.ParseIP(ip), Valid: ip != ""}
+	return t, nil
+}
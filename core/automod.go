@@ -0,0 +1,647 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	maxAutomodRules       = 50
+	maxAutomodRulesLength = 65535 // in bytes.
+
+	// automodReportReasonTitle is the title of the report reason (in the
+	// report_reasons table) of the reports filed by AutoModerator.
+	automodReportReasonTitle = "Breaks community rules"
+
+	// automodRulesCacheTTL is how long the compiled rules of a community are
+	// cached for. The cache of a community is invalidated whenever its rules
+	// are saved, so this only matters if there are several instances of the
+	// server.
+	automodRulesCacheTTL = time.Minute * 10
+)
+
+// AutomodAction is what AutoModerator does with a post or a comment that
+// matches a rule.
+type AutomodAction string
+
+const (
+	AutomodActionRemove = AutomodAction("remove")
+	AutomodActionLock   = AutomodAction("lock")
+	AutomodActionHold   = AutomodAction("hold") // Hold for approval by the mods.
+	AutomodActionReport = AutomodAction("report")
+	AutomodActionReply  = AutomodAction("reply") // Reply as the mods of the community.
+)
+
+// Valid reports whether a is a valid AutomodAction.
+func (a AutomodAction) Valid() bool {
+	switch a {
+	case AutomodActionRemove, AutomodActionLock, AutomodActionHold, AutomodActionReport, AutomodActionReply:
+		return true
+	}
+	return false
+}
+
+// AutomodRule is a rule of a community's AutoModerator. A rule matches a post
+// or a comment if all of its (non-empty) conditions are met.
+type AutomodRule struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Either "post" or "comment". If empty, the rule applies to both.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Regular expressions matched against the title, the body, and the link
+	// domain of the post (or the body of the comment).
+	Title  string `json:"title,omitempty" yaml:"title,omitempty"`
+	Body   string `json:"body,omitempty" yaml:"body,omitempty"`
+	Domain string `json:"domain,omitempty" yaml:"domain,omitempty"`
+
+	// Conditions on the author, and the number of reports.
+	AccountAgeDaysBelow int  `json:"accountAgeDaysBelow,omitempty" yaml:"accountAgeDaysBelow,omitempty"`
+	PointsBelow         *int `json:"pointsBelow,omitempty" yaml:"pointsBelow,omitempty"`
+	ReportsAtLeast      int  `json:"reportsAtLeast,omitempty" yaml:"reportsAtLeast,omitempty"`
+
+	Actions []AutomodAction `json:"actions" yaml:"actions"`
+	Reply   string          `json:"reply,omitempty" yaml:"reply,omitempty"` // For the reply action.
+
+	title, body, domain *regexp.Regexp
+}
+
+// hasAction reports whether a is one of the actions of r.
+func (r *AutomodRule) hasAction(a AutomodAction) bool {
+	for _, action := range r.Actions {
+		if action == a {
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns a digest of the definition of r, which identifies the rule in
+// the record of the rules that fired on a post or a comment.
+func (r *AutomodRule) hash() []byte {
+	b, _ := json.Marshal(r)
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// compile validates r and compiles its regular expressions. The n is the
+// position of the rule (used in error messages).
+func (r *AutomodRule) compile(n int) error {
+	invalid := func(format string, a ...any) error {
+		return httperr.NewBadRequest("invalid-automod-rule", fmt.Sprintf("Rule %d: ", n)+fmt.Sprintf(format, a...))
+	}
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("Rule %d", n)
+	}
+	if !(r.Type == "" || r.Type == "post" || r.Type == "comment") {
+		return invalid("invalid type %q.", r.Type)
+	}
+
+	var err error
+	compile := func(field, expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(expr); err != nil {
+			err = invalid("invalid %s regular expression: %v.", field, err)
+		}
+		return re
+	}
+	r.title, r.body, r.domain = compile("title", r.Title), compile("body", r.Body), compile("domain", r.Domain)
+	if err != nil {
+		return err
+	}
+
+	if r.title == nil && r.body == nil && r.domain == nil && r.AccountAgeDaysBelow <= 0 && r.PointsBelow == nil && r.ReportsAtLeast <= 0 {
+		return invalid("no conditions.")
+	}
+	if len(r.Actions) == 0 {
+		return invalid("no actions.")
+	}
+	for _, action := range r.Actions {
+		if !action.Valid() {
+			return invalid("invalid action %q.", action)
+		}
+	}
+	if r.hasAction(AutomodActionReply) && strings.TrimSpace(r.Reply) == "" {
+		return invalid("the reply action requires a reply.")
+	}
+	return nil
+}
+
+// ParseAutomodRules parses (and validates) a list of AutoModerator rules,
+// written in either YAML or JSON.
+func ParseAutomodRules(source string) ([]*AutomodRule, error) {
+	if len(source) > maxAutomodRulesLength {
+		return nil, httperr.NewBadRequest("automod-rules-too-long", "AutoModerator rules are too long.")
+	}
+	var rules []*AutomodRule
+	if err := yaml.UnmarshalStrict([]byte(source), &rules); err != nil {
+		return nil, httperr.NewBadRequest("invalid-automod-rules", "Invalid AutoModerator rules: "+err.Error())
+	}
+	if len(rules) > maxAutomodRules {
+		return nil, httperr.NewBadRequest("too-many-automod-rules", fmt.Sprintf("A maximum of %d AutoModerator rules are allowed.", maxAutomodRules))
+	}
+	for i, rule := range rules {
+		if rule == nil {
+			return nil, httperr.NewBadRequest("invalid-automod-rule", fmt.Sprintf("Rule %d is empty.", i+1))
+		}
+		if err := rule.compile(i + 1); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// automodSubject is a post or a comment on which AutoModerator rules are
+// evaluated.
+type automodSubject struct {
+	contentType ContentType
+	title       string // Empty for comments.
+	body        string
+	domain      string // The link domain of link posts.
+	numReports  int
+
+	authorPoints    int
+	authorCreatedAt time.Time
+}
+
+// linkDomain returns the hostname of link, without the www prefix.
+func linkDomain(hostname string) string {
+	return strings.TrimPrefix(strings.ToLower(hostname), "www.")
+}
+
+func (r *AutomodRule) matches(s *automodSubject, now time.Time) bool {
+	switch r.Type {
+	case "post":
+		if s.contentType != ContentTypePost {
+			return false
+		}
+	case "comment":
+		if s.contentType != ContentTypeComment {
+			return false
+		}
+	}
+	if r.title != nil && !(s.contentType == ContentTypePost && r.title.MatchString(s.title)) {
+		return false
+	}
+	if r.body != nil && !r.body.MatchString(s.body) {
+		return false
+	}
+	if r.domain != nil && !(s.domain != "" && r.domain.MatchString(s.domain)) {
+		return false
+	}
+	if r.AccountAgeDaysBelow > 0 && now.Sub(s.authorCreatedAt) >= time.Duration(r.AccountAgeDaysBelow)*time.Hour*24 {
+		return false
+	}
+	if r.PointsBelow != nil && s.authorPoints >= *r.PointsBelow {
+		return false
+	}
+	if r.ReportsAtLeast > 0 && s.numReports < r.ReportsAtLeast {
+		return false
+	}
+	return true
+}
+
+// AutomodConfig is the AutoModerator configuration of a community.
+type AutomodConfig struct {
+	CommunityID uid.ID        `json:"communityId"`
+	Rules       string        `json:"rules"` // YAML or JSON, as written by the mods.
+	UpdatedBy   uid.NullID    `json:"updatedBy"`
+	UpdatedAt   msql.NullTime `json:"updatedAt"`
+}
+
+// GetAutomodConfig returns the AutoModerator configuration of community. If
+// there's none, an empty configuration is returned.
+func GetAutomodConfig(ctx context.Context, db *sql.DB, community uid.ID) (*AutomodConfig, error) {
+	c := &AutomodConfig{CommunityID: community}
+	row := db.QueryRowContext(ctx, "SELECT rules, updated_by, updated_at FROM community_automod WHERE community_id = ?", community)
+	if err := row.Scan(&c.Rules, &c.UpdatedBy, &c.UpdatedAt); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetAutomodRules replaces the AutoModerator rules of c. An empty rules removes
+// all the rules. The actions that AutoModerator takes (removing, locking, and
+// replying) are done on behalf of mod.
+func (c *Community) SetAutomodRules(ctx context.Context, db *sql.DB, mod uid.ID, rules string) (*AutomodConfig, error) {
+	if is, err := UserMod(ctx, db, c.ID, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+
+	if strings.TrimSpace(rules) == "" {
+		if _, err := db.ExecContext(ctx, "DELETE FROM community_automod WHERE community_id = ?", c.ID); err != nil {
+			return nil, err
+		}
+		automodRulesCache.invalidate(c.ID)
+		return GetAutomodConfig(ctx, db, c.ID)
+	}
+
+	if _, err := ParseAutomodRules(rules); err != nil {
+		return nil, err
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO community_automod (community_id, rules, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rules = VALUES(rules), updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)`,
+		c.ID, rules, mod, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	automodRulesCache.invalidate(c.ID)
+	return GetAutomodConfig(ctx, db, c.ID)
+}
+
+var automodRulesCache = &automodRulesCacheStore{entries: make(map[uid.ID]*automodRulesCacheEntry)}
+
+type automodRulesCacheStore struct {
+	mu      sync.Mutex // guards entries
+	entries map[uid.ID]*automodRulesCacheEntry
+}
+
+type automodRulesCacheEntry struct {
+	rules     []*AutomodRule // Compiled; nil if the community has no rules.
+	actor     uid.NullID     // On whose behalf the actions are taken.
+	fetchedAt time.Time
+}
+
+// get returns the compiled AutoModerator rules of community. The returned
+// entry is shared and must not be modified.
+func (ac *automodRulesCacheStore) get(ctx context.Context, db *sql.DB, community uid.ID) (*automodRulesCacheEntry, error) {
+	ac.mu.Lock()
+	entry, ok := ac.entries[community]
+	ac.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < automodRulesCacheTTL {
+		return entry, nil
+	}
+
+	config, err := GetAutomodConfig(ctx, db, community)
+	if err != nil {
+		return nil, err
+	}
+	entry = &automodRulesCacheEntry{actor: config.UpdatedBy, fetchedAt: time.Now()}
+	if config.Rules != "" {
+		if entry.rules, err = ParseAutomodRules(config.Rules); err != nil {
+			return nil, err
+		}
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.entries[community] = entry
+	return entry, nil
+}
+
+// invalidate removes the rules of community from the cache.
+func (ac *automodRulesCacheStore) invalidate(community uid.ID) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	delete(ac.entries, community)
+}
+
+// automodVerdict is the outcome of evaluating the AutoModerator rules of a
+// community on a post or a comment.
+type automodVerdict struct {
+	community uid.ID
+	actor     uid.NullID // On whose behalf the actions are taken.
+	rules     []*AutomodRule
+}
+
+func (v *automodVerdict) has(a AutomodAction) bool {
+	if v == nil {
+		return false
+	}
+	for _, rule := range v.rules {
+		if rule.hasAction(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateAutomod evaluates the AutoModerator rules of community on s, which is
+// authored by author. If reportsOnly is true, only the rules with a reports
+// condition are evaluated. It returns nil if no rules match. Posts and comments
+// of the mods of the community (and of admins) are exempt.
+func evaluateAutomod(ctx context.Context, db *sql.DB, community, author uid.ID, s *automodSubject, reportsOnly bool) (*automodVerdict, error) {
+	cached, err := automodRulesCache.get(ctx, db, community)
+	if err != nil {
+		return nil, err
+	}
+	if len(cached.rules) == 0 {
+		return nil, nil
+	}
+
+	if is, err := UserMod(ctx, db, community, author); err != nil {
+		return nil, err
+	} else if is {
+		return nil, nil
+	}
+	if is, err := IsAdmin(db, &author); err != nil {
+		return nil, err
+	} else if is {
+		return nil, nil
+	}
+
+	if s.authorPoints, s.authorCreatedAt, err = getUserPointsAndCreatedAt(ctx, db, nil, author); err != nil {
+		return nil, err
+	}
+	v := &automodVerdict{community: community, actor: cached.actor}
+	now := time.Now()
+	for _, rule := range cached.rules {
+		if reportsOnly && rule.ReportsAtLeast <= 0 {
+			continue
+		}
+		if rule.matches(s, now) {
+			v.rules = append(v.rules, rule)
+		}
+	}
+	if len(v.rules) == 0 {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// numContentReports returns the number of reports on the post or comment with
+// ID target.
+func numContentReports(ctx context.Context, db *sql.DB, target uid.ID, t ReportType) (n int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE target_id = ? AND report_type = ?", target, t).Scan(&n)
+	return
+}
+
+func newPostAutomodSubject(p *Post) *automodSubject {
+	s := &automodSubject{contentType: ContentTypePost, title: p.Title, body: p.Body.String}
+	if p.Link != nil {
+		s.domain = linkDomain(p.Link.Hostname)
+	}
+	return s
+}
+
+// runPostAutomod evaluates the AutoModerator rules of the community of p on p
+// (on its edit, or on it being reported), and carries out the actions of the
+// matching rules. Errors are only logged.
+func runPostAutomod(ctx context.Context, db *sql.DB, p *Post, reportsOnly bool) {
+	err := func() error {
+		s := newPostAutomodSubject(p)
+		var err error
+		if s.numReports, err = numContentReports(ctx, db, p.ID, ReportTypePost); err != nil {
+			return err
+		}
+		v, err := evaluateAutomod(ctx, db, p.CommunityID, p.AuthorID, s, reportsOnly)
+		if err != nil {
+			return err
+		}
+		return v.apply(ctx, db, p, nil)
+	}()
+	if err != nil {
+		log.Printf("AutoModerator failed on post %v: %v\n", p.ID, err)
+	}
+}
+
+// runCommentAutomod is the counterpart of runPostAutomod for comments.
+func runCommentAutomod(ctx context.Context, db *sql.DB, c *Comment, reportsOnly bool) {
+	err := func() error {
+		s := &automodSubject{contentType: ContentTypeComment, body: c.Body}
+		var err error
+		if s.numReports, err = numContentReports(ctx, db, c.ID, ReportTypeComment); err != nil {
+			return err
+		}
+		v, err := evaluateAutomod(ctx, db, c.CommunityID, c.AuthorID, s, reportsOnly)
+		if err != nil {
+			return err
+		}
+		return v.apply(ctx, db, nil, c)
+	}()
+	if err != nil {
+		log.Printf("AutoModerator failed on comment %v: %v\n", c.ID, err)
+	}
+}
+
+// claim records that the rules of v fired on target, and drops from v the
+// ones that had already fired on it, so that a rule is applied at most once on
+// a post or a comment (no matter how many times it's edited or reported).
+func (v *automodVerdict) claim(ctx context.Context, db *sql.DB, target uid.ID) error {
+	var rules []*AutomodRule
+	for _, rule := range v.rules {
+		res, err := db.ExecContext(ctx, "INSERT IGNORE INTO automod_fired_rules (target_id, rule_hash) VALUES (?, ?)", target, rule.hash())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	v.rules = rules
+	return nil
+}
+
+// PurgeAutomodFiredRules removes from the record of the rules that fired on
+// posts and comments the entries of the posts and comments that are deleted
+// (on which AutoModerator no longer runs). It returns the number of entries
+// removed. Call this function periodically.
+func PurgeAutomodFiredRules(ctx context.Context, db *sql.DB) (int, error) {
+	bulk, total := 1000, 0
+	for {
+		res, err := db.ExecContext(ctx, `DELETE FROM automod_fired_rules
+			WHERE NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = automod_fired_rules.target_id AND posts.deleted = FALSE)
+			AND NOT EXISTS (SELECT 1 FROM comments WHERE comments.id = automod_fired_rules.target_id AND comments.deleted_at IS NULL)
+			LIMIT ?`, bulk)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += int(n)
+		if n < int64(bulk) {
+			return total, nil
+		}
+	}
+}
+
+// automodReportReason returns the ID of the report reason of the reports filed
+// by AutoModerator.
+func automodReportReason(ctx context.Context, db *sql.DB) (id int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT id FROM report_reasons WHERE title = ? ORDER BY id LIMIT 1", automodReportReasonTitle).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("report reason %q not found", automodReportReasonTitle)
+	}
+	return
+}
+
+// apply carries out the actions of v on either post or comment. Errors are
+// logged, and the first one is returned, but the rest of the actions are still
+// attempted.
+//
+// Except for holding for approval, the actions are taken on behalf of the mod
+// who last set the rules; they are skipped if that user is no longer a mod.
+func (v *automodVerdict) apply(ctx context.Context, db *sql.DB, post *Post, comment *Comment) error {
+	if v == nil {
+		return nil
+	}
+
+	var target uid.ID
+	if comment != nil {
+		target = comment.ID
+	} else {
+		target = post.ID
+	}
+	if err := v.claim(ctx, db, target); err != nil {
+		return err
+	}
+	if len(v.rules) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	check := func(action AutomodAction, err error) {
+		if err != nil {
+			if e, ok := err.(*httperr.Error); ok && e.HTTPStatus == http.StatusConflict {
+				return // already done
+			}
+			log.Printf("AutoModerator action %s failed: %v\n", action, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if comment != nil && post == nil {
+		var err error
+		if post, err = GetPost(ctx, db, &comment.PostID, "", nil, true); err != nil {
+			return err
+		}
+	}
+
+	if v.has(AutomodActionHold) {
+		if comment != nil {
+			check(AutomodActionHold, comment.setPending(ctx, db, true))
+		} else {
+			check(AutomodActionHold, post.setPending(ctx, db, true))
+		}
+	}
+
+	actorMod := false
+	if v.actor.Valid {
+		var err error
+		if actorMod, err = UserMod(ctx, db, v.community, v.actor.ID); err != nil {
+			return err
+		}
+	}
+	if !actorMod {
+		log.Printf("AutoModerator rules of community %v were not set by a current mod; skipping all actions but %s\n", v.community, AutomodActionHold)
+		return firstErr
+	}
+	actor := v.actor.ID
+
+	if v.has(AutomodActionReport) {
+		reason, err := automodReportReason(ctx, db)
+		if err == nil {
+			if comment != nil {
+				_, err = NewCommentReport(ctx, db, comment.ID, reason, actor)
+			} else {
+				_, err = NewPostReport(ctx, db, post.ID, reason, actor)
+			}
+		}
+		check(AutomodActionReport, err)
+	}
+	for _, rule := range v.rules {
+		if rule.hasAction(AutomodActionReply) && !post.Locked {
+			var parent *uid.ID
+			if comment != nil {
+				parent = &comment.ID
+			}
+			_, err := post.AddComment(ctx, db, actor, UserGroupMods, parent, rule.Reply)
+			check(AutomodActionReply, err)
+		}
+	}
+	if v.has(AutomodActionLock) {
+		if comment != nil && !comment.Locked {
+			check(AutomodActionLock, comment.Lock(ctx, db, actor, UserGroupMods))
+		} else if comment == nil && !post.Locked {
+			check(AutomodActionLock, post.Lock(ctx, db, actor, UserGroupMods))
+		}
+	}
+	if v.has(AutomodActionRemove) {
+		if comment != nil && !comment.Deleted {
+			check(AutomodActionRemove, comment.Delete(ctx, db, actor, UserGroupMods))
+		} else if comment == nil && !post.Deleted {
+			check(AutomodActionRemove, post.Delete(ctx, db, actor, UserGroupMods, false, true))
+		}
+	}
+	return firstErr
+}
+
+// AutomodTestInput is a made up post or comment on which AutoModerator rules
+// are tried out.
+type AutomodTestInput struct {
+	Rules      *string     `json:"rules"` // If nil, the saved rules are used.
+	Type       ContentType `json:"type"`
+	Title      string      `json:"title"`
+	Body       string      `json:"body"`
+	URL        string      `json:"url"`
+	Author     uid.ID      `json:"-"`
+	NumReports int         `json:"noReports"`
+}
+
+// TestAutomod is a dry-run of AutoModerator: it returns the rules that match
+// in, without taking any actions. Unlike in a real run, mods are not exempt.
+func (c *Community) TestAutomod(ctx context.Context, db *sql.DB, in *AutomodTestInput) ([]*AutomodRule, error) {
+	source := ""
+	if in.Rules != nil {
+		source = *in.Rules
+	} else {
+		config, err := GetAutomodConfig(ctx, db, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		source = config.Rules
+	}
+	rules, err := ParseAutomodRules(source)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &automodSubject{contentType: in.Type, body: in.Body, numReports: in.NumReports}
+	if in.Type == ContentTypePost {
+		s.title = in.Title
+		if in.URL != "" {
+			u, err := parsePostLink(in.URL)
+			if err != nil {
+				return nil, err
+			}
+			s.domain = linkDomain(u.Hostname())
+		}
+	}
+	if s.authorPoints, s.authorCreatedAt, err = getUserPointsAndCreatedAt(ctx, db, nil, in.Author); err != nil {
+		return nil, err
+	}
+
+	matched := []*AutomodRule{}
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.matches(s, now) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAutomodRules(t *testing.T) {
+	cases := []struct {
+		source string
+		valid  bool
+	}{
+		{"", true},
+		{"- {name: Spam, body: 'buy now', actions: [remove]}", true},
+		{`[{"name": "Shorteners", "type": "post", "domain": "^bit\\.ly$", "actions": ["hold", "report"]}]`, true},
+		{"- {pointsBelow: 0, actions: [reply], reply: 'Welcome!'}", true},
+		{"- {body: 'x', actions: [reply]}", false},          // reply action without a reply
+		{"- {body: 'x', actions: [ban]}", false},            // unsupported action
+		{"- {body: 'x', actions: []}", false},               // no actions
+		{"- {actions: [remove]}", false},                    // no conditions
+		{"- {body: '(', actions: [remove]}", false},         // invalid regex
+		{"- {type: user, body: x, actions: [lock]}", false}, // invalid type
+		{"- {body: x, actions: [lock], color: red}", false}, // unknown field
+	}
+	for _, item := range cases {
+		if _, err := ParseAutomodRules(item.source); (err == nil) != item.valid {
+			t.Errorf("ParseAutomodRules(%q) = %v, want valid: %v", item.source, err, item.valid)
+		}
+	}
+}
+
+func TestAutomodRuleMatches(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	rules, err := ParseAutomodRules(`
+- name: new accounts linking shorteners
+  type: post
+  domain: '^(bit\.ly|tinyurl\.com)$'
+  accountAgeDaysBelow: 7
+  actions: [hold]
+- name: heavily reported
+  reportsAtLeast: 3
+  actions: [lock]
+- name: low karma spam
+  body: '(?i)free money'
+  pointsBelow: 10
+  actions: [remove]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAccount, oldAccount := now.Add(-time.Hour*24), now.Add(-time.Hour*24*30)
+	cases := []struct {
+		rule    int
+		subject automodSubject
+		want    bool
+	}{
+		{0, automodSubject{contentType: ContentTypePost, domain: "bit.ly", authorCreatedAt: newAccount}, true},
+		{0, automodSubject{contentType: ContentTypePost, domain: "bit.ly", authorCreatedAt: oldAccount}, false},
+		{0, automodSubject{contentType: ContentTypePost, domain: "example.com", authorCreatedAt: newAccount}, false},
+		{0, automodSubject{contentType: ContentTypeComment, body: "bit.ly", authorCreatedAt: newAccount}, false},
+		{1, automodSubject{contentType: ContentTypeComment, numReports: 3}, true},
+		{1, automodSubject{contentType: ContentTypePost, numReports: 2}, false},
+		{2, automodSubject{contentType: ContentTypeComment, body: "Get FREE money", authorPoints: 5}, true},
+		{2, automodSubject{contentType: ContentTypeComment, body: "Get FREE money", authorPoints: 50}, false},
+		{2, automodSubject{contentType: ContentTypePost, title: "free money", authorPoints: 5}, false},
+	}
+	for _, item := range cases {
+		if got := rules[item.rule].matches(&item.subject, now); got != item.want {
+			t.Errorf("rule %q matches %+v = %v, want %v", rules[item.rule].Name, item.subject, got, item.want)
+		}
+	}
+}
+
+func TestAutomodRuleHash(t *testing.T) {
+	rules, err := ParseAutomodRules(`
+- {name: Welcome, pointsBelow: 1, actions: [reply], reply: 'Welcome!'}
+- {name: Welcome, pointsBelow: 1, actions: [reply], reply: 'Hello!'}
+- {name: Welcome, pointsBelow: 1, actions: [reply], reply: 'Welcome!'}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rules[0].hash()) != string(rules[2].hash()) {
+		t.Error("identical rules have different hashes")
+	}
+	if string(rules[0].hash()) == string(rules[1].hash()) {
+		t.Error("different rules have the same hash")
+	}
+}
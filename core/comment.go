@@ -99,6 +99,15 @@ type Comment struct {
 	LockedAs UserGroup     `json:"lockedByGroup,omitempty"`
 	LockedAt msql.NullTime `json:"lockedAt"`
 
+	// Pending is true if the comment is held for approval by the mods. The
+	// body of a pending comment is visible only to its author and the mods.
+	Pending bool `json:"pending"`
+
+	// The scores of the comment for the best and the controversial comment
+	// sorts (see CommentBestScore and CommentControversy).
+	bestScore   int
+	controversy int
+
 	Author *User `json:"author,omitempty"`
 
 	// Reports whether the author of this comment is muted by the viewer.
@@ -139,6 +148,9 @@ func buildSelectCommentsQuery(loggedIn bool, where string) string {
 		"comments.locked_at",
 		"comments.locked_by",
 		"comments.locked_by_group",
+		"comments.pending",
+		"comments.best_score",
+		"comments.controversy",
 	}
 	var joins []string
 	if loggedIn {
@@ -229,6 +241,9 @@ func scanComments(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.I
 			&comment.LockedAt,
 			&comment.LockedBy,
 			&comment.LockedAs,
+			&comment.Pending,
+			&comment.bestScore,
+			&comment.controversy,
 		}
 		if loggedIn {
 			dest = append(dest, &comment.ViewerVoted, &comment.ViewerVotedUp)
@@ -309,6 +324,30 @@ func scanComments(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.I
 		}
 	}
 
+	// Hide the body of comments held for approval from everyone but their
+	// authors and the mods.
+	if !viewerAdmin {
+		viewerModOf := make(map[uid.ID]bool) // keys are community ids
+		for _, comment := range comments {
+			if !comment.Pending || (viewer != nil && comment.AuthorID == *viewer) {
+				continue
+			}
+			viewerMod := false
+			if viewer != nil {
+				var ok bool
+				if viewerMod, ok = viewerModOf[comment.CommunityID]; !ok {
+					if viewerMod, err = UserMod(ctx, db, comment.CommunityID, *viewer); err != nil {
+						return nil, err
+					}
+					viewerModOf[comment.CommunityID] = viewerMod
+				}
+			}
+			if !viewerMod {
+				comment.Body = ""
+			}
+		}
+	}
+
 	// Strip deleted author information, unless the viewer is an admin.
 	for _, comment := range comments {
 		if comment.AuthorDeleted {
@@ -365,6 +404,15 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 		ancestors = append(ancestors, parent.ID)
 	}
 
+	automod, err := evaluateAutomod(ctx, db, post.CommunityID, author.ID, &automodSubject{
+		contentType: ContentTypeComment,
+		body:        commentBody,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	pending := automod.has(AutomodActionHold)
+
 	id := uid.New()
 	f := func(tx *sql.Tx) error {
 		depth, newParentID := 0, uid.NullID{}
@@ -393,8 +441,9 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 						ancestors,
 						body,
 						created_at,
-						community_name) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+						community_name,
+						pending) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 		args := []any{
 			id,
 			post.ID,
@@ -409,6 +458,7 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 			commentBody,
 			now,
 			post.CommunityName,
+			pending,
 		}
 		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
 			return err
@@ -454,10 +504,31 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 		return nil, err
 	}
 
-	// Send notifications.
+	// Send notifications (unless the comment is held for approval, in which
+	// case they are sent once it's approved).
+	if !pending {
+		sendNewCommentNotifications(db, post, parent, id, author)
+	}
+
+	c, err := GetComment(ctx, db, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Pending {
+		queueWebhookEvent(db, c.CommunityID, WebhookEventCommentNew, c)
+	}
+	if err := automod.apply(ctx, db, nil, c); err != nil {
+		log.Printf("AutoModerator failed on new comment %v: %v\n", c.ID, err)
+	}
+	return c, nil
+}
+
+// sendNewCommentNotifications notifies the author of parent (if it's not nil),
+// and the author of post, of the new comment, by author, in the background.
+func sendNewCommentNotifications(db *sql.DB, post *Post, parent *Comment, comment uid.ID, author *User) {
 	if parent != nil && !parent.AuthorID.EqualsTo(author.ID) {
 		go func() {
-			if err := CreateCommentReplyNotification(context.Background(), db, parent.AuthorID, parent.ID, id, author, post); err != nil {
+			if err := CreateCommentReplyNotification(context.Background(), db, parent.AuthorID, parent.ID, comment, author, post); err != nil {
 				log.Printf("Create reply notification failed: %v\n", err)
 			}
 		}()
@@ -465,13 +536,11 @@ func addComment(ctx context.Context, db *sql.DB, post *Post, author *User, paren
 	}
 	if !post.AuthorID.EqualsTo(author.ID) && (parent == nil || !(parent.AuthorID.EqualsTo(post.AuthorID))) {
 		go func() {
-			if err := CreateNewCommentNotification(context.Background(), db, post, id, author); err != nil {
+			if err := CreateNewCommentNotification(context.Background(), db, post, comment, author); err != nil {
 				log.Printf("Create new_comment notification failed: %v\n", err)
 			}
 		}()
 	}
-
-	return GetComment(ctx, db, id, nil)
 }
 
 // Save updates comment's body.
@@ -486,13 +555,51 @@ func (c *Comment) Save(ctx context.Context, db *sql.DB, user uid.ID) error {
 	c.Body = utils.TruncateUnicodeString(c.Body, maxCommentBodyLength)
 
 	now := time.Now()
-	query := "UPDATE comments SET body = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL"
-	_, err := db.ExecContext(ctx, query, c.Body, now, c.ID)
-	if err == nil {
-		c.EditedAt.Valid = true
-		c.EditedAt.Time = now
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := saveCommentRevision(ctx, tx, c.ID, c.Body); err != nil {
+			return err
+		}
+		query := "UPDATE comments SET body = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL"
+		_, err := tx.ExecContext(ctx, query, c.Body, now, c.ID)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	return err
+	c.EditedAt.Valid = true
+	c.EditedAt.Time = now
+	runCommentAutomod(ctx, db, c, false)
+	return nil
+}
+
+// CheckViewable returns errCommentNotFound if the post of c is held for
+// approval by the mods and viewer is not allowed to see it (see
+// Post.CheckViewable).
+func (c *Comment) CheckViewable(ctx context.Context, db *sql.DB, viewer *uid.ID) error {
+	post := &Post{ID: c.PostID}
+	row := db.QueryRowContext(ctx, "SELECT user_id, community_id, pending FROM posts WHERE id = ?", c.PostID)
+	if err := row.Scan(&post.AuthorID, &post.CommunityID, &post.Pending); err != nil {
+		return err
+	}
+	if err := post.CheckViewable(ctx, db, viewer); err != nil {
+		if err == errPostNotFound {
+			return errCommentNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// setPending sets whether c is held for approval by the mods.
+func (c *Comment) setPending(ctx context.Context, db *sql.DB, pending bool) error {
+	if c.Pending == pending {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE comments SET pending = ? WHERE id = ?", pending, c.ID); err != nil {
+		return err
+	}
+	c.Pending = pending
+	return nil
 }
 
 // Delete returns an error if user, who's deleting the comment, has no
@@ -529,39 +636,69 @@ func (c *Comment) Delete(ctx context.Context, db *sql.DB, user uid.ID, g UserGro
 
 	now := time.Now()
 	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
-		var newBody string
-		if g == UserGroupNormal {
-			newBody = ""
-		} else {
-			newBody = c.Body
-		}
-		if _, err := tx.ExecContext(ctx, `UPDATE comments SET body = ?, deleted_at = ?, deleted_by = ?, deleted_as = ? WHERE id = ?`, newBody, now, user, g, c.ID); err != nil {
+		return c.deleteTx(ctx, tx, user, g, now)
+	})
+	if err != nil {
+		return err
+	}
+	c.afterDelete(ctx, db, user, g, now)
+	return nil
+}
+
+// deleteTx performs the database writes of Delete as part of tx. Permissions
+// are not checked.
+func (c *Comment) deleteTx(ctx context.Context, tx *sql.Tx, user uid.ID, g UserGroup, now time.Time) error {
+	var newBody string
+	if g == UserGroupNormal {
+		newBody = ""
+	} else {
+		newBody = c.Body
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE comments SET body = ?, deleted_at = ?, deleted_by = ?, deleted_as = ? WHERE id = ?`, newBody, now, user, g, c.ID); err != nil {
+		return err
+	}
+	if g == UserGroupNormal {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM posts_comments WHERE target_id = ? AND user_id = ?", c.ID, c.AuthorID); err != nil {
 			return err
 		}
-		if g == UserGroupNormal {
-			if _, err := tx.ExecContext(ctx, "DELETE FROM posts_comments WHERE target_id = ? AND user_id = ?", c.ID, c.AuthorID); err != nil {
-				return err
-			}
-		} else {
-			if _, err := tx.ExecContext(ctx, "UPDATE posts_comments SET deleted = true WHERE target_id = ? AND user_id = ?", c.ID, c.AuthorID); err != nil {
-				return err
-			}
+		// The body is gone, so are its previous versions.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_revisions WHERE comment_id = ?", c.ID); err != nil {
+			return err
 		}
-		if _, err := tx.ExecContext(ctx, "UPDATE users SET no_comments = no_comments - 1 WHERE id = ?", c.AuthorID); err != nil {
+	} else {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts_comments SET deleted = true WHERE target_id = ? AND user_id = ?", c.ID, c.AuthorID); err != nil {
 			return err
 		}
-		return nil
-	})
-	if err != nil {
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET no_comments = no_comments - 1 WHERE id = ?", c.AuthorID); err != nil {
 		return err
 	}
+	if g != UserGroupNormal {
+		entry := newModLogEntry(&c.CommunityID, user, g, ModLogActionCommentDelete, ModLogTargetComment, c.ID.String())
+		entry.Details["postPublicId"] = c.PostPublicID
+		entry.Details["authorId"] = c.AuthorID
+		if err := entry.insert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// afterDelete updates c after it's deleted (by deleteTx), and resolves the
+// reports on it.
+func (c *Comment) afterDelete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup, now time.Time) {
 	c.DeletedAt = msql.NewNullTime(now)
 	c.DeletedBy = uid.NullID{Valid: true, ID: user}
 	c.DeletedAs = g
 	c.StripContent()
-	RemoveAllReportsOfComment(ctx, db, c.ID)
-	return err
+
+	action := ReportActionCommentRemoved
+	if g == UserGroupNormal {
+		action = ReportActionDeletedByAuthor
+	}
+	if err := ResolveAllReportsOfComment(ctx, db, c.ID, action, user); err != nil {
+		log.Printf("Failed to resolve reports of comment %v: %v\n", c.ID, err)
+	}
 }
 
 // Lock locks the comment on behalf of user who's locking the comment in his or
@@ -593,16 +730,33 @@ func (c *Comment) Lock(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup
 	}
 
 	now := time.Now()
-	_, err := db.ExecContext(ctx, "UPDATE comments SET locked_at = ?, locked_by = ?, locked_by_group = ? WHERE id = ?", now, user, g, c.ID)
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return c.lockTx(ctx, tx, user, g, now)
+	})
 	if err == nil {
-		c.Locked = true
-		c.LockedAt = msql.NewNullTime(now)
-		c.LockedBy.Valid, c.LockedBy.ID = true, user
-		c.LockedAs = g
+		c.setLocked(user, g, now)
 	}
 	return err
 }
 
+// lockTx performs the database writes of Lock as part of tx. Permissions are
+// not checked.
+func (c *Comment) lockTx(ctx context.Context, tx *sql.Tx, user uid.ID, g UserGroup, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE comments SET locked_at = ?, locked_by = ?, locked_by_group = ? WHERE id = ?", now, user, g, c.ID); err != nil {
+		return err
+	}
+	entry := newModLogEntry(&c.CommunityID, user, g, ModLogActionCommentLock, ModLogTargetComment, c.ID.String())
+	entry.Details["postPublicId"] = c.PostPublicID
+	return entry.insert(ctx, tx)
+}
+
+func (c *Comment) setLocked(user uid.ID, g UserGroup, now time.Time) {
+	c.Locked = true
+	c.LockedAt = msql.NewNullTime(now)
+	c.LockedBy.Valid, c.LockedBy.ID = true, user
+	c.LockedAs = g
+}
+
 // Unlock unlocks the comment on behalf of user.
 func (c *Comment) Unlock(ctx context.Context, db *sql.DB, user uid.ID) error {
 	isMod, err := UserMod(ctx, db, c.CommunityID, user)
@@ -618,7 +772,18 @@ func (c *Comment) Unlock(ctx context.Context, db *sql.DB, user uid.ID) error {
 		return httperr.NewForbidden("not-mod-not-admin", "User is neither a moderator nor an admin.")
 	}
 
-	_, err = db.ExecContext(ctx, "UPDATE comments SET locked_at = NULL, locked_by = NULL, locked_by_group = 0 WHERE id = ?", c.ID)
+	g := UserGroupAdmins
+	if isMod {
+		g = UserGroupMods
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE comments SET locked_at = NULL, locked_by = NULL, locked_by_group = 0 WHERE id = ?", c.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&c.CommunityID, user, g, ModLogActionCommentUnlock, ModLogTargetComment, c.ID.String())
+		entry.Details["postPublicId"] = c.PostPublicID
+		return entry.insert(ctx, tx)
+	})
 	if err == nil {
 		c.Locked = false
 		c.LockedAt.Valid = false
@@ -701,6 +866,9 @@ func (c *Comment) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool, ne
 		if _, err := tx.ExecContext(ctx, query, point, c.ID); err != nil {
 			return err
 		}
+		if err := updateCommentScores(ctx, tx, c.ID); err != nil {
+			return err
+		}
 		if up && !c.AuthorID.EqualsTo(user) && canUserIncrementPoints {
 			if err := incrementUserPoints(ctx, tx, c.AuthorID, 1); err != nil {
 				return err
@@ -771,6 +939,9 @@ func (c *Comment) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error
 		if _, err := tx.ExecContext(ctx, query, point, c.ID); err != nil {
 			return err
 		}
+		if err := updateCommentScores(ctx, tx, c.ID); err != nil {
+			return err
+		}
 		if up && !c.AuthorID.EqualsTo(user) && !userNew {
 			if err := incrementUserPoints(ctx, tx, c.AuthorID, -1); err != nil {
 				return err
@@ -836,6 +1007,9 @@ func (c *Comment) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bo
 		if _, err := tx.ExecContext(ctx, query, points, c.ID); err != nil {
 			return err
 		}
+		if err := updateCommentScores(ctx, tx, c.ID); err != nil {
+			return err
+		}
 		if !c.AuthorID.EqualsTo(user) && !userNew {
 			points := 1
 			if dbUp {
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"math"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// CommentSort is the order in which the comments of a post are returned.
+type CommentSort string
+
+const (
+	CommentSortBest          = CommentSort("best")          // By the lower bound of the Wilson score interval.
+	CommentSortTop           = CommentSort("top")           // By the number of upvotes.
+	CommentSortNew           = CommentSort("new")           // Newest first.
+	CommentSortOld           = CommentSort("old")           // Oldest first.
+	CommentSortControversial = CommentSort("controversial") // Many, and evenly split, votes first.
+
+	CommentSortDefault = CommentSortTop
+)
+
+// ErrInvalidCommentSort is returned for an unsupported CommentSort.
+var ErrInvalidCommentSort = httperr.NewBadRequest("invalid-comment-sort", "Invalid comment sort.")
+
+// Valid reports whether s is a valid CommentSort.
+func (s CommentSort) Valid() bool {
+	switch s {
+	case CommentSortBest, CommentSortTop, CommentSortNew, CommentSortOld, CommentSortControversial:
+		return true
+	}
+	return false
+}
+
+// column returns the column of the comments table by which the comments are
+// sorted (in descending order). It returns an empty string for the new and old
+// sorts, which are sorted by ID.
+func (s CommentSort) column() string {
+	switch s {
+	case CommentSortBest:
+		return "comments.best_score"
+	case CommentSortControversial:
+		return "comments.controversy"
+	case CommentSortNew, CommentSortOld:
+		return ""
+	}
+	return "comments.upvotes"
+}
+
+// score returns the value, of the column by which comments are sorted, of c.
+func (s CommentSort) score(c *Comment) int {
+	switch s {
+	case CommentSortBest:
+		return c.bestScore
+	case CommentSortControversial:
+		return c.controversy
+	case CommentSortNew, CommentSortOld:
+		return 0
+	}
+	return c.Upvotes
+}
+
+// whereCursor appends to where the condition for fetching the comments that
+// come after (and including) cursor.
+func (s CommentSort) whereCursor(where string, args []any, cursor *CommentsCursor) (string, []any) {
+	switch s {
+	case CommentSortNew:
+		where += "AND comments.id <= ? "
+		args = append(args, cursor.NextID)
+	case CommentSortOld:
+		where += "AND comments.id >= ? "
+		args = append(args, cursor.NextID)
+	default:
+		where += "AND (" + s.column() + ", comments.id) <= (?, ?) "
+		args = append(args, cursor.Score, cursor.NextID)
+	}
+	return where, args
+}
+
+// orderBy returns the ORDER BY clause of the sort.
+func (s CommentSort) orderBy() string {
+	switch s {
+	case CommentSortNew:
+		return "ORDER BY comments.id DESC "
+	case CommentSortOld:
+		return "ORDER BY comments.id ASC "
+	}
+	return "ORDER BY " + s.column() + " DESC, comments.id DESC "
+}
+
+// wilsonZ is the z-score of the 80% confidence level.
+const wilsonZ = 1.281551565545
+
+// CommentBestScore returns the lower bound of the Wilson score confidence
+// interval of the comment's upvote ratio, scaled to an integer in the range
+// [0, 1000000].
+func CommentBestScore(upvotes, downvotes int) int {
+	n := float64(upvotes + downvotes)
+	if n <= 0 {
+		return 0
+	}
+	p := float64(upvotes) / n
+	z2 := wilsonZ * wilsonZ
+	lower := (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+	return int(math.Round(lower * 1000000))
+}
+
+// CommentControversy returns a score that's higher for comments with a larger
+// number of votes that are more evenly split between upvotes and downvotes.
+func CommentControversy(upvotes, downvotes int) int {
+	return controversy(upvotes, downvotes)
+}
+
+// controversy is the controversy score of both posts and comments. It's
+// round(1000 * (upvotes + downvotes) ^ balance), where balance is the ratio of
+// the smaller of upvotes and downvotes to the larger, and it's zero if either
+// is zero.
+func controversy(upvotes, downvotes int) int {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(downvotes) / float64(upvotes)
+	if upvotes < downvotes {
+		balance = float64(upvotes) / float64(downvotes)
+	}
+	return int(math.Round(1000 * math.Pow(magnitude, balance)))
+}
+
+// updateCommentScores recalculates the best and the controversial sort scores
+// of comment. It's called whenever the votes of a comment change.
+func updateCommentScores(ctx context.Context, tx *sql.Tx, comment uid.ID) error {
+	var upvotes, downvotes int
+	if err := tx.QueryRowContext(ctx, "SELECT upvotes, downvotes FROM comments WHERE id = ?", comment).Scan(&upvotes, &downvotes); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE comments SET best_score = ?, controversy = ? WHERE id = ?",
+		CommentBestScore(upvotes, downvotes), CommentControversy(upvotes, downvotes), comment)
+	return err
+}
@@ -0,0 +1,43 @@
+package core
+
+import "testing"
+
+func TestCommentBestScore(t *testing.T) {
+	if got := CommentBestScore(0, 0); got != 0 {
+		t.Errorf("CommentBestScore(0, 0) = %d, want 0", got)
+	}
+	tests := []struct {
+		higher, lower [2]int // upvotes, downvotes
+	}{
+		{[2]int{10, 0}, [2]int{1, 0}},
+		{[2]int{100, 10}, [2]int{10, 1}},
+		{[2]int{5, 0}, [2]int{5, 5}},
+	}
+	for _, test := range tests {
+		h := CommentBestScore(test.higher[0], test.higher[1])
+		l := CommentBestScore(test.lower[0], test.lower[1])
+		if h <= l {
+			t.Errorf("CommentBestScore%v = %d, not higher than CommentBestScore%v = %d", test.higher, h, test.lower, l)
+		}
+	}
+}
+
+func TestCommentControversy(t *testing.T) {
+	tests := []struct {
+		up, down, want int
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{0, 5, 0},
+		{5, 5, 10000},
+		{1, 1, 2000},
+	}
+	for _, test := range tests {
+		if got := CommentControversy(test.up, test.down); got != test.want {
+			t.Errorf("CommentControversy(%d, %d) = %d, want %d", test.up, test.down, got, test.want)
+		}
+	}
+	if CommentControversy(10, 10) <= CommentControversy(10, 5) {
+		t.Error("evenly split votes should be more controversial")
+	}
+}
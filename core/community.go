@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +34,8 @@ type Community struct {
 	ProPic            *images.Image   `json:"proPic"`
 	BannerImage       *images.Image   `json:"bannerImage"`
 	PostingRestricted bool            `json:"postingRestricted"` // If true only mods can post.
+	PostApproval      PostApproval    `json:"postApproval"`      // Which new posts are held for approval.
+	ModLogPublic      bool            `json:"modLogPublic"`      // If true the modlog is viewable by everyone.
 	CreatedAt         time.Time       `json:"createdAt"`
 	DeletedAt         msql.NullTime   `json:"deletedAt"`
 	DeletedBy         uid.NullID      `json:"-"`
@@ -60,6 +63,8 @@ func buildSelectCommunityQuery(where string) string {
 		"communities.no_members",
 		"communities.posts_count",
 		"communities.posting_restricted",
+		"communities.post_approval",
+		"communities.modlog_public",
 		"communities.created_at",
 		"communities.deleted_at",
 	}
@@ -169,6 +174,8 @@ func scanCommunities(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *ui
 			&c.NumMembers,
 			&c.PostsCount,
 			&c.PostingRestricted,
+			&c.PostApproval,
+			&c.ModLogPublic,
 			&c.CreatedAt,
 			&c.DeletedAt,
 		}
@@ -281,7 +288,7 @@ func CreateCommunity(ctx context.Context, db *sql.DB, creator uid.ID, reqPoints,
 	// Attempt to make user a mod of community.
 	if err := comm.Join(ctx, db, creator); err == nil {
 		comm.ViewerJoined = msql.NewNullBool(true)
-		if err = makeUserMod(ctx, db, comm, creator, true); err == nil {
+		if err = makeUserMod(ctx, db, comm, creator, true, nil); err == nil {
 			comm.ViewerMod = msql.NewNullBool(true)
 		}
 	}
@@ -419,15 +426,20 @@ func GetCommunitiesPrefix(ctx context.Context, db *sql.DB, s string) ([]*Communi
 //   - NSFW
 //   - About
 //   - PostingRestricted
+//   - PostApproval
+//   - ModLogPublic
 func (c *Community) Update(ctx context.Context, db *sql.DB, mod uid.ID) error {
 	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
 		return err
 	} else if !is {
 		return errNotMod
 	}
+	if !c.PostApproval.Valid() {
+		return httperr.NewBadRequest("invalid-post-approval", "Invalid post approval setting.")
+	}
 
 	c.About.String = utils.TruncateUnicodeString(c.About.String, maxCommunityAboutLength)
-	_, err := db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ?, posting_restricted = ? WHERE id = ?", c.NSFW, c.About, c.PostingRestricted, c.ID)
+	_, err := db.ExecContext(ctx, "UPDATE communities SET nsfw = ?, about = ?, posting_restricted = ?, post_approval = ?, modlog_public = ? WHERE id = ?", c.NSFW, c.About, c.PostingRestricted, c.PostApproval, c.ModLogPublic, c.ID)
 	return err
 }
 
@@ -651,8 +663,9 @@ func (c *Community) PopulateViewerFields(ctx context.Context, db *sql.DB, user u
 	return nil
 }
 
-// BanUser bans user by mod. If expires is non-nil, the ban is permanent.
-func (c *Community) BanUser(ctx context.Context, db *sql.DB, mod, user uid.ID, expires *time.Time) error {
+// BanUser bans user by mod. If expires is nil, the ban is permanent. The user
+// is notified of the ban, along with the reason.
+func (c *Community) BanUser(ctx context.Context, db *sql.DB, mod, user uid.ID, expires *time.Time, reason string) error {
 	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
 		return err
 	} else if !is {
@@ -661,13 +674,59 @@ func (c *Community) BanUser(ctx context.Context, db *sql.DB, mod, user uid.ID, e
 
 	// TODO: Shouldn't be able to ban another mod or an admin.
 
+	if err := validateBan(expires, reason); err != nil {
+		return err
+	}
+
+	g, err := modOrAdminGroup(ctx, db, c.ID, mod)
+	if err != nil {
+		return err
+	}
+
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return c.banUserTx(ctx, tx, mod, g, user, expires, reason)
+	})
+	if err != nil {
+		return err
+	}
+	c.afterBan(db, mod, user, expires, reason)
+	return nil
+}
+
+// banUserTx performs the database writes of BanUser as part of tx. Neither
+// the permissions nor the ban are validated.
+func (c *Community) banUserTx(ctx context.Context, tx *sql.Tx, mod uid.ID, g UserGroup, user uid.ID, expires *time.Time, reason string) error {
 	var t msql.NullTime
 	if expires != nil {
 		t.Valid = true
 		t.Time = *expires
 	}
-	_, err := db.ExecContext(ctx, "INSERT INTO community_banned (user_id, community_id, expires, banned_by) VALUES (?, ?, ?, ?)", user, c.ID, t, mod)
-	return err
+	if _, err := tx.ExecContext(ctx, "INSERT INTO community_banned (user_id, community_id, expires, banned_by, reason) VALUES (?, ?, ?, ?, ?)", user, c.ID, t, mod, msql.NewNullString(reason)); err != nil {
+		return err
+	}
+	entry := newModLogEntry(&c.ID, mod, g, ModLogActionUserBan, ModLogTargetUser, user.String())
+	entry.Details["expires"] = t
+	entry.Details["reason"] = reason
+	if err := entry.setTargetUsername(ctx, tx, user); err != nil {
+		return err
+	}
+	return entry.insert(ctx, tx)
+}
+
+// afterBan notifies user of the ban and sends the ban webhook.
+func (c *Community) afterBan(db *sql.DB, mod, user uid.ID, expires *time.Time, reason string) {
+	go func() {
+		if err := CreateBannedNotification(context.Background(), db, user, c.Name, expires, reason); err != nil {
+			log.Printf("Failed to create banned notification (community: %s, user: %v): %v\n", c.Name, user, err)
+		}
+	}()
+
+	queueWebhookEvent(db, c.ID, WebhookEventUserBanned, struct {
+		UserID    uid.ID     `json:"userId"`
+		BannedBy  uid.ID     `json:"bannedBy"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+		Reason    string     `json:"reason"`
+	}{user, mod, expires, reason})
 }
 
 func (c *Community) UnbanUser(ctx context.Context, db *sql.DB, mod, user uid.ID) error {
@@ -676,11 +735,25 @@ func (c *Community) UnbanUser(ctx context.Context, db *sql.DB, mod, user uid.ID)
 	} else if !is {
 		return errNotMod
 	}
-	return unbanUserFromCommunity(ctx, db, c.ID, user)
+
+	g, err := modOrAdminGroup(ctx, db, c.ID, mod)
+	if err != nil {
+		return err
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := unbanUserFromCommunity(ctx, tx, c.ID, user); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&c.ID, mod, g, ModLogActionUserUnban, ModLogTargetUser, user.String())
+		if err := entry.setTargetUsername(ctx, tx, user); err != nil {
+			return err
+		}
+		return entry.insert(ctx, tx)
+	})
 }
 
-func unbanUserFromCommunity(ctx context.Context, db *sql.DB, community, user uid.ID) error {
-	_, err := db.ExecContext(ctx, "DELETE FROM community_banned WHERE community_id = ? AND user_id = ?", community, user)
+func unbanUserFromCommunity(ctx context.Context, tx *sql.Tx, community, user uid.ID) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM community_banned WHERE community_id = ? AND user_id = ?", community, user)
 	return err
 }
 
@@ -720,12 +793,11 @@ func IsUserBannedFromCommunity(ctx context.Context, db *sql.DB, community, user
 		}
 		return false, err
 	}
-	if expires.Valid {
-		now := time.Now()
-		if now.Sub(expires.Time) < 0 {
-			// expired
-			return false, unbanUserFromCommunity(ctx, db, community, user)
-		}
+	if expires.Valid && !time.Now().Before(expires.Time) {
+		// expired
+		return false, msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			return unbanUserFromCommunity(ctx, tx, community, user)
+		})
 	}
 	return true, nil
 }
@@ -985,7 +1057,19 @@ func MakeUserMod(ctx context.Context, db *sql.DB, c *Community, viewer uid.ID, u
 		}
 	}
 
-	err = makeUserMod(ctx, db, c, user, isMod)
+	g := UserGroupMods
+	if is, err := c.UserMod(ctx, db, viewer); err != nil {
+		return err
+	} else if !is {
+		g = UserGroupAdmins
+	}
+	action := ModLogActionModAdd
+	if !isMod {
+		action = ModLogActionModRemove
+	}
+	entry := newModLogEntry(&c.ID, viewer, g, action, ModLogTargetUser, user.String())
+
+	err = makeUserMod(ctx, db, c, user, isMod, entry)
 	if err == nil {
 		if err := c.FixModPositions(ctx, db); err != nil {
 			log.Println("Fixing mod positions failed: ", err)
@@ -1008,7 +1092,7 @@ func MakeUserMod(ctx context.Context, db *sql.DB, c *Community, viewer uid.ID, u
 // MakeUserModCLI adds or removes user as a mod of c. Do not use this function
 // in an API.
 func MakeUserModCLI(ctx context.Context, db *sql.DB, c *Community, user uid.ID, isMod bool) error {
-	return makeUserMod(ctx, db, c, user, isMod)
+	return makeUserMod(ctx, db, c, user, isMod, nil)
 }
 
 // makeUserMod makes user a moderator of c, or, if isMod is false, user is
@@ -1016,7 +1100,10 @@ func MakeUserModCLI(ctx context.Context, db *sql.DB, c *Community, user uid.ID,
 //
 // It's okay to call this function if user is already a mod of c. It doesn't
 // change anything.
-func makeUserMod(ctx context.Context, db *sql.DB, c *Community, user uid.ID, isMod bool) error {
+//
+// If entry is non-nil, it's saved to the modlog as part of the same
+// transaction.
+func makeUserMod(ctx context.Context, db *sql.DB, c *Community, user uid.ID, isMod bool, entry *ModLogEntry) error {
 	// When changing the SQL queries of this function, make duplicate the
 	// changes in User.Delete function as well.
 
@@ -1059,6 +1146,15 @@ func makeUserMod(ctx context.Context, db *sql.DB, c *Community, user uid.ID, isM
 		if _, err := tx.ExecContext(ctx, "UPDATE community_members SET is_mod = ? WHERE community_id = ? AND user_id = ?", isMod, c.ID, user); err != nil {
 			return err
 		}
+
+		if entry != nil {
+			if err := entry.setTargetUsername(ctx, tx, user); err != nil {
+				return err
+			}
+			if err := entry.insert(ctx, tx); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
@@ -1076,12 +1172,28 @@ func (c *Community) AddRule(ctx context.Context, db *sql.DB, rule, description s
 		return err
 	}
 
+	g, err := modOrAdminGroup(ctx, db, c.ID, mod)
+	if err != nil {
+		return err
+	}
+
 	var d any
 	if description != "" {
 		d = description
 	}
-	_, err := db.ExecContext(ctx, "INSERT INTO community_rules (rule, description, community_id, created_by, z_index) VALUES (?, ?, ?, ?, ?)", rule, d, c.ID, mod, zIndex+1)
-	return err
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "INSERT INTO community_rules (rule, description, community_id, created_by, z_index) VALUES (?, ?, ?, ?, ?)", rule, d, c.ID, mod, zIndex+1)
+		if err != nil {
+			return err
+		}
+		ruleID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		entry := newModLogEntry(&c.ID, mod, g, ModLogActionRuleAdd, ModLogTargetRule, strconv.FormatInt(ruleID, 10))
+		entry.Details["rule"] = rule
+		return entry.insert(ctx, tx)
+	})
 }
 
 func (c *Community) RemoveRule(ctx context.Context, db *sql.DB, ruleID string, mod uid.ID) error {
@@ -1201,12 +1313,22 @@ func (r *CommunityRule) Delete(ctx context.Context, db *sql.DB, mod uid.ID) erro
 	} else if !is {
 		return errNotMod
 	}
-	_, err := db.ExecContext(ctx, "DELETE FROM community_rules WHERE id = ?", r.ID)
-	return err
+	g, err := modOrAdminGroup(ctx, db, r.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM community_rules WHERE id = ?", r.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&r.CommunityID, mod, g, ModLogActionRuleDelete, ModLogTargetRule, strconv.FormatUint(uint64(r.ID), 10))
+		entry.Details["rule"] = r.Rule
+		return entry.insert(ctx, tx)
+	})
 }
 
 // CommunityReportsDetails holds summary information about user-reports
-// submitted in a community.
+// submitted in a community. Only open (unresolved) reports are counted.
 type CommunityReportsDetails struct {
 	NumReports        int `json:"noReports"`
 	NumPostReports    int `json:"noPostReports"`
@@ -1214,15 +1336,15 @@ type CommunityReportsDetails struct {
 }
 
 func FetchReportsDetails(ctx context.Context, db *sql.DB, community uid.ID) (d CommunityReportsDetails, err error) {
-	row := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ?", community)
+	row := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ? AND dealt_at IS NULL", community)
 	if err = row.Scan(&d.NumReports); err != nil {
 		return
 	}
-	row = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ? AND report_type = ?", community, ReportTypePost)
+	row = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ? AND report_type = ? AND dealt_at IS NULL", community, ReportTypePost)
 	if err = row.Scan(&d.NumPostReports); err != nil {
 		return
 	}
-	row = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ? AND report_type = ?", community, ReportTypeComment)
+	row = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reports WHERE community_id = ? AND report_type = ? AND dealt_at IS NULL", community, ReportTypeComment)
 	if err = row.Scan(&d.NumCommentReports); err != nil {
 		return
 	}
@@ -1431,9 +1553,18 @@ func DenyCommunityRequest(ctx context.Context, db *sql.DB, requestID int, denied
 		deniedNote = utils.TruncateUnicodeString(deniedNote, 500)
 	}
 
-	if _, err := db.ExecContext(ctx,
-		"UPDATE community_requests SET denied_note = ?, denied_by = ?, denied_at = ? WHERE id = ?",
-		deniedNote, admin.Username, time.Now(), requestID); err != nil {
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE community_requests SET denied_note = ?, denied_by = ?, denied_at = ? WHERE id = ?",
+			deniedNote, admin.Username, time.Now(), requestID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(nil, admin.ID, UserGroupAdmins, ModLogActionCommunityDeny, ModLogTargetCommunityRequest, strconv.Itoa(requestID))
+		entry.Details["communityName"] = commName
+		entry.Details["username"] = byUser
+		return entry.insert(ctx, tx)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+var errCrosspostSameCommunity = httperr.NewBadRequest("crosspost-same-community", "Cannot crosspost to the community of the original post.")
+
+// AbridgedPost is a summary of a post. It's used to refer to the original
+// post of a crosspost, and to the crossposts of a post.
+type AbridgedPost struct {
+	ID             uid.ID    `json:"id"`
+	Type           PostType  `json:"type"`
+	PublicID       string    `json:"publicId"`
+	AuthorID       uid.ID    `json:"userId"`
+	AuthorUsername string    `json:"username"`
+	AuthorGhostID  string    `json:"userGhostId,omitempty"`
+	CommunityID    uid.ID    `json:"communityId"`
+	CommunityName  string    `json:"communityName"`
+	Title          string    `json:"title"`
+	Link           *PostLink `json:"link,omitempty"`
+	Upvotes        int       `json:"upvotes"`
+	Downvotes      int       `json:"downvotes"`
+	NumComments    int       `json:"noComments"`
+	CreatedAt      time.Time `json:"createdAt"`
+	Deleted        bool      `json:"deleted"`
+}
+
+// abridged returns the summary of p.
+func (p *Post) abridged() *AbridgedPost {
+	return &AbridgedPost{
+		ID:             p.ID,
+		Type:           p.Type,
+		PublicID:       p.PublicID,
+		AuthorID:       p.AuthorID,
+		AuthorUsername: p.AuthorUsername,
+		AuthorGhostID:  p.AuthorGhostID,
+		CommunityID:    p.CommunityID,
+		CommunityName:  p.CommunityName,
+		Title:          p.Title,
+		Link:           p.Link,
+		Upvotes:        p.Upvotes,
+		Downvotes:      p.Downvotes,
+		NumComments:    p.NumComments,
+		CreatedAt:      p.CreatedAt,
+		Deleted:        p.Deleted,
+	}
+}
+
+// CreateCrosspost shares the post original in community. The crosspost is a
+// new post, with an empty body, that refers to original. If title is empty,
+// the title of original is used.
+//
+// Crossposts of crossposts refer to the original post itself.
+func CreateCrosspost(ctx context.Context, db *sql.DB, author, community, original uid.ID, title string, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
+	post, err := GetPost(ctx, db, &original, "", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := post.CheckViewable(ctx, db, &author); err != nil {
+		return nil, err
+	}
+	if id := post.crosspostSource(); id != post.ID {
+		if post, err = GetPost(ctx, db, &id, "", nil, false); err != nil {
+			return nil, err
+		}
+		if err := post.CheckViewable(ctx, db, &author); err != nil {
+			return nil, err
+		}
+	}
+	if err := post.checkCrosspostable(community); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(title) == "" {
+		title = post.Title
+	}
+	return createPost(ctx, db, &createPostOpts{
+		postType:    PostTypeText,
+		author:      author,
+		community:   community,
+		title:       title,
+		crosspostOf: &post.ID,
+
+		newUserPointsThreshold: newUserPointsThreshold,
+		newUserAgeThreshold:    newUserAgeThreshold,
+	})
+}
+
+// crosspostSource returns the ID of the post that a crosspost of p refers to,
+// which is the original post of p, if p is itself a crosspost.
+func (p *Post) crosspostSource() uid.ID {
+	if p.crosspostOf.Valid {
+		return p.crosspostOf.ID
+	}
+	return p.ID
+}
+
+// checkCrosspostable returns an error if p cannot be crossposted to community.
+func (p *Post) checkCrosspostable(community uid.ID) error {
+	if p.Pending {
+		return errPostNotFound
+	}
+	if p.CommunityID == community {
+		return errCrosspostSameCommunity
+	}
+	return nil
+}
+
+// GetCrossposts returns the crossposts of p (excluding the deleted and the
+// pending ones), oldest first.
+func (p *Post) GetCrossposts(ctx context.Context, db *sql.DB) ([]*AbridgedPost, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM posts WHERE crosspost_of = ? AND deleted = FALSE AND pending = FALSE ORDER BY id", p.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	crossposts := []*AbridgedPost{}
+	if len(ids) == 0 {
+		return crossposts, nil
+	}
+	posts, err := GetPostsByIDs(ctx, db, nil, false, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range sortPostsByIDs(posts, ids) {
+		crossposts = append(crossposts, post.abridged())
+	}
+	return crossposts, nil
+}
+
+// FetchCrossposts populates p.Crossposts.
+func (p *Post) FetchCrossposts(ctx context.Context, db *sql.DB) (err error) {
+	p.Crossposts, err = p.GetCrossposts(ctx, db)
+	return
+}
+
+// populatePostsCrosspostOf sets the CrosspostOf field of each post in posts
+// that's a crosspost.
+func populatePostsCrosspostOf(ctx context.Context, db *sql.DB, posts []*Post) error {
+	var ids []uid.ID
+	seen := make(map[uid.ID]bool)
+	for _, post := range posts {
+		if post.crosspostOf.Valid && !seen[post.crosspostOf.ID] {
+			seen[post.crosspostOf.ID] = true
+			ids = append(ids, post.crosspostOf.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// The originals are never crossposts themselves, so this doesn't recurse
+	// any further.
+	originals, err := GetPostsByIDs(ctx, db, nil, true, ids...)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		for _, original := range originals {
+			if post.crosspostOf.Valid && post.crosspostOf.ID == original.ID {
+				post.CrosspostOf = original.abridged()
+				break
+			}
+		}
+	}
+	return nil
+}
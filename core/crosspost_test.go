@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+func TestCrosspostSource(t *testing.T) {
+	original := &Post{ID: uid.New()}
+	if got := original.crosspostSource(); got != original.ID {
+		t.Errorf("crosspostSource of an original post = %v, want %v", got, original.ID)
+	}
+	crosspost := &Post{ID: uid.New(), crosspostOf: uid.NullID{Valid: true, ID: original.ID}}
+	if got := crosspost.crosspostSource(); got != original.ID {
+		t.Errorf("crosspostSource of a crosspost = %v, want the original post %v", got, original.ID)
+	}
+}
+
+func TestCheckCrosspostable(t *testing.T) {
+	community, other := uid.New(), uid.New()
+	tests := []struct {
+		post      *Post
+		community uid.ID
+		want      error
+	}{
+		{&Post{CommunityID: community}, other, nil},
+		{&Post{CommunityID: community}, community, errCrosspostSameCommunity},
+		{&Post{CommunityID: community, Pending: true}, other, errPostNotFound},
+	}
+	for i, test := range tests {
+		if got := test.post.checkCrosspostable(test.community); got != test.want {
+			t.Errorf("test %d: checkCrosspostable() = %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestCommunityAllowsPosting(t *testing.T) {
+	tests := []struct {
+		restricted, banned, modOrAdmin bool
+		wantErr                        bool
+	}{
+		{false, false, false, false},
+		{false, true, false, true},
+		{true, false, false, true},
+		{true, false, true, false},
+		{true, true, true, true},
+	}
+	for _, test := range tests {
+		comm := &Community{PostingRestricted: test.restricted}
+		err := communityAllowsPosting(comm, test.banned, test.modOrAdmin)
+		if (err != nil) != test.wantErr {
+			t.Errorf("communityAllowsPosting(restricted: %v, banned: %v, modOrAdmin: %v) = %v, want error: %v", test.restricted, test.banned, test.modOrAdmin, err, test.wantErr)
+		}
+	}
+	if err := communityAllowsPosting(&Community{}, true, false); err != errUserBannedFromCommunity {
+		t.Errorf("communityAllowsPosting of a banned user = %v, want %v", err, errUserBannedFromCommunity)
+	}
+}
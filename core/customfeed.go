@@ -0,0 +1,267 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxCustomFeedsPerUser          = 50
+	maxCommunitiesPerCustomFeed    = 100
+	maxCustomFeedNameLength        = 100 // In runes.
+	maxCustomFeedDescriptionLength = 1000
+)
+
+var (
+	errCustomFeedNotFound     = httperr.NewNotFound("custom-feed-not-found", "Custom feed not found.")
+	errNotCustomFeedOwner     = httperr.NewForbidden("not-custom-feed-owner", "Not custom feed owner.")
+	errInvalidCustomFeedName  = httperr.NewBadRequest("invalid-custom-feed-name", "Invalid custom feed name.")
+	errTooManyCustomFeeds     = httperr.NewForbidden("too-many-custom-feeds", "Maximum number of custom feeds reached.")
+	errCustomFeedCommunityMax = httperr.NewForbidden("custom-feed-full", "Maximum number of communities in custom feed reached.")
+)
+
+// CustomFeed is a user defined feed that combines the posts of a set of
+// communities. Public custom feeds can be viewed (but not edited) by anyone.
+type CustomFeed struct {
+	ID             int             `json:"id"`
+	UserID         uid.ID          `json:"userId"`
+	Username       string          `json:"username"`
+	Name           string          `json:"name"`
+	Description    msql.NullString `json:"description"`
+	Public         bool            `json:"public"`
+	NumCommunities int             `json:"numCommunities"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	LastUpdatedAt  time.Time       `json:"lastUpdatedAt"`
+
+	// Populated only by FetchCommunities.
+	Communities []*Community `json:"communities,omitempty"`
+}
+
+func getCustomFeeds(ctx context.Context, db *sql.DB, where string, args ...any) ([]*CustomFeed, error) {
+	query := msql.BuildSelectQuery("custom_feeds", []string{
+		"custom_feeds.id",
+		"custom_feeds.user_id",
+		"users.username",
+		"custom_feeds.name",
+		"custom_feeds.description",
+		"custom_feeds.public",
+		"custom_feeds.num_communities",
+		"custom_feeds.created_at",
+		"custom_feeds.last_updated_at",
+	}, []string{
+		"INNER JOIN users ON custom_feeds.user_id = users.id",
+	}, where)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feeds := []*CustomFeed{}
+	for rows.Next() {
+		feed := &CustomFeed{}
+		err := rows.Scan(
+			&feed.ID,
+			&feed.UserID,
+			&feed.Username,
+			&feed.Name,
+			&feed.Description,
+			&feed.Public,
+			&feed.NumCommunities,
+			&feed.CreatedAt,
+			&feed.LastUpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// GetCustomFeed returns the custom feed with the given id.
+func GetCustomFeed(ctx context.Context, db *sql.DB, id int) (*CustomFeed, error) {
+	feeds, err := getCustomFeeds(ctx, db, "WHERE custom_feeds.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(feeds) == 0 {
+		return nil, errCustomFeedNotFound
+	}
+	return feeds[0], nil
+}
+
+// GetUsersCustomFeeds returns all the custom feeds of user, sorted by name. If
+// publicOnly is true, only the public feeds are returned.
+func GetUsersCustomFeeds(ctx context.Context, db *sql.DB, user uid.ID, publicOnly bool) ([]*CustomFeed, error) {
+	where := "WHERE custom_feeds.user_id = ? "
+	if publicOnly {
+		where += "AND custom_feeds.public = TRUE "
+	}
+	return getCustomFeeds(ctx, db, where+"ORDER BY custom_feeds.name", user)
+}
+
+// validateCustomFeed trims and validates the name and description of a custom
+// feed.
+func validateCustomFeed(name *string, description *msql.NullString) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return errInvalidCustomFeedName
+	}
+	*name = utils.TruncateUnicodeString(*name, maxCustomFeedNameLength)
+	description.String = utils.TruncateUnicodeString(strings.TrimSpace(description.String), maxCustomFeedDescriptionLength)
+	description.Valid = description.String != ""
+	return nil
+}
+
+// CreateCustomFeed creates a new, empty, custom feed for user.
+func CreateCustomFeed(ctx context.Context, db *sql.DB, user uid.ID, name string, description msql.NullString, public bool) (*CustomFeed, error) {
+	if err := validateCustomFeed(&name, &description); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM custom_feeds WHERE user_id = ?", user).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxCustomFeedsPerUser {
+		return nil, errTooManyCustomFeeds
+	}
+
+	query, args := msql.BuildInsertQuery("custom_feeds", []msql.ColumnValue{
+		{Name: "user_id", Value: user},
+		{Name: "name", Value: name},
+		{Name: "description", Value: description},
+		{Name: "public", Value: public},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetCustomFeed(ctx, db, int(id))
+}
+
+// CanView reports whether viewer (which may be nil) can view f.
+func (f *CustomFeed) CanView(viewer *uid.ID) bool {
+	return f.Public || (viewer != nil && *viewer == f.UserID)
+}
+
+// Update updates the name, description, and visibility of f. Only the owner
+// of f can update it.
+func (f *CustomFeed) Update(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if user != f.UserID {
+		return errNotCustomFeedOwner
+	}
+	if err := validateCustomFeed(&f.Name, &f.Description); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "UPDATE custom_feeds SET name = ?, description = ?, public = ?, last_updated_at = ? WHERE id = ?",
+		f.Name, f.Description, f.Public, time.Now(), f.ID)
+	return err
+}
+
+// Delete deletes f. Only the owner of f can delete it.
+func (f *CustomFeed) Delete(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if user != f.UserID {
+		return errNotCustomFeedOwner
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM custom_feeds WHERE id = ?", f.ID)
+	return err
+}
+
+// AddCommunity adds community to f. Only the owner of f can add communities
+// to it. Adding a community that's already in f is a no-op.
+func (f *CustomFeed) AddCommunity(ctx context.Context, db *sql.DB, user, community uid.ID) error {
+	if user != f.UserID {
+		return errNotCustomFeedOwner
+	}
+	if _, err := GetCommunityByID(ctx, db, community, nil); err != nil {
+		return err
+	}
+	if f.NumCommunities >= maxCommunitiesPerCustomFeed {
+		return errCustomFeedCommunityMax
+	}
+
+	errDup := errors.New("duplicate")
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO custom_feed_communities (feed_id, community_id) VALUES (?, ?)", f.ID, community); err != nil {
+			if msql.IsErrDuplicateErr(err) {
+				return errDup
+			}
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE custom_feeds SET num_communities = num_communities + 1, last_updated_at = ? WHERE id = ?", time.Now(), f.ID)
+		return err
+	})
+	if err == errDup {
+		return nil
+	}
+	if err == nil {
+		f.NumCommunities++
+	}
+	return err
+}
+
+// RemoveCommunity removes community from f. Only the owner of f can remove
+// communities from it.
+func (f *CustomFeed) RemoveCommunity(ctx context.Context, db *sql.DB, user, community uid.ID) error {
+	if user != f.UserID {
+		return errNotCustomFeedOwner
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM custom_feed_communities WHERE feed_id = ? AND community_id = ?", f.ID, community)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE custom_feeds SET num_communities = num_communities - 1, last_updated_at = ? WHERE id = ?", time.Now(), f.ID); err != nil {
+			return err
+		}
+		f.NumCommunities--
+		return nil
+	})
+}
+
+// customFeedCommunityIDs returns the IDs of the communities in the custom feed
+// feed.
+func customFeedCommunityIDs(ctx context.Context, db *sql.DB, feed int) ([]uid.ID, error) {
+	rows, err := db.QueryContext(ctx, "SELECT community_id FROM custom_feed_communities WHERE feed_id = ?", feed)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// FetchCommunities populates f.Communities.
+func (f *CustomFeed) FetchCommunities(ctx context.Context, db *sql.DB, viewer *uid.ID) error {
+	ids, err := customFeedCommunityIDs(ctx, db, f.ID)
+	if err != nil {
+		return err
+	}
+	comms, err := GetCommunitiesByIDs(ctx, db, ids, viewer)
+	if err != nil {
+		return err
+	}
+	if comms == nil {
+		comms = []*Community{}
+	}
+	f.Communities = comms
+	return nil
+}
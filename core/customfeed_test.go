@@ -0,0 +1,45 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+func TestValidateCustomFeed(t *testing.T) {
+	name, desc := "  programming ", msql.NewNullString("  ")
+	if err := validateCustomFeed(&name, &desc); err != nil {
+		t.Fatalf("validateCustomFeed returned error: %v", err)
+	}
+	if name != "programming" {
+		t.Errorf("name not trimmed: %q", name)
+	}
+	if desc.Valid {
+		t.Errorf("blank description is valid")
+	}
+
+	name = strings.Repeat("a", maxCustomFeedNameLength+10)
+	if err := validateCustomFeed(&name, &desc); err != nil {
+		t.Fatalf("validateCustomFeed returned error: %v", err)
+	}
+	if len(name) != maxCustomFeedNameLength {
+		t.Errorf("name not truncated: got length %d", len(name))
+	}
+
+	name = " "
+	if err := validateCustomFeed(&name, &desc); err == nil {
+		t.Errorf("validateCustomFeed accepted an empty name")
+	}
+}
+
+func TestCommunitiesWhereClause(t *testing.T) {
+	where, args := communitiesWhereClause("", nil, nil)
+	if !strings.Contains(where, "community_id = ?") || len(args) != 1 {
+		t.Errorf("empty set: got %q, %v", where, args)
+	}
+	where, args = communitiesWhereClause("WHERE deleted = FALSE ", nil, []any{1, 2, 3})
+	if !strings.Contains(where, "AND community_id IN (?, ?, ?)") || len(args) != 3 {
+		t.Errorf("got %q, %v", where, args)
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// EmailTokenPurpose is what an email token, a token sent to a user's email
+// address as part of a link, is used for.
+type EmailTokenPurpose string
+
+const (
+	EmailTokenConfirmEmail  = EmailTokenPurpose("confirm_email")
+	EmailTokenResetPassword = EmailTokenPurpose("reset_password")
+)
+
+// ttl returns how long tokens of purpose p are valid for.
+func (p EmailTokenPurpose) ttl() time.Duration {
+	if p == EmailTokenResetPassword {
+		return time.Hour
+	}
+	return time.Hour * 48
+}
+
+// DigestInterval is the minimum time between two notification digest emails
+// sent to a user.
+const DigestInterval = time.Hour * 24
+
+var (
+	ErrInvalidEmailToken     = httperr.NewBadRequest("invalid-email-token", "The link is invalid or has expired.")
+	errNoEmail               = httperr.NewBadRequest("no-email", "No email address is associated with the account.")
+	errEmailAlreadyConfirmed = httperr.NewBadRequest("email-already-confirmed", "Email address already confirmed.")
+	errEmailNotConfirmed     = httperr.NewForbidden("email-not-confirmed", "Email address not confirmed.")
+)
+
+func hashEmailToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// newEmailToken creates and returns a token of purpose p for user, tied to the
+// address email. All the previous unused tokens of user of the same purpose are
+// invalidated.
+func newEmailToken(ctx context.Context, db *sql.DB, user uid.ID, p EmailTokenPurpose, email string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM email_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL", user, p); err != nil {
+			return err
+		}
+		query, args := msql.BuildInsertQuery("email_tokens", []msql.ColumnValue{
+			{Name: "user_id", Value: user},
+			{Name: "purpose", Value: p},
+			{Name: "email", Value: email},
+			{Name: "token_hash", Value: hashEmailToken(token)},
+			{Name: "expires_at", Value: time.Now().Add(p.ttl())},
+		})
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeEmailToken marks token as used, as part of tx, and returns the user
+// and the email address the token belongs to. If token is not a valid, unused,
+// unexpired token of purpose p, ErrInvalidEmailToken is returned.
+func consumeEmailToken(ctx context.Context, tx *sql.Tx, token string, p EmailTokenPurpose) (user uid.ID, email string, err error) {
+	var id int
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, email FROM email_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`, hashEmailToken(token), p, time.Now())
+	if err = row.Scan(&id, &user, &email); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrInvalidEmailToken
+		}
+		return
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE email_tokens SET used_at = ? WHERE id = ?", time.Now(), id)
+	return
+}
+
+// NewEmailConfirmationToken returns a token that confirms u's current email
+// address, once passed to ConfirmEmail.
+func (u *User) NewEmailConfirmationToken(ctx context.Context, db *sql.DB) (string, error) {
+	if u.Deleted {
+		return "", ErrUserDeleted
+	}
+	if !u.Email.Valid || u.Email.String == "" {
+		return "", errNoEmail
+	}
+	if u.EmailConfirmedAt.Valid {
+		return "", errEmailAlreadyConfirmed
+	}
+	return newEmailToken(ctx, db, u.ID, EmailTokenConfirmEmail, u.Email.String)
+}
+
+// ConfirmEmail confirms the email address that token was sent to, provided
+// that the user has not since changed their email address. It returns the
+// user whose address was confirmed.
+func ConfirmEmail(ctx context.Context, db *sql.DB, token string) (*User, error) {
+	var user uid.ID
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var (
+			email string
+			err   error
+		)
+		if user, email, err = consumeEmailToken(ctx, tx, token, EmailTokenConfirmEmail); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "UPDATE users SET email_confirmed_at = ? WHERE id = ? AND email = ? AND deleted_at IS NULL", time.Now(), user, email)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrInvalidEmailToken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, db, user, nil)
+}
+
+// GetUsersByConfirmedEmail returns the (non-deleted) users whose confirmed
+// email address is email. Email addresses are not unique, so more than one
+// user may be returned.
+func GetUsersByConfirmedEmail(ctx context.Context, db *sql.DB, email string) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, buildSelectUserQuery("WHERE users.email = ? AND users.email_confirmed_at IS NOT NULL AND users.deleted_at IS NULL"), email)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(ctx, db, rows, nil)
+	if err == errUserNotFound {
+		return nil, nil
+	}
+	return users, err
+}
+
+// NewPasswordResetToken returns a token that can be used to reset u's
+// password, by passing it to ResetPassword. Only users with a confirmed email
+// address can reset their passwords.
+func (u *User) NewPasswordResetToken(ctx context.Context, db *sql.DB) (string, error) {
+	if u.Deleted {
+		return "", ErrUserDeleted
+	}
+	if !u.Email.Valid || !u.EmailConfirmedAt.Valid {
+		return "", errEmailNotConfirmed
+	}
+	return newEmailToken(ctx, db, u.ID, EmailTokenResetPassword, u.Email.String)
+}
+
+// ResetPassword sets the password of the user that token was issued to to
+// newPassword. It returns the user whose password was reset.
+func ResetPassword(ctx context.Context, db *sql.DB, token, newPassword string) (*User, error) {
+	hash, err := HashPassword([]byte(newPassword))
+	if err != nil {
+		return nil, err
+	}
+	var user uid.ID
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		if user, _, err = consumeEmailToken(ctx, tx, token, EmailTokenResetPassword); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ? AND deleted_at IS NULL", hash, user)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrInvalidEmailToken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, db, user, nil)
+}
+
+// GetDigestRecipients returns (at most limit) users who have opted in to
+// notification digest emails, who have unseen notifications, and who have not
+// been sent a digest in the last DigestInterval.
+func GetDigestRecipients(ctx context.Context, db *sql.DB, limit int) ([]*User, error) {
+	query := buildSelectUserQuery(`
+		WHERE users.email_digest = TRUE
+		AND users.email_confirmed_at IS NOT NULL
+		AND users.deleted_at IS NULL
+		AND users.banned_at IS NULL
+		AND users.notifications_new_count > 0
+		AND (users.last_digest_at IS NULL OR users.last_digest_at < ?)
+		LIMIT ?`)
+	rows, err := db.QueryContext(ctx, query, time.Now().Add(-DigestInterval), limit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(ctx, db, rows, nil)
+	if err == errUserNotFound {
+		return nil, nil
+	}
+	return users, err
+}
+
+// GetDigestNotifications returns (at most limit of) the unseen notifications
+// of u that were updated in the last DigestInterval, rendered as plain text,
+// latest first.
+func (u *User) GetDigestNotifications(ctx context.Context, db *sql.DB, limit int) ([]*NotificationView, error) {
+	query := msql.BuildSelectQuery("notifications", selectNotificationCols, nil, "WHERE user_id = ? AND seen = FALSE AND updated_at > ? ORDER BY updated_at DESC LIMIT ?")
+	rows, err := db.QueryContext(ctx, query, u.ID, time.Now().Add(-DigestInterval), limit)
+	if err != nil {
+		return nil, err
+	}
+	notifs, err := scanNotifications(ctx, db, rows, false, "")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var views []*NotificationView
+	for _, n := range notifs {
+		view, err := n.Notif.view(ctx, db, "")
+		if err != nil {
+			// The object of the notification might have been deleted.
+			log.Printf("Error rendering notification (id: %v) for digest: %v\n", n.ID, err)
+			continue
+		}
+		view.ID = n.ID
+		view.Type = n.Type
+		view.CreatedAt = n.CreatedAt
+		view.UpdatedAt = n.updatedAt
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// SetDigestSent records that a notification digest email was sent to u.
+func (u *User) SetDigestSent(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "UPDATE users SET last_digest_at = ? WHERE id = ?", time.Now(), u.ID)
+	return err
+}
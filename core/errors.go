@@ -32,6 +32,7 @@ var (
 
 	errPostNotFound        = httperr.NewNotFound("post/not-found", "Post(s) not found.")
 	errPostLocked          = httperr.NewForbidden("post-locked", "Post is locked.")
+	errPostDeleted         = httperr.NewForbidden("post-deleted", "Post is deleted.")
 	errPostTypeUnsupported = httperr.NewBadRequest("post-type/unsupported", "Unsupported post type.")
 
 	errInvalidUserGroup = httperr.NewBadRequest("user/invalid-group", "Invalid user-group.")
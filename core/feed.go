@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +27,12 @@ const (
 	FeedSortTopMonth
 	FeedSortTopYear
 	FeedSortTopAll
+	FeedSortRising
+	FeedSortControversialDay
+	FeedSortControversialWeek
+	FeedSortControversialMonth
+	FeedSortControversialYear
+	FeedSortControversialAll
 )
 
 // Valid reports whether f is a valid FeedSort.
@@ -53,6 +60,18 @@ func (s FeedSort) MarshalText() ([]byte, error) {
 		return []byte("hot"), nil
 	case FeedSortActivity:
 		return []byte("activity"), nil
+	case FeedSortRising:
+		return []byte("rising"), nil
+	case FeedSortControversialDay:
+		return []byte("controversial-day"), nil
+	case FeedSortControversialWeek:
+		return []byte("controversial-week"), nil
+	case FeedSortControversialMonth:
+		return []byte("controversial-month"), nil
+	case FeedSortControversialYear:
+		return []byte("controversial-year"), nil
+	case FeedSortControversialAll:
+		return []byte("controversial-all"), nil
 	}
 	return nil, fmt.Errorf("cannot marshal unsupported FeedSort (%v)", int(s))
 }
@@ -81,12 +100,48 @@ func (s *FeedSort) UnmarshalText(text []byte) error {
 		*s = FeedSortHot
 	case "activity":
 		*s = FeedSortActivity
+	case "rising":
+		*s = FeedSortRising
+	case "controversial-day":
+		*s = FeedSortControversialDay
+	case "controversial-week":
+		*s = FeedSortControversialWeek
+	case "controversial-month":
+		*s = FeedSortControversialMonth
+	case "controversial-year":
+		*s = FeedSortControversialYear
+	case "controversial-all":
+		*s = FeedSortControversialAll
 	default:
 		return fmt.Errorf("cannot unmarshal unsupported FeedSort: %v", t)
 	}
 	return nil
 }
 
+// controversial reports whether s is one of the controversial sorts.
+func (s FeedSort) controversial() bool {
+	switch s {
+	case FeedSortControversialDay, FeedSortControversialWeek, FeedSortControversialMonth, FeedSortControversialYear, FeedSortControversialAll:
+		return true
+	}
+	return false
+}
+
+// column returns the column of the posts table (and of the posts_today, etc,
+// tables, for the sorts with a time window) by which posts are sorted, in
+// descending order, for the top, hot, rising, and controversial sorts.
+func (s FeedSort) column() string {
+	switch {
+	case s == FeedSortHot:
+		return "hotness"
+	case s == FeedSortRising:
+		return "rising"
+	case s.controversial():
+		return "controversy"
+	}
+	return "points"
+}
+
 type FeedType int
 
 const (
@@ -95,6 +150,7 @@ const (
 	FeedTypeModerating
 	FeedTypeCommunity
 	FeedTypeUser
+	FeedTypeCustom
 )
 
 func (ft FeedType) Valid() bool {
@@ -123,6 +179,8 @@ func (ft FeedType) MarshalText() ([]byte, error) {
 		return []byte("community"), nil
 	case FeedTypeUser:
 		return []byte("user"), nil
+	case FeedTypeCustom:
+		return []byte("custom"), nil
 	}
 	return nil, fmt.Errorf("cannot marshal unsupported FeedType (%v)", int(ft))
 }
@@ -144,6 +202,8 @@ func (ft *FeedType) UnmarshalText(text []byte) error {
 		*ft = FeedTypeCommunity
 	case "user":
 		*ft = FeedTypeUser
+	case "custom":
+		*ft = FeedTypeCustom
 	default:
 		return fmt.Errorf("cannot unmarshal text unsupported text: %v", string(text))
 	}
@@ -171,6 +231,10 @@ func newFeedResultSet(posts []*Post, limit int, sort FeedSort) *FeedResultSet {
 			nextnext = strconv.Itoa(posts[limit].Hotness) + "." + posts[limit].ID.String()
 		case FeedSortActivity:
 			nextnext = posts[limit].LastActivityAt.UnixNano()
+		case FeedSortRising:
+			nextnext = strconv.Itoa(posts[limit].rising) + "." + posts[limit].ID.String()
+		case FeedSortControversialAll, FeedSortControversialYear, FeedSortControversialMonth, FeedSortControversialWeek, FeedSortControversialDay:
+			nextnext = strconv.Itoa(posts[limit].controversy) + "." + posts[limit].ID.String()
 		default:
 			// Shouldn't happen, ever.
 			panic("invalid feed sort")
@@ -219,23 +283,44 @@ func homeFeedWhereClause(ctx context.Context, db *sql.DB, user uid.ID, where str
 		return where, args, err
 	}
 
+	where, args = communitiesWhereClause(where, args, communityIDs)
+	return where, args, nil
+}
+
+// communitiesWhereClause appends to where a condition that limits the posts to
+// those in communityIDs.
+func communitiesWhereClause(where string, args []any, communityIDs []any) (string, []any) {
 	joiner := ""
 	if where != "" {
 		joiner = "AND"
 	}
 
 	if len(communityIDs) == 0 {
-		// User is not subscribed to any communities. Use the sentinel value of
-		// zero-bytes community ID, which no community would have, to return an
-		// empty result set.
+		// There are no communities. Use the sentinel value of zero-bytes
+		// community ID, which no community would have, to return an empty
+		// result set.
 		where = fmt.Sprintf("%s %s community_id = ? ", where, joiner)
 		args = append(args, uid.ID{})
-		return where, args, nil
+		return where, args
 	}
 
 	where = fmt.Sprintf("%s %s community_id IN %s ", where, joiner, msql.InClauseQuestionMarks(len(communityIDs)))
 	args = append(args, communityIDs...)
+	return where, args
+}
 
+// customFeedWhereClause limits the posts to those in the communities of the
+// custom feed feed.
+func customFeedWhereClause(ctx context.Context, db *sql.DB, feed int, where string, args []any) (string, []any, error) {
+	ids, err := customFeedCommunityIDs(ctx, db, feed)
+	if err != nil {
+		return where, args, err
+	}
+	communityIDs := make([]any, len(ids))
+	for i := range ids {
+		communityIDs[i] = ids[i]
+	}
+	where, args = communitiesWhereClause(where, args, communityIDs)
 	return where, args, nil
 }
 
@@ -259,23 +344,7 @@ func moderatingFeedWhereClause(ctx context.Context, db *sql.DB, user uid.ID, whe
 		return where, args, err
 	}
 
-	joiner := ""
-	if where != "" {
-		joiner = "AND"
-	}
-
-	if len(communityIDs) == 0 {
-		// User is not subscribed to any communities. Use the sentinel value of
-		// zero-bytes community ID, which no community would have, to return an
-		// empty result set.
-		where = fmt.Sprintf("%s %s community_id = ? ", where, joiner)
-		args = append(args, uid.ID{})
-		return where, args, nil
-	}
-
-	where = fmt.Sprintf("%s %s community_id IN %s ", where, joiner, msql.InClauseQuestionMarks(len(communityIDs)))
-	args = append(args, communityIDs...)
-
+	where, args = communitiesWhereClause(where, args, communityIDs)
 	return where, args, nil
 }
 
@@ -285,7 +354,9 @@ type FeedOptions struct {
 	DefaultSort bool
 	Viewer      *uid.ID
 	Community   *uid.ID // Community should be nil if Homefeed is true.
+	CustomFeed  *int    // The ID of the custom feed, only for FeedTypeCustom.
 	// Homefeed    bool    // If true, the requested feed is the feed with only posts from communities where the user is a member
+	Flair *int // If not nil, only posts with this flair are returned (only for community feeds).
 	Limit int
 	Next  string // The pagination cursor, taken from previous API response.
 }
@@ -330,27 +401,67 @@ func GetFeed(ctx context.Context, db *sql.DB, opts *FeedOptions) (_ *FeedResultS
 	if !opts.Sort.Valid() {
 		return nil, ErrInvalidFeedSort
 	}
-	var set *FeedResultSet
-	switch opts.Sort {
-	case FeedSortLatest:
-		set, err = getPostsLatest(ctx, db, opts)
-	case FeedSortHot:
-		set, err = getPostsHot(ctx, db, opts)
-	case FeedSortActivity:
-		set, err = getPostsActivity(ctx, db, opts)
-	default:
-		set, err = getPostsTop(ctx, db, opts)
+	if opts.Feed == FeedTypeCustom && opts.CustomFeed == nil {
+		return nil, errCustomFeedNotFound
 	}
+	set, err := getFeedPage(ctx, db, opts)
 	if err != nil {
 		return nil, err
 	}
-	if opts.DefaultSort {
+	if opts.Viewer != nil && opts.Feed != FeedTypeModerating {
+		if set, err = filterMutedKeywordsFromFeed(ctx, db, opts, set); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DefaultSort && opts.Flair == nil {
 		// Merge pinned posts.
 		return mergePinnedPosts(ctx, db, opts.Viewer, opts.Community, opts.Next, set)
 	}
 	return set, err
 }
 
+func getFeedPage(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
+	switch opts.Sort {
+	case FeedSortLatest:
+		return getPostsLatest(ctx, db, opts)
+	case FeedSortHot, FeedSortRising:
+		return getPostsHot(ctx, db, opts)
+	case FeedSortActivity:
+		return getPostsActivity(ctx, db, opts)
+	default:
+		return getPostsTop(ctx, db, opts)
+	}
+}
+
+// maxMutedFeedFetches is the maximum number of pages of a feed that are
+// fetched, for a single page, to make up for the posts removed because they
+// contain a keyword muted by the viewer.
+const maxMutedFeedFetches = 5
+
+// filterMutedKeywordsFromFeed removes the posts of set (a page of the feed of
+// opts) that contain a keyword muted by opts.Viewer, fetching the following
+// pages, if need be, to fill in for them.
+func filterMutedKeywordsFromFeed(ctx context.Context, db *sql.DB, opts *FeedOptions, set *FeedResultSet) (*FeedResultSet, error) {
+	re, err := mutedKeywordsCache.get(ctx, db, *opts.Viewer)
+	if err != nil || re == nil {
+		return set, err
+	}
+
+	o := *opts
+	posts := filterMutedPosts(set.Posts, re)
+	for i := 1; len(posts) <= o.Limit && set.Next != nil && i < maxMutedFeedFetches; i++ {
+		o.Next = fmt.Sprint(set.Next)
+		if set, err = getFeedPage(ctx, db, &o); err != nil {
+			return nil, err
+		}
+		posts = append(posts, filterMutedPosts(set.Posts, re)...)
+	}
+	if len(posts) > o.Limit {
+		return newFeedResultSet(posts, o.Limit, o.Sort), nil
+	}
+	return &FeedResultSet{Posts: posts, Next: set.Next}, nil
+}
+
 // getPostsLatest returns site wide latest posts, if opts.Community is nil, or
 // latest posts in opts.Community, if not.
 func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
@@ -360,7 +471,7 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 	if loggedIn {
 		args = append(args, opts.Viewer, opts.Viewer)
 	}
-	where := "WHERE posts.deleted = FALSE "
+	where := "WHERE posts.deleted = FALSE AND posts.pending = FALSE "
 	switch opts.Feed {
 	case FeedTypeAll:
 	case FeedTypeSubscriptions:
@@ -375,9 +486,19 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		if err != nil {
 			return nil, err
 		}
+	case FeedTypeCustom:
+		var err error
+		where, args, err = customFeedWhereClause(ctx, db, *opts.CustomFeed, where, args)
+		if err != nil {
+			return nil, err
+		}
 	case FeedTypeCommunity:
 		where += "AND community_id = ? "
 		args = append(args, *opts.Community)
+		if opts.Flair != nil {
+			where += "AND posts.flair_id = ? "
+			args = append(args, *opts.Flair)
+		}
 	}
 	if loggedIn && opts.Feed != FeedTypeModerating {
 		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Feed == FeedTypeAll)
@@ -413,13 +534,13 @@ func getPostsLatest(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 
 func sortFeedToTable(s FeedSort) string {
 	switch s {
-	case FeedSortTopDay:
+	case FeedSortTopDay, FeedSortControversialDay:
 		return "posts_today"
-	case FeedSortTopWeek:
+	case FeedSortTopWeek, FeedSortControversialWeek:
 		return "posts_week"
-	case FeedSortTopMonth:
+	case FeedSortTopMonth, FeedSortControversialMonth:
 		return "posts_month"
-	case FeedSortTopYear:
+	case FeedSortTopYear, FeedSortControversialYear:
 		return "posts_year"
 	default:
 		panic(fmt.Sprintf("cannot convert FeedSort (%v) to string", s))
@@ -489,11 +610,34 @@ func whereMutedAndHidden(where, postsTable string, args []any, viewer uid.ID, mu
 	where += fmt.Sprintf(" AND %s.%s NOT IN (SELECT post_id FROM hidden_posts WHERE user_id = ?) ", postsTable, colName)
 	args = append(args, viewer)
 
-	return where, args
+	return whereMutedDomains(where, postsTable, args, viewer)
 }
 
-// getPostsHot returns site wide hot posts, if opts.Community is nil, or hot
-// posts in opts.Community, if not.
+// mutedDomains is an SQL subquery of the domains muted by a user (the only
+// argument).
+const mutedDomains = "(SELECT domain FROM muted_domains WHERE user_id = ?)"
+
+// whereMutedDomains filters out the link posts to domains muted by viewer. The
+// argument table is either posts, or one of the posts_today, posts_week, etc,
+// tables. (Posts with muted keywords are filtered out after they are fetched;
+// see GetFeed.)
+func whereMutedDomains(where, table string, args []any, viewer uid.ID) (string, []any) {
+	if !(where == "" || strings.TrimSpace(strings.ToUpper(where)) == "WHERE") {
+		where += "AND "
+	}
+	if table == "posts" {
+		where += "(posts.link_domain IS NULL OR posts.link_domain NOT IN " + mutedDomains + ") "
+	} else {
+		// The tables posts_today, etc, don't have the domains of the posts.
+		// Look them up by primary key.
+		where += fmt.Sprintf("NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = %s.post_id AND posts.link_domain IN %s) ", table, mutedDomains)
+	}
+	return where, append(args, viewer)
+}
+
+// getPostsHot returns site wide hot (or rising, if opts.Sort is FeedSortRising)
+// posts, if opts.Community is nil, or hot (or rising) posts in opts.Community,
+// if not.
 func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
 	var args []any
 	loggedIn := opts.Viewer != nil
@@ -501,7 +645,7 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	if loggedIn {
 		args = append(args, opts.Viewer, opts.Viewer)
 	}
-	where := "WHERE posts.deleted = FALSE "
+	where := "WHERE posts.deleted = FALSE AND posts.pending = FALSE "
 	switch opts.Feed {
 	case FeedTypeAll:
 	case FeedTypeSubscriptions:
@@ -516,24 +660,39 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		if err != nil {
 			return nil, err
 		}
+	case FeedTypeCustom:
+		var err error
+		where, args, err = customFeedWhereClause(ctx, db, *opts.CustomFeed, where, args)
+		if err != nil {
+			return nil, err
+		}
 	case FeedTypeCommunity:
 		where += "AND community_id = ? "
 		args = append(args, *opts.Community)
+		if opts.Flair != nil {
+			where += "AND posts.flair_id = ? "
+			args = append(args, *opts.Flair)
+		}
 
 	}
 	if loggedIn && opts.Feed != FeedTypeModerating {
 		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Feed == FeedTypeAll)
 	}
+	column := "posts." + opts.Sort.column()
+	if opts.Sort == FeedSortRising {
+		// Posts that are not rising at all are not included.
+		where += "AND posts.rising > 0 "
+	}
 	if opts.Next != "" {
 		nextHotness, nextID, err := opts.nextPointsID()
 		if err != nil {
 			return nil, err
 		}
-		where += "AND (posts.hotness, posts.id) <= (?, ?) "
+		where += "AND (" + column + ", posts.id) <= (?, ?) "
 		args = append(args, nextHotness)
 		args = append(args, nextID)
 	}
-	where += "ORDER BY posts.hotness DESC, posts.id DESC LIMIT ?"
+	where += "ORDER BY " + column + " DESC, posts.id DESC LIMIT ?"
 	query := buildSelectPostQuery(loggedIn, where)
 
 	var rows *sql.Rows
@@ -551,11 +710,12 @@ func getPostsHot(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		}
 		return nil, err
 	}
-	return newFeedResultSet(posts, opts.Limit, FeedSortHot), nil
+	return newFeedResultSet(posts, opts.Limit, opts.Sort), nil
 }
 
-// getPostsTopAll returns site wide all time top posts, if opts.Community is
-// nil, or all time top posts in opts.Community, if not.
+// getPostsTopAll returns site wide all time top (or controversial) posts, if
+// opts.Community is nil, or all time top (or controversial) posts in
+// opts.Community, if not.
 func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
 	loggedIn := opts.Viewer != nil
 	var args []any
@@ -563,7 +723,7 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		args = append(args, *opts.Viewer, *opts.Viewer)
 	}
 
-	where := "WHERE deleted = FALSE "
+	where := "WHERE deleted = FALSE AND pending = FALSE "
 	switch opts.Feed {
 	case FeedTypeAll:
 	case FeedTypeSubscriptions:
@@ -578,24 +738,35 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		if err != nil {
 			return nil, err
 		}
+	case FeedTypeCustom:
+		var err error
+		where, args, err = customFeedWhereClause(ctx, db, *opts.CustomFeed, where, args)
+		if err != nil {
+			return nil, err
+		}
 	case FeedTypeCommunity:
 		where += "AND community_id = ? "
 		args = append(args, *opts.Community)
+		if opts.Flair != nil {
+			where += "AND posts.flair_id = ? "
+			args = append(args, *opts.Flair)
+		}
 
 	}
 	if loggedIn && opts.Feed != FeedTypeModerating {
 		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, opts.Feed == FeedTypeAll)
 	}
+	column := "posts." + opts.Sort.column()
 	if opts.Next != "" {
 		nextPoints, nextID, err := opts.nextPointsID()
 		if err != nil {
 			return nil, err
 		}
-		where += "AND (posts.points, posts.id) <= (?, ?) "
+		where += "AND (" + column + ", posts.id) <= (?, ?) "
 		args = append(args, nextPoints)
 		args = append(args, nextID)
 	}
-	where += "ORDER BY posts.points DESC, posts.id DESC LIMIT ?"
+	where += "ORDER BY " + column + " DESC, posts.id DESC LIMIT ?"
 	args = append(args, opts.Limit+1)
 	query := buildSelectPostQuery(loggedIn, where)
 
@@ -611,17 +782,18 @@ func getPostsTopAll(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedRe
 		}
 		return nil, err
 	}
-	return newFeedResultSet(posts, opts.Limit, FeedSortTopAll), nil
+	return newFeedResultSet(posts, opts.Limit, opts.Sort), nil
 }
 
-// getPostsTop returns site wide top posts (daily, weekly, etc), if
-// opts.Community is nil, or top posts (daily, weekly, etc) in opts.Community,
-// if not.
+// getPostsTop returns site wide top (or controversial) posts (daily, weekly,
+// etc), if opts.Community is nil, or top (or controversial) posts (daily,
+// weekly, etc) in opts.Community, if not.
 func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResultSet, error) {
-	if opts.Sort == FeedSortTopAll {
+	if opts.Sort == FeedSortTopAll || opts.Sort == FeedSortControversialAll {
 		return getPostsTopAll(ctx, db, opts)
 	}
 	table := sortFeedToTable(opts.Sort)
+	column := opts.Sort.column()
 
 	var args []any
 	query := fmt.Sprintf("SELECT post_id FROM %s ", table)
@@ -640,11 +812,26 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		if err != nil {
 			return nil, err
 		}
+	case FeedTypeCustom:
+		var err error
+		where, args, err = customFeedWhereClause(ctx, db, *opts.CustomFeed, where, args)
+		if err != nil {
+			return nil, err
+		}
 	case FeedTypeCommunity:
-		where += "AND community_id = ? "
+		where += "community_id = ? "
 		args = append(args, *opts.Community)
+		if opts.Flair != nil {
+			where += "AND post_id IN (SELECT id FROM posts WHERE flair_id = ?) "
+			args = append(args, *opts.Flair)
+		}
 
 	}
+	// The posts held for approval are in the posts_* tables too.
+	if where != "" {
+		where += "AND "
+	}
+	where += "NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = " + table + ".post_id AND posts.pending = TRUE) "
 	if opts.Viewer != nil && opts.Feed != FeedTypeModerating {
 		where, args = whereMutedAndHidden(where, table, args, *opts.Viewer, opts.Feed == FeedTypeAll)
 	}
@@ -656,14 +843,14 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 		if where != "" {
 			where += " AND "
 		}
-		where += "(points, id) <= (?, ?) "
+		where += "(" + column + ", post_id) <= (?, ?) "
 		args = append(args, nextPoints)
 		args = append(args, nextID)
 	}
 	if where != "" {
 		where = "WHERE " + where
 	}
-	query += where + "ORDER BY points DESC, post_id DESC LIMIT ?"
+	query += where + "ORDER BY " + column + " DESC, post_id DESC LIMIT ?"
 	args = append(args, opts.Limit+1)
 
 	rows, err := db.QueryContext(ctx, query, args...)
@@ -684,7 +871,7 @@ func getPostsTop(ctx context.Context, db *sql.DB, opts *FeedOptions) (*FeedResul
 	if err != nil {
 		return nil, err
 	}
-	return newFeedResultSet(posts, opts.Limit, opts.Sort), nil
+	return newFeedResultSet(sortPostsByIDs(posts, ids), opts.Limit, opts.Sort), nil
 }
 
 // getPostsActivity returns site wide posts sorted by activity, if
@@ -696,7 +883,7 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 	if loggedIn {
 		args = append(args, opts.Viewer, opts.Viewer)
 	}
-	where := "WHERE posts.deleted = FALSE "
+	where := "WHERE posts.deleted = FALSE AND posts.pending = FALSE "
 	switch opts.Feed {
 	case FeedTypeAll:
 	case FeedTypeSubscriptions:
@@ -711,9 +898,19 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 		if err != nil {
 			return nil, err
 		}
+	case FeedTypeCustom:
+		var err error
+		where, args, err = customFeedWhereClause(ctx, db, *opts.CustomFeed, where, args)
+		if err != nil {
+			return nil, err
+		}
 	case FeedTypeCommunity:
 		where += "AND community_id = ? "
 		args = append(args, *opts.Community)
+		if opts.Flair != nil {
+			where += "AND posts.flair_id = ? "
+			args = append(args, *opts.Flair)
+		}
 
 	}
 	if loggedIn && opts.Feed != FeedTypeModerating {
@@ -750,6 +947,19 @@ func getPostsActivity(ctx context.Context, db *sql.DB, opts *FeedOptions) (*Feed
 	return newFeedResultSet(posts, opts.Limit, FeedSortActivity), nil
 }
 
+// sortPostsByIDs sorts posts in the order of ids, which contains the IDs of
+// all the posts.
+func sortPostsByIDs(posts []*Post, ids []uid.ID) []*Post {
+	index := make(map[uid.ID]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return index[posts[i].ID] < index[posts[j].ID]
+	})
+	return posts
+}
+
 // getPostsList returns a slice of posts that are ordered by points.
 func getPostsList(ctx context.Context, db *sql.DB, viewer *uid.ID, ids ...uid.ID) ([]*Post, error) {
 	loggedIn := viewer != nil
@@ -846,13 +1056,15 @@ func GetUserFeed(ctx context.Context, db *sql.DB, viewer *uid.ID, userID uid.ID,
 		args = append(args, t)
 	}
 
-	// Show posts and comments deleted by someone other than their author to
-	// admins. If the viewer is not an admin, hide them entirely (even if the
-	// comment content is purged).
+	// Show posts and comments deleted by someone other than their author, and
+	// the ones held for approval, to admins. If the viewer is not an admin,
+	// hide them entirely (even if the comment content is purged).
 	if is, err := IsAdmin(db, viewer); err != nil {
 		return nil, err
 	} else if !is {
 		query += "AND deleted = false "
+		query += "AND NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = posts_comments.target_id AND posts.pending = TRUE) "
+		query += "AND NOT EXISTS (SELECT 1 FROM comments WHERE comments.id = posts_comments.target_id AND comments.pending = TRUE) "
 	}
 
 	if next != nil {
@@ -0,0 +1,19 @@
+package core
+
+import "testing"
+
+func TestFeedSortText(t *testing.T) {
+	for s := FeedSortHot; s <= FeedSortControversialAll; s++ {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatalf("FeedSort(%d).MarshalText() error: %v", int(s), err)
+		}
+		var got FeedSort
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) error: %v", text, err)
+		}
+		if got != s {
+			t.Errorf("UnmarshalText(%q) = %d, want %d", text, int(got), int(s))
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	maxFlairsPerCommunity = 50
+	maxFlairNameLength    = 64 // In runes.
+)
+
+var (
+	errFlairNotFound     = httperr.NewNotFound("flair-not-found", "Flair not found.")
+	errFlairExists       = httperr.NewBadRequest("flair-exists", "A flair with that name already exists.")
+	errTooManyFlairs     = httperr.NewForbidden("too-many-flairs", "Maximum number of flairs reached.")
+	errFlairModOnly      = httperr.NewForbidden("flair-mod-only", "Only moderators can assign this flair.")
+	errInvalidFlairName  = httperr.NewBadRequest("invalid-flair-name", "Invalid flair name.")
+	errInvalidFlairColor = httperr.NewBadRequest("invalid-flair-color", "Invalid flair color.")
+)
+
+// Flair is a label, defined by the mods of a community, that can be assigned
+// to the posts of the community.
+type Flair struct {
+	ID          int        `json:"id"`
+	CommunityID uid.ID     `json:"communityId"`
+	Name        string     `json:"name"`
+	Color       images.RGB `json:"color"`
+
+	// If true, only the mods (and admins) may assign the flair to posts.
+	// Otherwise, the authors of posts may also assign it to their posts.
+	ModOnly bool `json:"modOnly"`
+
+	ZIndex    int       `json:"zIndex"`
+	CreatedBy uid.ID    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FlairOpts are the user editable fields of a Flair.
+type FlairOpts struct {
+	Name    string     `json:"name"`
+	Color   images.RGB `json:"color"`
+	ModOnly bool       `json:"modOnly"`
+	ZIndex  int        `json:"zIndex"`
+}
+
+func (opts *FlairOpts) validate() error {
+	opts.Name = strings.TrimSpace(opts.Name)
+	if opts.Name == "" || utf8.RuneCountInString(opts.Name) > maxFlairNameLength {
+		return errInvalidFlairName
+	}
+	if opts.Color.Red > 255 || opts.Color.Green > 255 || opts.Color.Blue > 255 {
+		return errInvalidFlairColor
+	}
+	return nil
+}
+
+var selectFlairCols = []string{
+	"community_flairs.id",
+	"community_flairs.community_id",
+	"community_flairs.name",
+	"community_flairs.color",
+	"community_flairs.mod_only",
+	"community_flairs.z_index",
+	"community_flairs.created_by",
+	"community_flairs.created_at",
+}
+
+func getFlairs(ctx context.Context, db *sql.DB, where string, args ...any) ([]*Flair, error) {
+	query := msql.BuildSelectQuery("community_flairs", selectFlairCols, nil, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flairs := []*Flair{}
+	for rows.Next() {
+		f := &Flair{}
+		err := rows.Scan(
+			&f.ID,
+			&f.CommunityID,
+			&f.Name,
+			&f.Color,
+			&f.ModOnly,
+			&f.ZIndex,
+			&f.CreatedBy,
+			&f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		flairs = append(flairs, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return flairs, nil
+}
+
+// GetFlair returns the flair of community with the given id.
+func GetFlair(ctx context.Context, db *sql.DB, community uid.ID, id int) (*Flair, error) {
+	flairs, err := getFlairs(ctx, db, "WHERE community_flairs.id = ? AND community_flairs.community_id = ?", id, community)
+	if err != nil {
+		return nil, err
+	}
+	if len(flairs) == 0 {
+		return nil, errFlairNotFound
+	}
+	return flairs[0], nil
+}
+
+// GetFlairs returns all the flairs of community.
+func GetFlairs(ctx context.Context, db *sql.DB, community uid.ID) ([]*Flair, error) {
+	return getFlairs(ctx, db, "WHERE community_flairs.community_id = ? ORDER BY community_flairs.z_index, community_flairs.id", community)
+}
+
+// CreateFlair adds a flair to community. Only mods and admins can create
+// flairs.
+func (c *Community) CreateFlair(ctx context.Context, db *sql.DB, mod uid.ID, opts *FlairOpts) (*Flair, error) {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_flairs WHERE community_id = ?", c.ID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxFlairsPerCommunity {
+		return nil, errTooManyFlairs
+	}
+
+	query, args := msql.BuildInsertQuery("community_flairs", []msql.ColumnValue{
+		{Name: "community_id", Value: c.ID},
+		{Name: "name", Value: opts.Name},
+		{Name: "color", Value: opts.Color},
+		{Name: "mod_only", Value: opts.ModOnly},
+		{Name: "z_index", Value: opts.ZIndex},
+		{Name: "created_by", Value: mod},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return nil, errFlairExists
+		}
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetFlair(ctx, db, c.ID, int(id))
+}
+
+// Update replaces the user editable fields of f with opts. Only mods and
+// admins can update flairs.
+func (f *Flair) Update(ctx context.Context, db *sql.DB, mod uid.ID, opts *FlairOpts) error {
+	if is, err := UserModOrAdmin(ctx, db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "UPDATE community_flairs SET name = ?, color = ?, mod_only = ?, z_index = ? WHERE id = ?",
+		opts.Name, opts.Color, opts.ModOnly, opts.ZIndex, f.ID)
+	if err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return errFlairExists
+		}
+		return err
+	}
+	f.Name, f.Color, f.ModOnly, f.ZIndex = opts.Name, opts.Color, opts.ModOnly, opts.ZIndex
+	return nil
+}
+
+// Delete deletes f. The posts with the flair are left without one. Only mods
+// and admins can delete flairs.
+func (f *Flair) Delete(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if is, err := UserModOrAdmin(ctx, db, f.CommunityID, mod); err != nil {
+		return err
+	} else if !is {
+		return errNotMod
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM community_flairs WHERE id = ?", f.ID)
+	return err
+}
+
+// SetFlair assigns the flair with the given id to p, or removes the flair of p
+// if flairID is nil. The author of p can assign any flair of the community
+// that's not mod-only, and the mods (and admins) can assign any flair.
+func (p *Post) SetFlair(ctx context.Context, db *sql.DB, user uid.ID, flairID *int) error {
+	if p.Deleted {
+		return errPostDeleted
+	}
+	isMod, err := UserModOrAdmin(ctx, db, p.CommunityID, user)
+	if err != nil {
+		return err
+	}
+	if !isMod && p.AuthorID != user {
+		return errNotMod
+	}
+
+	var flair *Flair
+	if flairID != nil {
+		if flair, err = GetFlair(ctx, db, p.CommunityID, *flairID); err != nil {
+			return err
+		}
+		if flair.ModOnly && !isMod {
+			return errFlairModOnly
+		}
+	} else if p.Flair != nil && p.Flair.ModOnly && !isMod {
+		// Authors cannot remove flairs set by the mods.
+		return errFlairModOnly
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE posts SET flair_id = ? WHERE id = ?", flairID, p.ID); err != nil {
+		return err
+	}
+	p.Flair = flair
+	if flairID != nil {
+		p.flairID = msql.NewNullInt32(*flairID)
+	} else {
+		p.flairID = msql.NullInt32{}
+	}
+	return nil
+}
+
+// populatePostsFlairs sets the Flair field of each post in posts that has a
+// flair.
+func populatePostsFlairs(ctx context.Context, db *sql.DB, posts []*Post) error {
+	var ids []any
+	seen := make(map[int32]bool)
+	for _, post := range posts {
+		if post.flairID.Valid && !seen[post.flairID.Int32] {
+			seen[post.flairID.Int32] = true
+			ids = append(ids, post.flairID.Int32)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	flairs, err := getFlairs(ctx, db, "WHERE community_flairs.id IN "+msql.InClauseQuestionMarks(len(ids)), ids...)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		for _, flair := range flairs {
+			if post.flairID.Valid && int(post.flairID.Int32) == flair.ID {
+				post.Flair = flair
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/discuitnet/discuit/internal/images"
+)
+
+func TestFlairOptsValidate(t *testing.T) {
+	cases := []struct {
+		opts FlairOpts
+		ok   bool
+	}{
+		{FlairOpts{Name: "Discussion", Color: images.RGB{Red: 255, Green: 128}}, true},
+		{FlairOpts{Name: "  Meta  "}, true},
+		{FlairOpts{Name: strings.Repeat("é", maxFlairNameLength)}, true},
+		{FlairOpts{Name: strings.Repeat("é", maxFlairNameLength+1)}, false},
+		{FlairOpts{Name: "   "}, false},
+		{FlairOpts{Name: "News", Color: images.RGB{Blue: 256}}, false},
+	}
+	for _, item := range cases {
+		opts := item.opts
+		if err := opts.validate(); (err == nil) != item.ok {
+			t.Errorf("validate(%+v) = %v, want ok: %v", item.opts, err, item.ok)
+		}
+	}
+
+	opts := FlairOpts{Name: "  Meta  "}
+	opts.validate()
+	if opts.Name != "Meta" {
+		t.Errorf("validate did not trim the name: %q", opts.Name)
+	}
+}
@@ -0,0 +1,591 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+// maxMessageLength is the maximum length, in unicode characters, of the body
+// of a private message.
+const maxMessageLength = 10000
+
+var (
+	errConversationNotFound  = httperr.NewNotFound("conversation-not-found", "Conversation not found.")
+	errMessageNotFound       = httperr.NewNotFound("message-not-found", "Message not found.")
+	errMessageReportNotFound = httperr.NewNotFound("message-report-not-found", "Message report not found.")
+	errMessageEmpty          = httperr.NewBadRequest("message-empty", "Message is empty.")
+	errMessageSelf           = httperr.NewBadRequest("message-self", "You cannot message yourself.")
+	errMessagingBlocked      = httperr.NewForbidden("messaging-blocked", "You cannot message this user.")
+	errMessageDeleted        = httperr.NewForbidden("message-deleted", "Message is deleted.")
+)
+
+// Conversation is a private conversation between two users. Its fields are as
+// seen by one of the two users (the viewer).
+type Conversation struct {
+	ID            uid.ID     `json:"id"`
+	User1ID       uid.ID     `json:"-"` // Always less than User2ID.
+	User2ID       uid.ID     `json:"-"`
+	LastMessageID uid.NullID `json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+
+	viewer uid.ID
+
+	// The other participant of the conversation (other than the viewer).
+	OtherUser *User `json:"otherUser"`
+
+	// LastMessage is nil if the conversation has no messages yet.
+	LastMessage *Message `json:"lastMessage"`
+
+	// NumUnread is the number of messages sent to the viewer that the viewer
+	// has not yet read.
+	NumUnread int `json:"noUnread"`
+}
+
+// OtherUserID returns the ID of the participant of c other than the viewer.
+func (c *Conversation) OtherUserID() uid.ID {
+	if c.User1ID == c.viewer {
+		return c.User2ID
+	}
+	return c.User1ID
+}
+
+// Message is a private message.
+type Message struct {
+	ID             uid.ID        `json:"id"`
+	ConversationID uid.ID        `json:"conversationId"`
+	AuthorID       uid.ID        `json:"authorId"`
+	Body           string        `json:"body"`
+	ReadAt         msql.NullTime `json:"readAt"` // When the recipient read the message.
+	CreatedAt      time.Time     `json:"createdAt"`
+	Deleted        bool          `json:"deleted"`
+	DeletedAt      msql.NullTime `json:"deletedAt,omitempty"`
+}
+
+// sortedUserPair returns a and b in the order that they are stored in the
+// conversations table.
+func sortedUserPair(a, b uid.ID) (uid.ID, uid.ID) {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
+var selectConversationCols = []string{
+	"conversations.id",
+	"conversations.user1_id",
+	"conversations.user2_id",
+	"conversations.last_message_id",
+	"conversations.created_at",
+	"(SELECT COUNT(*) FROM messages WHERE messages.conversation_id = conversations.id AND messages.author_id <> ? AND messages.read_at IS NULL AND messages.deleted_at IS NULL)",
+}
+
+// getConversations returns the conversations matching the where clause as
+// seen by viewer (who must be a participant in all of them).
+func getConversations(ctx context.Context, db *sql.DB, viewer uid.ID, where string, args ...any) ([]*Conversation, error) {
+	query := msql.BuildSelectQuery("conversations", selectConversationCols, nil, where)
+	rows, err := db.QueryContext(ctx, query, append([]any{viewer}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var convs []*Conversation
+	for rows.Next() {
+		c := &Conversation{viewer: viewer}
+		if err := rows.Scan(&c.ID, &c.User1ID, &c.User2ID, &c.LastMessageID, &c.CreatedAt, &c.NumUnread); err != nil {
+			return nil, err
+		}
+		convs = append(convs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return convs, nil
+	}
+
+	// Fetch the other participants and the last messages.
+	userIDs := make([]uid.ID, len(convs))
+	var messageIDs []uid.ID
+	for i, c := range convs {
+		userIDs[i] = c.OtherUserID()
+		if c.LastMessageID.Valid {
+			messageIDs = append(messageIDs, c.LastMessageID.ID)
+		}
+	}
+	users, err := GetUsersByIDs(ctx, db, userIDs, &viewer)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := getMessagesByIDs(ctx, db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range convs {
+		for _, u := range users {
+			if u.ID == c.OtherUserID() {
+				c.OtherUser = u
+				break
+			}
+		}
+		if c.LastMessageID.Valid {
+			for _, m := range messages {
+				if m.ID == c.LastMessageID.ID {
+					c.LastMessage = m
+					break
+				}
+			}
+		}
+	}
+	return convs, nil
+}
+
+// GetConversation returns the conversation with ID id, as seen by viewer. If
+// viewer is not a participant in it, errConversationNotFound is returned.
+func GetConversation(ctx context.Context, db *sql.DB, id, viewer uid.ID) (*Conversation, error) {
+	convs, err := getConversations(ctx, db, viewer, "WHERE conversations.id = ? AND (conversations.user1_id = ? OR conversations.user2_id = ?)", id, viewer, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return nil, errConversationNotFound
+	}
+	return convs[0], nil
+}
+
+// GetConversations returns the conversations of viewer, with the most recently
+// active one first. Conversations without any messages are skipped. The
+// results are paginated.
+func GetConversations(ctx context.Context, db *sql.DB, viewer uid.ID, limit int, next *string) ([]*Conversation, *string, error) {
+	where := "WHERE (conversations.user1_id = ? OR conversations.user2_id = ?) AND conversations.last_message_id IS NOT NULL "
+	args := []any{viewer, viewer}
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += "AND conversations.last_message_id <= ? "
+		args = append(args, nextID)
+	}
+	where += "ORDER BY conversations.last_message_id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	convs, err := getConversations(ctx, db, viewer, where, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(convs) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = convs[limit].LastMessageID.ID.String()
+		convs = convs[:limit]
+	}
+	return convs, nextNext, nil
+}
+
+// NumUnreadConversations returns the number of conversations of user with at
+// least one unread message.
+func NumUnreadConversations(ctx context.Context, db *sql.DB, user uid.ID) (n int, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT messages.conversation_id) FROM messages
+		INNER JOIN conversations ON conversations.id = messages.conversation_id
+		WHERE (conversations.user1_id = ? OR conversations.user2_id = ?) AND messages.author_id <> ? AND messages.read_at IS NULL AND messages.deleted_at IS NULL`,
+		user, user, user).Scan(&n)
+	return
+}
+
+// canMessage returns errMessagingBlocked if from is not allowed to message to,
+// or to from. Either having muted the other blocks messaging in both
+// directions.
+func canMessage(ctx context.Context, db *sql.DB, from, to *User) error {
+	if from.ID == to.ID {
+		return errMessageSelf
+	}
+	if from.Deleted {
+		return ErrUserDeleted
+	}
+	if to.Deleted || from.Banned || to.Banned {
+		return errMessagingBlocked
+	}
+	if muted, err := UserMuted(ctx, db, to.ID, from.ID); err != nil {
+		return err
+	} else if muted {
+		return errMessagingBlocked
+	}
+	if muted, err := UserMuted(ctx, db, from.ID, to.ID); err != nil {
+		return err
+	} else if muted {
+		return errMessagingBlocked
+	}
+	return nil
+}
+
+// SendMessage sends a private message with body from the user from to the
+// user to, starting a conversation between the two if there isn't one already.
+// The recipient is sent a notification.
+func SendMessage(ctx context.Context, db *sql.DB, from, to *User, body string) (*Message, error) {
+	body = utils.TruncateUnicodeString(strings.TrimSpace(body), maxMessageLength)
+	if body == "" {
+		return nil, errMessageEmpty
+	}
+	if err := canMessage(ctx, db, from, to); err != nil {
+		return nil, err
+	}
+
+	user1, user2 := sortedUserPair(from.ID, to.ID)
+	m := &Message{
+		ID:        uid.New(),
+		AuthorID:  from.ID,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO conversations (id, user1_id, user2_id) VALUES (?, ?, ?)", uid.New(), user1, user2); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, "SELECT id FROM conversations WHERE user1_id = ? AND user2_id = ? FOR UPDATE", user1, user2).Scan(&m.ConversationID); err != nil {
+			return err
+		}
+		query, args := msql.BuildInsertQuery("messages", []msql.ColumnValue{
+			{Name: "id", Value: m.ID},
+			{Name: "conversation_id", Value: m.ConversationID},
+			{Name: "author_id", Value: m.AuthorID},
+			{Name: "body", Value: m.Body},
+			{Name: "created_at", Value: m.CreatedAt},
+		})
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE conversations SET last_message_id = ? WHERE id = ?", m.ID, m.ConversationID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CreateNewMessageNotification(ctx, db, to.ID, m, from); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Send sends a private message with body, from the viewer to the other
+// participant of c.
+func (c *Conversation) Send(ctx context.Context, db *sql.DB, body string) (*Message, error) {
+	from, err := GetUser(ctx, db, c.viewer, nil)
+	if err != nil {
+		return nil, err
+	}
+	to, err := GetUser(ctx, db, c.OtherUserID(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return SendMessage(ctx, db, from, to, body)
+}
+
+var selectMessageCols = []string{
+	"messages.id",
+	"messages.conversation_id",
+	"messages.author_id",
+	"messages.body",
+	"messages.read_at",
+	"messages.created_at",
+	"messages.deleted_at",
+}
+
+// scanMessages scans rows into messages. The bodies of deleted messages are
+// retained in the database (for abuse reports), but are never returned by
+// this function.
+func scanMessages(rows *sql.Rows) ([]*Message, error) {
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.AuthorID, &m.Body, &m.ReadAt, &m.CreatedAt, &m.DeletedAt); err != nil {
+			return nil, err
+		}
+		if m.DeletedAt.Valid {
+			m.Deleted = true
+			m.Body = ""
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func getMessagesByIDs(ctx context.Context, db *sql.DB, ids []uid.ID) ([]*Message, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i := range ids {
+		args[i] = ids[i]
+	}
+	query := msql.BuildSelectQuery("messages", selectMessageCols, nil, "WHERE messages.id IN "+msql.InClauseQuestionMarks(len(ids)))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// GetMessage returns the message with ID id.
+func GetMessage(ctx context.Context, db *sql.DB, id uid.ID) (*Message, error) {
+	messages, err := getMessagesByIDs(ctx, db, []uid.ID{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, errMessageNotFound
+	}
+	return messages[0], nil
+}
+
+// GetMessages returns the messages of c, latest first. The results are
+// paginated.
+func (c *Conversation) GetMessages(ctx context.Context, db *sql.DB, limit int, next *string) ([]*Message, *string, error) {
+	where, args := "WHERE messages.conversation_id = ? ", []any{c.ID}
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += "AND messages.id <= ? "
+		args = append(args, nextID)
+	}
+	where += "ORDER BY messages.id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, msql.BuildSelectQuery("messages", selectMessageCols, nil, where), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(messages) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = messages[limit].ID.String()
+		messages = messages[:limit]
+	}
+	return messages, nextNext, nil
+}
+
+// MarkAsRead marks all the messages sent to the viewer in c as read. The
+// times at which the messages were read are visible to their authors.
+func (c *Conversation) MarkAsRead(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "UPDATE messages SET read_at = ? WHERE conversation_id = ? AND author_id <> ? AND read_at IS NULL", time.Now(), c.ID, c.viewer)
+	if err == nil {
+		c.NumUnread = 0
+	}
+	return err
+}
+
+// Delete deletes m, provided that user is its author. The body of the message
+// is kept, but not shown to either participant, so that the message can still
+// be reported and reviewed.
+func (m *Message) Delete(ctx context.Context, db *sql.DB, user uid.ID) error {
+	if m.AuthorID != user {
+		return errNotAuthor
+	}
+	if m.Deleted {
+		return errMessageDeleted
+	}
+	now := time.Now()
+	if _, err := db.ExecContext(ctx, "UPDATE messages SET deleted_at = ? WHERE id = ?", now, m.ID); err != nil {
+		return err
+	}
+	m.Deleted = true
+	m.DeletedAt = msql.NewNullTime(now)
+	m.Body = ""
+	return nil
+}
+
+// MessageReport is a report, made by the recipient of a private message, on
+// the message. Message reports are dealt with by the admins.
+type MessageReport struct {
+	ID          int             `json:"id"`
+	MessageID   uid.ID          `json:"messageId"`
+	ReasonID    int             `json:"reasonId"`
+	Reason      string          `json:"reason"`
+	Description msql.NullString `json:"description"`
+	CreatedBy   uid.ID          `json:"-"`
+	ActionTaken msql.NullString `json:"actionTaken"`
+	DealtAt     msql.NullTime   `json:"dealtAt"`
+	DealtBy     uid.NullID      `json:"dealtBy"`
+	CreatedAt   time.Time       `json:"createdAt"`
+
+	// The reported message (including its body, even if it's deleted) and its
+	// author.
+	Message *Message `json:"message"`
+	Author  *User    `json:"author"`
+}
+
+var selectMessageReportCols = []string{
+	"message_reports.id",
+	"message_reports.message_id",
+	"message_reports.reason_id",
+	"message_reports.created_by",
+	"message_reports.action_taken",
+	"message_reports.dealt_at",
+	"message_reports.dealt_by",
+	"message_reports.created_at",
+	"report_reasons.title",
+	"report_reasons.description",
+}
+
+var selectMessageReportJoins = []string{
+	"INNER JOIN report_reasons ON message_reports.reason_id = report_reasons.id",
+}
+
+// NewMessageReport creates a report on the message m, by user, who must be
+// the recipient of the message. Reason is the ID of a report reason.
+func NewMessageReport(ctx context.Context, db *sql.DB, m *Message, reason int, user uid.ID) (*MessageReport, error) {
+	if m.AuthorID == user {
+		return nil, httperr.NewBadRequest("report-own-message", "You cannot report your own message.")
+	}
+	if _, err := GetConversation(ctx, db, m.ConversationID, user); err != nil {
+		if err == errConversationNotFound {
+			return nil, errMessageNotFound
+		}
+		return nil, err
+	}
+
+	var reasonID int
+	if err := db.QueryRowContext(ctx, "SELECT id FROM report_reasons WHERE id = ?", reason).Scan(&reasonID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperr.NewBadRequest("invalid-reason", "Invalid report reason.")
+		}
+		return nil, err
+	}
+
+	res, err := db.ExecContext(ctx, "INSERT INTO message_reports (message_id, reason_id, created_by) VALUES (?, ?, ?)", m.ID, reasonID, user)
+	if err != nil {
+		if msql.IsErrDuplicateErr(err) {
+			return nil, &httperr.Error{HTTPStatus: http.StatusConflict, Code: "already-reported", Message: "You have already reported this message."}
+		}
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetMessageReport(ctx, db, int(id))
+}
+
+func scanMessageReports(ctx context.Context, db *sql.DB, rows *sql.Rows) ([]*MessageReport, error) {
+	defer rows.Close()
+
+	var reports []*MessageReport
+	for rows.Next() {
+		r := &MessageReport{}
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.ReasonID, &r.CreatedBy, &r.ActionTaken, &r.DealtAt, &r.DealtBy, &r.CreatedAt, &r.Reason, &r.Description); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range reports {
+		// Fetch the message directly, so that admins see the bodies of deleted
+		// messages too.
+		m := &Message{}
+		row := db.QueryRowContext(ctx, msql.BuildSelectQuery("messages", selectMessageCols, nil, "WHERE messages.id = ?"), r.MessageID)
+		if err := row.Scan(&m.ID, &m.ConversationID, &m.AuthorID, &m.Body, &m.ReadAt, &m.CreatedAt, &m.DeletedAt); err != nil {
+			return nil, err
+		}
+		m.Deleted = m.DeletedAt.Valid
+		r.Message = m
+		author, err := GetUser(ctx, db, m.AuthorID, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Author = author
+	}
+	return reports, nil
+}
+
+// GetMessageReport returns the message report with ID id.
+func GetMessageReport(ctx context.Context, db *sql.DB, id int) (*MessageReport, error) {
+	query := msql.BuildSelectQuery("message_reports", selectMessageReportCols, selectMessageReportJoins, "WHERE message_reports.id = ?")
+	rows, err := db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := scanMessageReports(ctx, db, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, errMessageReportNotFound
+	}
+	return reports[0], nil
+}
+
+// GetMessageReports returns the message reports (of all users), latest first.
+// The results are paginated.
+func GetMessageReports(ctx context.Context, db *sql.DB, state ReportState, limit, page int) ([]*MessageReport, error) {
+	where := ""
+	switch state {
+	case ReportStateOpen:
+		where = "WHERE message_reports.dealt_at IS NULL "
+	case ReportStateResolved:
+		where = "WHERE message_reports.dealt_at IS NOT NULL "
+	}
+	where += "ORDER BY message_reports.created_at DESC LIMIT ? OFFSET ?"
+
+	query := msql.BuildSelectQuery("message_reports", selectMessageReportCols, selectMessageReportJoins, where)
+	rows, err := db.QueryContext(ctx, query, limit, limit*(page-1))
+	if err != nil {
+		return nil, err
+	}
+	return scanMessageReports(ctx, db, rows)
+}
+
+// TakeAction resolves the report with action, taken by the admin. Only the
+// actions ReportActionDismissed and ReportActionUserBanned apply to message
+// reports. This method only records the action; banning the user is done
+// separately.
+func (r *MessageReport) TakeAction(ctx context.Context, db *sql.DB, action ReportAction, admin uid.ID) error {
+	if !(action == ReportActionDismissed || action == ReportActionUserBanned) {
+		return ErrInvalidReportAction
+	}
+	if r.DealtAt.Valid {
+		return errReportResolved
+	}
+
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "UPDATE message_reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE id = ? AND dealt_at IS NULL", action, now, admin, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errReportResolved
+	}
+
+	r.ActionTaken = msql.NewNullString(string(action))
+	r.DealtAt = msql.NewNullTime(now)
+	r.DealtBy = uid.NullID{Valid: true, ID: admin}
+	return nil
+}
@@ -0,0 +1,326 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// ModLogAction is the type of action recorded in a ModLogEntry.
+type ModLogAction string
+
+const (
+	ModLogActionPostDelete        = ModLogAction("post_delete")
+	ModLogActionPostDeleteContent = ModLogAction("post_delete_content")
+	ModLogActionPostLock          = ModLogAction("post_lock")
+	ModLogActionPostUnlock        = ModLogAction("post_unlock")
+	ModLogActionPostPin           = ModLogAction("post_pin")
+	ModLogActionPostUnpin         = ModLogAction("post_unpin")
+	ModLogActionPostApprove       = ModLogAction("post_approve")
+	ModLogActionCommentDelete     = ModLogAction("comment_delete")
+	ModLogActionCommentLock       = ModLogAction("comment_lock")
+	ModLogActionCommentUnlock     = ModLogAction("comment_unlock")
+	ModLogActionCommentApprove    = ModLogAction("comment_approve")
+	ModLogActionUserBan           = ModLogAction("user_ban")   // community ban
+	ModLogActionUserUnban         = ModLogAction("user_unban") // community unban
+	ModLogActionModAdd            = ModLogAction("mod_add")
+	ModLogActionModRemove         = ModLogAction("mod_remove")
+	ModLogActionRuleAdd           = ModLogAction("rule_add")
+	ModLogActionRuleDelete        = ModLogAction("rule_delete")
+	ModLogActionSiteBan           = ModLogAction("site_ban")
+	ModLogActionSiteUnban         = ModLogAction("site_unban")
+	ModLogActionCommunityDeny     = ModLogAction("community_deny")
+)
+
+// Valid reports whether a is a valid ModLogAction.
+func (a ModLogAction) Valid() bool {
+	switch a {
+	case ModLogActionPostDelete,
+		ModLogActionPostDeleteContent,
+		ModLogActionPostLock,
+		ModLogActionPostUnlock,
+		ModLogActionPostPin,
+		ModLogActionPostUnpin,
+		ModLogActionPostApprove,
+		ModLogActionCommentDelete,
+		ModLogActionCommentLock,
+		ModLogActionCommentUnlock,
+		ModLogActionCommentApprove,
+		ModLogActionUserBan,
+		ModLogActionUserUnban,
+		ModLogActionModAdd,
+		ModLogActionModRemove,
+		ModLogActionRuleAdd,
+		ModLogActionRuleDelete,
+		ModLogActionSiteBan,
+		ModLogActionSiteUnban,
+		ModLogActionCommunityDeny:
+		return true
+	}
+	return false
+}
+
+// ModLogTargetType is the type of the object a mod action is performed on.
+type ModLogTargetType string
+
+const (
+	ModLogTargetPost             = ModLogTargetType("post")
+	ModLogTargetComment          = ModLogTargetType("comment")
+	ModLogTargetUser             = ModLogTargetType("user")
+	ModLogTargetRule             = ModLogTargetType("rule")
+	ModLogTargetCommunityRequest = ModLogTargetType("community_request")
+)
+
+// Valid reports whether t is a valid ModLogTargetType.
+func (t ModLogTargetType) Valid() bool {
+	switch t {
+	case ModLogTargetPost, ModLogTargetComment, ModLogTargetUser, ModLogTargetRule, ModLogTargetCommunityRequest:
+		return true
+	}
+	return false
+}
+
+// ModLogEntry is a row in the modlog table, a record of an action performed by
+// a moderator or an admin.
+type ModLogEntry struct {
+	ID int `json:"id"`
+
+	// CommunityID is null for site-wide actions (like site bans).
+	CommunityID uid.NullID `json:"communityId"`
+
+	ActorID       uid.ID    `json:"actorId"`
+	ActorUsername string    `json:"actorUsername"`
+	ActorGroup    UserGroup `json:"actorGroup"` // Either mods or admins.
+
+	Action     ModLogAction     `json:"action"`
+	TargetType ModLogTargetType `json:"targetType"`
+	TargetID   string           `json:"targetId"`
+
+	// Information specific to the action (like the title of a deleted post, or
+	// the expiry of a ban).
+	Details map[string]any `json:"details"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// newModLogEntry returns a ModLogEntry. Community may be nil.
+func newModLogEntry(community *uid.ID, actor uid.ID, g UserGroup, action ModLogAction, targetType ModLogTargetType, targetID string) *ModLogEntry {
+	e := &ModLogEntry{
+		ActorID:    actor,
+		ActorGroup: g,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    make(map[string]any),
+	}
+	if community != nil {
+		e.CommunityID = uid.NullID{Valid: true, ID: *community}
+	}
+	return e
+}
+
+// insert saves e to the database as part of tx.
+func (e *ModLogEntry) insert(ctx context.Context, tx *sql.Tx) error {
+	var details any
+	if len(e.Details) > 0 {
+		data, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		details = data
+	}
+	query, args := msql.BuildInsertQuery("modlog", []msql.ColumnValue{
+		{Name: "community_id", Value: e.CommunityID},
+		{Name: "actor_id", Value: e.ActorID},
+		{Name: "actor_group", Value: e.ActorGroup},
+		{Name: "action", Value: e.Action},
+		{Name: "target_type", Value: e.TargetType},
+		{Name: "target_id", Value: e.TargetID},
+		{Name: "details", Value: details},
+	})
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// setTargetUsername adds the username of user to e.Details (so that the log
+// is readable without having to look up the user).
+func (e *ModLogEntry) setTargetUsername(ctx context.Context, tx *sql.Tx, user uid.ID) error {
+	var username string
+	if err := tx.QueryRowContext(ctx, "SELECT username FROM users WHERE id = ?", user).Scan(&username); err != nil {
+		return err
+	}
+	e.Details["username"] = username
+	return nil
+}
+
+// modOrAdminGroup returns UserGroupMods if user is a mod of community, and
+// UserGroupAdmins otherwise. The caller is expected to have already checked
+// that user is either a mod or an admin.
+func modOrAdminGroup(ctx context.Context, db *sql.DB, community, user uid.ID) (UserGroup, error) {
+	is, err := UserMod(ctx, db, community, user)
+	if err != nil {
+		return UserGroupNaN, err
+	}
+	if is {
+		return UserGroupMods, nil
+	}
+	return UserGroupAdmins, nil
+}
+
+// ModLogOptions are the filters for GetModLog. All fields, except Limit, are
+// optional.
+type ModLogOptions struct {
+	Community  *uid.ID
+	Actor      *uid.ID
+	Action     ModLogAction
+	TargetType ModLogTargetType
+	TargetID   string
+	Limit      int
+	Next       *int // The pagination cursor, taken from previous API response.
+}
+
+// ModLogResultSet is a page of modlog entries.
+type ModLogResultSet struct {
+	Entries []*ModLogEntry `json:"entries"`
+	Next    *int           `json:"next"`
+}
+
+var ErrInvalidModLogFilter = httperr.NewBadRequest("invalid-modlog-filter", "Invalid modlog filter.")
+
+// GetModLog returns the modlog entries that match the filters in opts, latest
+// first.
+func GetModLog(ctx context.Context, db *sql.DB, opts *ModLogOptions) (*ModLogResultSet, error) {
+	if opts.Action != "" && !opts.Action.Valid() {
+		return nil, ErrInvalidModLogFilter
+	}
+	if opts.TargetType != "" && !opts.TargetType.Valid() {
+		return nil, ErrInvalidModLogFilter
+	}
+
+	where, args := "WHERE TRUE ", []any{}
+	if opts.Community != nil {
+		where += "AND modlog.community_id = ? "
+		args = append(args, *opts.Community)
+	}
+	if opts.Actor != nil {
+		where += "AND modlog.actor_id = ? "
+		args = append(args, *opts.Actor)
+	}
+	if opts.Action != "" {
+		where += "AND modlog.action = ? "
+		args = append(args, opts.Action)
+	}
+	if opts.TargetType != "" {
+		where += "AND modlog.target_type = ? "
+		args = append(args, opts.TargetType)
+	}
+	if opts.TargetID != "" {
+		where += "AND modlog.target_id = ? "
+		args = append(args, opts.TargetID)
+	}
+	if opts.Next != nil {
+		where += "AND modlog.id <= ? "
+		args = append(args, *opts.Next)
+	}
+	where += "ORDER BY modlog.id DESC LIMIT ?"
+	args = append(args, opts.Limit+1)
+
+	query := msql.BuildSelectQuery("modlog", []string{
+		"modlog.id",
+		"modlog.community_id",
+		"modlog.actor_id",
+		"users.username",
+		"modlog.actor_group",
+		"modlog.action",
+		"modlog.target_type",
+		"modlog.target_id",
+		"modlog.details",
+		"modlog.created_at",
+	}, []string{"INNER JOIN users ON users.id = modlog.actor_id"}, where)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := &ModLogResultSet{Entries: []*ModLogEntry{}}
+	for rows.Next() {
+		e := &ModLogEntry{}
+		var details []byte
+		err := rows.Scan(
+			&e.ID,
+			&e.CommunityID,
+			&e.ActorID,
+			&e.ActorUsername,
+			&e.ActorGroup,
+			&e.Action,
+			&e.TargetType,
+			&e.TargetID,
+			&details,
+			&e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if details != nil {
+			if err := json.Unmarshal(details, &e.Details); err != nil {
+				return nil, fmt.Errorf("unmarshaling modlog details (id: %v): %w", e.ID, err)
+			}
+		}
+		set.Entries = append(set.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(set.Entries) > opts.Limit {
+		set.Next = &set.Entries[opts.Limit].ID
+		set.Entries = set.Entries[:opts.Limit]
+	}
+	if err := hideDeletedContentTitles(ctx, db, set.Entries); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// hideDeletedContentTitles removes the post titles from the details of those
+// entries whose posts had their content deleted (including the entries
+// recorded before the content was deleted).
+func hideDeletedContentTitles(ctx context.Context, db *sql.DB, entries []*ModLogEntry) error {
+	var ids []any
+	for _, e := range entries {
+		if e.TargetType == ModLogTargetPost && e.Details["postTitle"] != nil {
+			id, err := uid.FromString(e.TargetID)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM posts WHERE deleted_content = TRUE AND id IN "+msql.InClauseQuestionMarks(len(ids)), ids...)
+	if err != nil {
+		return err
+	}
+	deleted, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+	for _, id := range deleted {
+		for _, e := range entries {
+			if e.TargetType == ModLogTargetPost && e.TargetID == id.String() {
+				delete(e.Details, "postTitle")
+			}
+		}
+	}
+	return nil
+}
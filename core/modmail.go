@@ -0,0 +1,395 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const maxModmailSubjectLength = 255
+
+var (
+	ErrModmailThreadNotFound = httperr.NewNotFound("modmail-thread-not-found", "Modmail thread not found.")
+	errModmailSubjectEmpty   = httperr.NewBadRequest("modmail-subject-empty", "Subject is empty.")
+	errInvalidModmailState   = httperr.NewBadRequest("invalid-modmail-state", "Invalid modmail state.")
+)
+
+// ModmailState is the state of a modmail thread, as set by the moderators.
+type ModmailState string
+
+const (
+	ModmailStateNew        = ModmailState("new")
+	ModmailStateInProgress = ModmailState("in_progress")
+	ModmailStateArchived   = ModmailState("archived")
+)
+
+// Valid reports whether s is a valid ModmailState.
+func (s ModmailState) Valid() bool {
+	switch s {
+	case ModmailStateNew, ModmailStateInProgress, ModmailStateArchived:
+		return true
+	}
+	return false
+}
+
+// ModmailThread is a conversation between a user and the moderators of a
+// community, as a team. Any moderator can reply to it, and replies are shown
+// to the user as coming from the community.
+type ModmailThread struct {
+	ID            uid.ID       `json:"id"`
+	CommunityID   uid.ID       `json:"communityId"`
+	CommunityName string       `json:"communityName"`
+	UserID        uid.ID       `json:"userId"`
+	Username      string       `json:"username"`
+	Subject       string       `json:"subject"`
+	State         ModmailState `json:"state"`
+	LastMessageID uid.ID       `json:"-"`
+	LastMessageAt time.Time    `json:"lastMessageAt"`
+	CreatedAt     time.Time    `json:"createdAt"`
+}
+
+// ModmailMessage is a message in a modmail thread.
+type ModmailMessage struct {
+	ID       uid.ID `json:"id"`
+	ThreadID uid.ID `json:"threadId"`
+
+	// If the message was sent on behalf of the moderators (AsMod is true), the
+	// author is only visible to the moderators.
+	AuthorID uid.NullID `json:"authorId"`
+	Username string     `json:"username"`
+	AsMod    bool       `json:"asMod"`
+
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var selectModmailThreadCols = []string{
+	"modmail_threads.id",
+	"modmail_threads.community_id",
+	"communities.name",
+	"modmail_threads.user_id",
+	"users.username",
+	"modmail_threads.subject",
+	"modmail_threads.state",
+	"modmail_threads.last_message_id",
+	"modmail_threads.created_at",
+}
+
+var selectModmailThreadJoins = []string{
+	"INNER JOIN communities ON communities.id = modmail_threads.community_id",
+	"INNER JOIN users ON users.id = modmail_threads.user_id",
+}
+
+func scanModmailThreads(rows *sql.Rows) ([]*ModmailThread, error) {
+	defer rows.Close()
+
+	var threads []*ModmailThread
+	for rows.Next() {
+		t := &ModmailThread{}
+		if err := rows.Scan(&t.ID, &t.CommunityID, &t.CommunityName, &t.UserID, &t.Username, &t.Subject, &t.State, &t.LastMessageID, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.LastMessageAt = t.LastMessageID.Time()
+		threads = append(threads, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+// GetModmailThread returns the modmail thread with ID id.
+func GetModmailThread(ctx context.Context, db *sql.DB, id uid.ID) (*ModmailThread, error) {
+	query := msql.BuildSelectQuery("modmail_threads", selectModmailThreadCols, selectModmailThreadJoins, "WHERE modmail_threads.id = ?")
+	rows, err := db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := scanModmailThreads(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return nil, ErrModmailThreadNotFound
+	}
+	return threads[0], nil
+}
+
+// getModmailThreads returns the modmail threads matching the where clause,
+// latest active first. The results are paginated.
+func getModmailThreads(ctx context.Context, db *sql.DB, where string, args []any, limit int, next *string) ([]*ModmailThread, *string, error) {
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += " AND modmail_threads.last_message_id <= ?"
+		args = append(args, nextID)
+	}
+	where += " ORDER BY modmail_threads.last_message_id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	query := msql.BuildSelectQuery("modmail_threads", selectModmailThreadCols, selectModmailThreadJoins, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	threads, err := scanModmailThreads(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(threads) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = threads[limit].LastMessageID.String()
+		threads = threads[:limit]
+	}
+	return threads, nextNext, nil
+}
+
+// GetCommunityModmailThreads returns the modmail threads of community. If
+// state is empty, threads of all states are returned.
+func GetCommunityModmailThreads(ctx context.Context, db *sql.DB, community uid.ID, state ModmailState, limit int, next *string) ([]*ModmailThread, *string, error) {
+	where, args := "WHERE modmail_threads.community_id = ?", []any{community}
+	if state != "" {
+		if !state.Valid() {
+			return nil, nil, errInvalidModmailState
+		}
+		where += " AND modmail_threads.state = ?"
+		args = append(args, state)
+	}
+	return getModmailThreads(ctx, db, where, args, limit, next)
+}
+
+// GetUserModmailThreads returns the modmail threads opened by user.
+func GetUserModmailThreads(ctx context.Context, db *sql.DB, user uid.ID, limit int, next *string) ([]*ModmailThread, *string, error) {
+	return getModmailThreads(ctx, db, "WHERE modmail_threads.user_id = ?", []any{user}, limit, next)
+}
+
+// NumNewModmailThreads returns the number of modmail threads of community in
+// the state new.
+func NumNewModmailThreads(ctx context.Context, db *sql.DB, community uid.ID) (n int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM modmail_threads WHERE community_id = ? AND state = ?", community, ModmailStateNew).Scan(&n)
+	return
+}
+
+// insertModmailMessage adds a message to thread, as part of tx, and updates
+// the thread's last_message_id.
+func insertModmailMessage(ctx context.Context, tx *sql.Tx, m *ModmailMessage) error {
+	query, args := msql.BuildInsertQuery("modmail_messages", []msql.ColumnValue{
+		{Name: "id", Value: m.ID},
+		{Name: "thread_id", Value: m.ThreadID},
+		{Name: "author_id", Value: m.AuthorID.ID},
+		{Name: "as_mod", Value: m.AsMod},
+		{Name: "body", Value: m.Body},
+		{Name: "created_at", Value: m.CreatedAt},
+	})
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE modmail_threads SET last_message_id = ? WHERE id = ?", m.ID, m.ThreadID)
+	return err
+}
+
+func newModmailMessage(thread uid.ID, author *User, asMod bool, body string) (*ModmailMessage, error) {
+	body = utils.TruncateUnicodeString(strings.TrimSpace(body), maxMessageLength)
+	if body == "" {
+		return nil, errMessageEmpty
+	}
+	id := uid.New()
+	return &ModmailMessage{
+		ID:        id,
+		ThreadID:  thread,
+		AuthorID:  uid.NullID{Valid: true, ID: author.ID},
+		Username:  author.Username,
+		AsMod:     asMod,
+		Body:      body,
+		CreatedAt: id.Time(),
+	}, nil
+}
+
+// NewModmailThread opens a modmail thread by user with the moderators of
+// community. Users banned from the community can also open threads (to appeal
+// the ban, for instance). The moderators are sent a notification.
+func NewModmailThread(ctx context.Context, db *sql.DB, community *Community, user *User, subject, body string) (*ModmailThread, error) {
+	if user.Deleted {
+		return nil, ErrUserDeleted
+	}
+	subject = utils.TruncateUnicodeString(strings.TrimSpace(subject), maxModmailSubjectLength)
+	if subject == "" {
+		return nil, errModmailSubjectEmpty
+	}
+
+	threadID := uid.New()
+	m, err := newModmailMessage(threadID, user, false, body)
+	if err != nil {
+		return nil, err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		query, args := msql.BuildInsertQuery("modmail_threads", []msql.ColumnValue{
+			{Name: "id", Value: threadID},
+			{Name: "community_id", Value: community.ID},
+			{Name: "user_id", Value: user.ID},
+			{Name: "subject", Value: subject},
+			{Name: "state", Value: ModmailStateNew},
+			{Name: "last_message_id", Value: m.ID},
+		})
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		return insertModmailMessage(ctx, tx, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	thread, err := GetModmailThread(ctx, db, threadID)
+	if err != nil {
+		return nil, err
+	}
+	thread.notify(ctx, db, m)
+	return thread, nil
+}
+
+// Reply adds a message by author to t. If asMod is true, the message is sent
+// on behalf of the moderators, and author must be a moderator of t's
+// community (or an admin). Otherwise, author must be the user who opened the
+// thread.
+//
+// A reply by the user reopens an archived thread, and the first reply by the
+// moderators to a new thread marks it as in progress.
+func (t *ModmailThread) Reply(ctx context.Context, db *sql.DB, author *User, asMod bool, body string) (*ModmailMessage, error) {
+	if asMod {
+		if ok, err := UserModOrAdmin(ctx, db, t.CommunityID, author.ID); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, errNotMod
+		}
+	} else if t.UserID != author.ID {
+		return nil, ErrModmailThreadNotFound
+	}
+
+	m, err := newModmailMessage(t.ID, author, asMod, body)
+	if err != nil {
+		return nil, err
+	}
+
+	state := t.State
+	if asMod && state == ModmailStateNew {
+		state = ModmailStateInProgress
+	} else if !asMod && state == ModmailStateArchived {
+		state = ModmailStateNew
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := insertModmailMessage(ctx, tx, m); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE modmail_threads SET state = ? WHERE id = ?", state, t.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.State = state
+	t.LastMessageID = m.ID
+	t.LastMessageAt = m.CreatedAt
+
+	t.notify(ctx, db, m)
+	return m, nil
+}
+
+// notify sends a notification of the new message m in t to the other side of
+// the thread: the user if m was sent by the moderators, and the moderators
+// otherwise. Errors are logged and not returned.
+func (t *ModmailThread) notify(ctx context.Context, db *sql.DB, m *ModmailMessage) {
+	if m.AsMod {
+		if err := CreateModmailNotification(ctx, db, t.UserID, t, false); err != nil {
+			log.Printf("Failed to send modmail notification (thread: %v): %v\n", t.ID, err)
+		}
+		return
+	}
+	mods, err := GetCommunityMods(ctx, db, t.CommunityID)
+	if err != nil {
+		log.Printf("Failed to fetch mods of community %v for modmail notifications: %v\n", t.CommunityID, err)
+		return
+	}
+	for _, mod := range mods {
+		if mod.ID == t.UserID {
+			continue
+		}
+		if err := CreateModmailNotification(ctx, db, mod.ID, t, true); err != nil {
+			log.Printf("Failed to send modmail notification (thread: %v): %v\n", t.ID, err)
+		}
+	}
+}
+
+// SetState changes the state of t. It's meant to be called on behalf of the
+// moderators.
+func (t *ModmailThread) SetState(ctx context.Context, db *sql.DB, state ModmailState) error {
+	if !state.Valid() {
+		return errInvalidModmailState
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE modmail_threads SET state = ? WHERE id = ?", state, t.ID); err != nil {
+		return err
+	}
+	t.State = state
+	return nil
+}
+
+// GetMessages returns the messages of t, latest first. The results are
+// paginated. If forMod is false, the authors of the messages sent on behalf of
+// the moderators are hidden.
+func (t *ModmailThread) GetMessages(ctx context.Context, db *sql.DB, forMod bool, limit int, next *string) ([]*ModmailMessage, *string, error) {
+	where, args := "WHERE modmail_messages.thread_id = ? ", []any{t.ID}
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += "AND modmail_messages.id <= ? "
+		args = append(args, nextID)
+	}
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT modmail_messages.id, modmail_messages.thread_id, modmail_messages.author_id, users.username, modmail_messages.as_mod, modmail_messages.body, modmail_messages.created_at
+		FROM modmail_messages
+		INNER JOIN users ON users.id = modmail_messages.author_id
+		`+where+`ORDER BY modmail_messages.id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	messages := []*ModmailMessage{}
+	for rows.Next() {
+		m := &ModmailMessage{}
+		if err := rows.Scan(&m.ID, &m.ThreadID, &m.AuthorID, &m.Username, &m.AsMod, &m.Body, &m.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		if m.AsMod && !forMod {
+			m.AuthorID = uid.NullID{}
+			m.Username = ""
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(messages) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = messages[limit].ID.String()
+		messages = messages[:limit]
+	}
+	return messages, nextNext, nil
+}
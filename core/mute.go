@@ -4,11 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net/url"
+	"regexp"
 	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/discuitnet/discuit/internal/httperr"
 	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/uid"
 )
@@ -16,12 +22,30 @@ import (
 type MuteType string
 
 func (t MuteType) Valid() bool {
-	return slices.Contains([]MuteType{"", MuteTypeUser, MuteTypeCommunity}, t)
+	return slices.Contains([]MuteType{"", MuteTypeUser, MuteTypeCommunity, MuteTypeKeyword, MuteTypeDomain}, t)
 }
 
 const (
 	MuteTypeUser      = MuteType("user")
 	MuteTypeCommunity = MuteType("community")
+
+	// Posts (and comments) that contain a muted keyword, in their title or
+	// body, are filtered out.
+	MuteTypeKeyword = MuteType("keyword")
+
+	// Link posts to a muted domain are filtered out.
+	MuteTypeDomain = MuteType("domain")
+)
+
+const (
+	maxMutesPerType       = 1000
+	maxMutedKeywordLength = 100 // In runes.
+)
+
+var (
+	errInvalidMutedKeyword = httperr.NewBadRequest("invalid-muted-keyword", "Invalid keyword.")
+	errInvalidMutedDomain  = httperr.NewBadRequest("invalid-muted-domain", "Invalid domain.")
+	errTooManyMutes        = httperr.NewForbidden("too-many-mutes", "Maximum number of mutes reached.")
 )
 
 type Mute struct {
@@ -31,6 +55,8 @@ type Mute struct {
 	Type             MuteType  `json:"type"`
 	MutedUserID      *uid.ID   `json:"mutedUserId,omitempty"`      // may be empty and omitted base on Type
 	MutedCommunityID *uid.ID   `json:"mutedCommunityId,omitempty"` // may be empty and omitted base on Type
+	MutedKeyword     *string   `json:"mutedKeyword,omitempty"`     // may be empty and omitted base on Type
+	MutedDomain      *string   `json:"mutedDomain,omitempty"`      // may be empty and omitted base on Type
 	CreatedAt        time.Time `json:"createdAt"`
 
 	MutedUser      *User      `json:"mutedUser,omitempty"`
@@ -44,6 +70,10 @@ func (m *Mute) setPrintID() {
 		s = "u_" + s
 	case MuteTypeCommunity:
 		s = "c_" + s
+	case MuteTypeKeyword:
+		s = "k_" + s
+	case MuteTypeDomain:
+		s = "d_" + s
 	default:
 		panic("unknown mute type")
 	}
@@ -63,6 +93,10 @@ func extractMuteID(s string) (t MuteType, id int, err error) {
 		t = MuteTypeUser
 	case "c_":
 		t = MuteTypeCommunity
+	case "k_":
+		t = MuteTypeKeyword
+	case "d_":
+		t = MuteTypeDomain
 	default:
 		err = errMuteID
 		return
@@ -85,7 +119,18 @@ func GetMutes(ctx context.Context, db *sql.DB, user uid.ID) ([]*Mute, error) {
 		return nil, err
 	}
 
+	keywordMutes, err := GetMutedKeywords(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+	domainMutes, err := GetMutedDomains(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+
 	all := append(communityMutes, userMutes...)
+	all = append(all, keywordMutes...)
+	all = append(all, domainMutes...)
 	sort.Slice(all, func(i, j int) bool {
 		return all[i].CreatedAt.Before(all[j].CreatedAt)
 	})
@@ -191,12 +236,17 @@ func Unmute(ctx context.Context, db *sql.DB, user uid.ID, id string) error {
 		_, err = db.ExecContext(ctx, "delete from muted_communities where id = ? and user_id = ?", idInt, user)
 	case MuteTypeUser:
 		_, err = db.ExecContext(ctx, "delete from muted_users where id = ? and user_id = ?", idInt, user)
+	case MuteTypeKeyword:
+		_, err = db.ExecContext(ctx, "DELETE FROM muted_keywords WHERE id = ? AND user_id = ?", idInt, user)
+		mutedKeywordsCache.invalidate(user)
+	case MuteTypeDomain:
+		_, err = db.ExecContext(ctx, "DELETE FROM muted_domains WHERE id = ? AND user_id = ?", idInt, user)
 	}
 	return err
 }
 
-// ClearMutes clears all mutes of user if t is empty, otherwise it clears either
-// the community or the user mutes.
+// ClearMutes clears all mutes of user if t is empty, otherwise it clears only
+// the mutes of type t.
 func ClearMutes(ctx context.Context, db *sql.DB, user uid.ID, t MuteType) (err error) {
 	if t == "" || t == MuteTypeCommunity {
 		_, err = db.ExecContext(ctx, "DELETE FROM muted_communities WHERE user_id = ?", user)
@@ -206,6 +256,19 @@ func ClearMutes(ctx context.Context, db *sql.DB, user uid.ID, t MuteType) (err e
 	}
 	if t == "" || t == MuteTypeUser {
 		_, err = db.ExecContext(ctx, "DELETE FROM muted_users where user_id = ?", user)
+		if err != nil {
+			return
+		}
+	}
+	if t == "" || t == MuteTypeKeyword {
+		_, err = db.ExecContext(ctx, "DELETE FROM muted_keywords WHERE user_id = ?", user)
+		mutedKeywordsCache.invalidate(user)
+		if err != nil {
+			return
+		}
+	}
+	if t == "" || t == MuteTypeDomain {
+		_, err = db.ExecContext(ctx, "DELETE FROM muted_domains WHERE user_id = ?", user)
 	}
 	return
 }
@@ -241,3 +304,235 @@ func UnmuteUser(ctx context.Context, db *sql.DB, user, mutedUser uid.ID) error {
 	_, err := db.ExecContext(ctx, "DELETE FROM muted_users WHERE user_id = ? AND muted_user_id = ?", user, mutedUser)
 	return err
 }
+
+// normalizeMutedKeyword returns keyword trimmed and in lowercase. It returns an
+// error if keyword is empty or too long.
+func normalizeMutedKeyword(keyword string) (string, error) {
+	keyword = strings.ToLower(strings.Join(strings.Fields(keyword), " "))
+	if keyword == "" || utf8.RuneCountInString(keyword) > maxMutedKeywordLength {
+		return "", errInvalidMutedKeyword
+	}
+	return keyword, nil
+}
+
+// mutedKeywordPattern returns a regular expression that matches keyword as a
+// whole word (or phrase).
+func mutedKeywordPattern(keyword string) string {
+	return `(?:^|\W)` + regexp.QuoteMeta(keyword) + `(?:\W|$)`
+}
+
+// compileMutedKeywords compiles patterns (see mutedKeywordPattern) into a
+// single, case-insensitive, regular expression that matches any of them. It
+// returns nil if there are no patterns.
+func compileMutedKeywords(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)(?:" + strings.Join(patterns, "|") + ")")
+}
+
+// mutedKeywordsCacheTTL is how long the compiled muted keywords of a user are
+// cached for. The cache of a user is invalidated whenever their muted
+// keywords change, so this only matters if there are several instances of
+// the server.
+const mutedKeywordsCacheTTL = time.Minute * 10
+
+// maxMutedKeywordsCacheSize is the number of users whose muted keywords are
+// cached, beyond which the cache is cleared.
+const maxMutedKeywordsCacheSize = 10000
+
+var mutedKeywordsCache = &mutedKeywordsCacheStore{entries: make(map[uid.ID]*mutedKeywordsCacheEntry)}
+
+type mutedKeywordsCacheStore struct {
+	mu      sync.Mutex // guards entries
+	entries map[uid.ID]*mutedKeywordsCacheEntry
+}
+
+type mutedKeywordsCacheEntry struct {
+	re        *regexp.Regexp // Nil if the user has no muted keywords.
+	fetchedAt time.Time
+}
+
+// get returns the compiled muted keywords of user, or nil if user has none.
+func (mc *mutedKeywordsCacheStore) get(ctx context.Context, db *sql.DB, user uid.ID) (*regexp.Regexp, error) {
+	mc.mu.Lock()
+	entry, ok := mc.entries[user]
+	mc.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < mutedKeywordsCacheTTL {
+		return entry.re, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT pattern FROM muted_keywords WHERE user_id = ?", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var patterns []string
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	re, err := compileMutedKeywords(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(mc.entries) >= maxMutedKeywordsCacheSize {
+		mc.entries = make(map[uid.ID]*mutedKeywordsCacheEntry)
+	}
+	mc.entries[user] = &mutedKeywordsCacheEntry{re: re, fetchedAt: time.Now()}
+	return re, nil
+}
+
+// invalidate removes the muted keywords of user from the cache.
+func (mc *mutedKeywordsCacheStore) invalidate(user uid.ID) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	delete(mc.entries, user)
+}
+
+// filterMutedPosts removes the posts whose title or body matches re (the
+// compiled muted keywords of a user), if re is not nil.
+func filterMutedPosts(posts []*Post, re *regexp.Regexp) []*Post {
+	if re == nil {
+		return posts
+	}
+	kept := posts[:0:0]
+	for _, p := range posts {
+		if !re.MatchString(p.Title + " " + p.Body.String) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// filterMutedComments removes the comments whose body matches re (the compiled
+// muted keywords of a user), if re is not nil.
+func filterMutedComments(comments []*Comment, re *regexp.Regexp) []*Comment {
+	if re == nil {
+		return comments
+	}
+	kept := comments[:0:0]
+	for _, c := range comments {
+		if !re.MatchString(c.Body) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// normalizeMutedDomain extracts the domain from s, which can either be a domain
+// or a URL. It returns the domain in the form in which it's saved in the
+// link_domain column of posts.
+func normalizeMutedDomain(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", errInvalidMutedDomain
+		}
+		s = u.Hostname()
+	} else if i := strings.IndexAny(s, "/:"); i != -1 {
+		s = s[:i]
+	}
+	s = linkDomain(s)
+	if len(s) < 3 || len(s) > 255 || !strings.Contains(s, ".") || strings.ContainsAny(s, " \t\n") {
+		return "", errInvalidMutedDomain
+	}
+	return s, nil
+}
+
+// GetMutedKeywords returns the keyword mutes of user.
+func GetMutedKeywords(ctx context.Context, db *sql.DB, user uid.ID) ([]*Mute, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, keyword, created_at FROM muted_keywords WHERE user_id = ? ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mutes []*Mute
+	for rows.Next() {
+		mute := &Mute{User: user, Type: MuteTypeKeyword, MutedKeyword: new(string)}
+		if err := rows.Scan(&mute.ID, mute.MutedKeyword, &mute.CreatedAt); err != nil {
+			return nil, err
+		}
+		mute.setPrintID()
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
+
+// GetMutedDomains returns the domain mutes of user.
+func GetMutedDomains(ctx context.Context, db *sql.DB, user uid.ID) ([]*Mute, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, domain, created_at FROM muted_domains WHERE user_id = ? ORDER BY id", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mutes []*Mute
+	for rows.Next() {
+		mute := &Mute{User: user, Type: MuteTypeDomain, MutedDomain: new(string)}
+		if err := rows.Scan(&mute.ID, mute.MutedDomain, &mute.CreatedAt); err != nil {
+			return nil, err
+		}
+		mute.setPrintID()
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
+
+// countMutes returns the number of rows of user in table, which is one of the
+// mutes tables.
+func countMutes(ctx context.Context, db *sql.DB, table string, user uid.ID) (n int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", user).Scan(&n)
+	return
+}
+
+// MuteKeyword mutes keyword (a word or a phrase, case-insensitive) for user.
+func MuteKeyword(ctx context.Context, db *sql.DB, user uid.ID, keyword string) error {
+	keyword, err := normalizeMutedKeyword(keyword)
+	if err != nil {
+		return err
+	}
+	if n, err := countMutes(ctx, db, "muted_keywords", user); err != nil {
+		return err
+	} else if n >= maxMutesPerType {
+		return errTooManyMutes
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO muted_keywords (user_id, keyword, pattern) VALUES (?, ?, ?)", user, keyword, mutedKeywordPattern(keyword))
+	mutedKeywordsCache.invalidate(user)
+	if err != nil && msql.IsErrDuplicateErr(err) {
+		return nil
+	}
+	return err
+}
+
+// MuteDomain mutes the link posts to domain (which may also be given as a URL)
+// for user.
+func MuteDomain(ctx context.Context, db *sql.DB, user uid.ID, domain string) error {
+	domain, err := normalizeMutedDomain(domain)
+	if err != nil {
+		return err
+	}
+	if n, err := countMutes(ctx, db, "muted_domains", user); err != nil {
+		return err
+	} else if n >= maxMutesPerType {
+		return errTooManyMutes
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO muted_domains (user_id, domain) VALUES (?, ?)", user, domain)
+	if err != nil && msql.IsErrDuplicateErr(err) {
+		return nil
+	}
+	return err
+}
@@ -1,7 +1,11 @@
 package core
 
 import (
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/discuitnet/discuit/internal/uid"
 )
 
 func TestExtractMuteID(t *testing.T) {
@@ -13,6 +17,8 @@ func TestExtractMuteID(t *testing.T) {
 	}{
 		{"c_1", MuteTypeCommunity, 1, false},
 		{"u_1234", MuteTypeUser, 1234, false},
+		{"k_12", MuteTypeKeyword, 12, false},
+		{"d_7", MuteTypeDomain, 7, false},
 		{"", "", 0, true},
 		{"1234", "", 0, true},
 		{"c_", "", 0, true},
@@ -25,3 +31,114 @@ func TestExtractMuteID(t *testing.T) {
 
 	}
 }
+
+func TestMutedKeywordPattern(t *testing.T) {
+	cases := []struct {
+		keyword, text string
+		match         bool
+	}{
+		{"rust", "Rust 2.0 released", true},
+		{"rust", "Learning rust.", true},
+		{"rust", "trusted sources", false},
+		{"c++", "I like c++ a lot", true},
+		{"c++", "c++", true},
+		{"c++", "cpp", false},
+		{"world cup", "The World Cup final", true},
+		{"world cup", "world cupboard", false},
+	}
+	for _, item := range cases {
+		keyword, err := normalizeMutedKeyword(item.keyword)
+		if err != nil {
+			t.Fatalf("normalizeMutedKeyword(%q): %v", item.keyword, err)
+		}
+		re := regexp.MustCompile("(?i)" + mutedKeywordPattern(keyword))
+		if got := re.MatchString(item.text); got != item.match {
+			t.Errorf("keyword %q on %q: got %v, want %v", item.keyword, item.text, got, item.match)
+		}
+	}
+}
+
+func TestNormalizeMutedKeyword(t *testing.T) {
+	if got, err := normalizeMutedKeyword("  World   CUP "); err != nil || got != "world cup" {
+		t.Errorf("got (%q, %v)", got, err)
+	}
+	for _, keyword := range []string{"", "   ", strings.Repeat("a", maxMutedKeywordLength+1)} {
+		if _, err := normalizeMutedKeyword(keyword); err == nil {
+			t.Errorf("normalizeMutedKeyword(%q) succeeded", keyword)
+		}
+	}
+}
+
+func TestNormalizeMutedDomain(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"example.com", "example.com"},
+		{"WWW.Example.com", "example.com"},
+		{"https://www.example.com/path?q=1", "example.com"},
+		{"blog.example.com/posts", "blog.example.com"},
+		{"example.com:8080", "example.com"},
+		{"localhost", ""},
+		{"", ""},
+	}
+	for _, item := range cases {
+		got, err := normalizeMutedDomain(item.in)
+		if item.want == "" {
+			if err == nil {
+				t.Errorf("normalizeMutedDomain(%q) = %q, want error", item.in, got)
+			}
+		} else if got != item.want {
+			t.Errorf("normalizeMutedDomain(%q) = (%q, %v), want %q", item.in, got, err, item.want)
+		}
+	}
+}
+
+func TestRemoveOrphanComments(t *testing.T) {
+	root, a, b, c, d := uid.New(), uid.New(), uid.New(), uid.New(), uid.New()
+	comments := []*Comment{
+		{ID: a, Ancestors: []uid.ID{root}},
+		{ID: b, Ancestors: []uid.ID{root, a}},
+		{ID: d, Ancestors: []uid.ID{root, c}}, // c is missing.
+	}
+	got := removeOrphanComments(comments, &root)
+	if len(got) != 2 || got[0].ID != a || got[1].ID != b {
+		t.Errorf("removeOrphanComments with root: got %d comments", len(got))
+	}
+	if got := removeOrphanComments(comments, nil); len(got) != 0 {
+		t.Errorf("removeOrphanComments without root: got %d comments, want 0", len(got))
+	}
+}
+
+func TestWhereMutedDomains(t *testing.T) {
+	viewer := uid.New()
+	for _, table := range []string{"posts", "posts_today"} {
+		where, args := whereMutedDomains("WHERE ", table, nil, viewer)
+		if n := strings.Count(where, "?"); n != len(args) {
+			t.Errorf("table %s: %d placeholders but %d args", table, n, len(args))
+		}
+	}
+}
+
+func TestCompileMutedKeywords(t *testing.T) {
+	if re, err := compileMutedKeywords(nil); err != nil || re != nil {
+		t.Errorf("compileMutedKeywords(nil) = %v, %v; want nil, nil", re, err)
+	}
+	re, err := compileMutedKeywords([]string{mutedKeywordPattern("go"), mutedKeywordPattern("c++")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		text string
+		want bool
+	}{
+		{"Learning Go today", true},
+		{"Google", false},
+		{"Why C++ is hard", true},
+		{"Nothing here", false},
+	}
+	for _, c := range cases {
+		if got := re.MatchString(c.text); got != c.want {
+			t.Errorf("MatchString(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
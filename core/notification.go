@@ -193,15 +193,19 @@ func SendPushNotification(ctx context.Context, db *sql.DB, user uid.ID, payload
 type NotificationType string
 
 const (
-	NotificationTypeNewComment   = NotificationType("new_comment")
-	NotificationTypeCommentReply = NotificationType("comment_reply")
-	NotificationTypeUpvote       = NotificationType("new_votes") // TODO: change string
-	NotificationTypeDeletePost   = NotificationType("deleted_post")
-	NotificationTypeModAdd       = NotificationType("mod_add")
-	NotificationTypeNewBadge     = NotificationType("new_badge")
-	NotificationTypeWelcome      = NotificationType("welcome")
-	NotificationTypeAnnouncement = NotificationType("announcement")
-	NotificationTypeDeniedComm   = NotificationType("denied_comm")
+	NotificationTypeNewComment     = NotificationType("new_comment")
+	NotificationTypeCommentReply   = NotificationType("comment_reply")
+	NotificationTypeUpvote         = NotificationType("new_votes") // TODO: change string
+	NotificationTypeDeletePost     = NotificationType("deleted_post")
+	NotificationTypeModAdd         = NotificationType("mod_add")
+	NotificationTypeNewBadge       = NotificationType("new_badge")
+	NotificationTypeWelcome        = NotificationType("welcome")
+	NotificationTypeAnnouncement   = NotificationType("announcement")
+	NotificationTypeDeniedComm     = NotificationType("denied_comm")
+	NotificationTypeReportResolved = NotificationType("report_resolved")
+	NotificationTypeBanned         = NotificationType("banned")
+	NotificationTypeNewMessage     = NotificationType("new_message")
+	NotificationTypeModmail        = NotificationType("modmail")
 )
 
 func (t NotificationType) Valid() bool {
@@ -215,6 +219,10 @@ func (t NotificationType) Valid() bool {
 		NotificationTypeWelcome,
 		NotificationTypeAnnouncement,
 		NotificationTypeDeniedComm,
+		NotificationTypeReportResolved,
+		NotificationTypeBanned,
+		NotificationTypeNewMessage,
+		NotificationTypeModmail,
 	}, t)
 }
 
@@ -432,6 +440,14 @@ func scanNotifications(ctx context.Context, db *sql.DB, rows *sql.Rows, render b
 			nc = &NotificationAnnouncement{}
 		case NotificationTypeDeniedComm:
 			nc = &NotificationDeniedComm{}
+		case NotificationTypeReportResolved:
+			nc = &NotificationReportResolved{}
+		case NotificationTypeBanned:
+			nc = &NotificationBanned{}
+		case NotificationTypeNewMessage:
+			nc = &NotificationNewMessage{}
+		case NotificationTypeModmail:
+			nc = &NotificationModmail{}
 		default:
 			return nil, fmt.Errorf("unknown notification type: %s", string(notif.Type))
 		}
@@ -1467,3 +1483,228 @@ func SendAnnouncementNotifications(ctx context.Context, db *sql.DB, post uid.ID)
 	}
 	return nil
 }
+
+// NotificationReportResolved is sent to the users who reported a post or a
+// comment when a moderator takes action on it.
+type NotificationReportResolved struct {
+	CommunityName string       `json:"communityName"`
+	TargetType    string       `json:"targetType"` // post or comment
+	TargetID      uid.ID       `json:"targetId"`
+	PostPublicID  string       `json:"postPublicId"`
+	Action        ReportAction `json:"action"`
+}
+
+func (n NotificationReportResolved) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func (n NotificationReportResolved) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	var action string
+	switch n.Action {
+	case ReportActionPostRemoved, ReportActionCommentRemoved:
+		action = "removed"
+	case ReportActionLocked:
+		action = "locked"
+	case ReportActionUserBanned:
+		action = "reviewed and its author banned"
+	default:
+		action = "reviewed"
+	}
+	view := &NotificationView{
+		ToURL: fmt.Sprintf("/%s/post/%s", n.CommunityName, n.PostPublicID),
+		Title: fmt.Sprintf("Thanks for your report. The %s you reported in %s has been %s by the moderators.", n.TargetType, encloseInBold(format, n.CommunityName), action),
+	}
+	if n.TargetType == "comment" {
+		view.ToURL += "/" + n.TargetID.String()
+	}
+	view.setIcon(nil)
+	return view, nil
+}
+
+// NotificationBanned is sent to a user who's banned from a community, or from
+// the site.
+type NotificationBanned struct {
+	CommunityName string     `json:"communityName"` // Empty for site-wide bans.
+	Reason        string     `json:"reason"`
+	ExpiresAt     *time.Time `json:"expiresAt"` // Nil for permanent bans.
+}
+
+func (n NotificationBanned) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func (n NotificationBanned) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	view := &NotificationView{
+		ToURL: "/", // Not "#", as this notification is sent as a push notification.
+		Body:  n.Reason,
+	}
+	from := "the site"
+	if n.CommunityName != "" {
+		from = encloseInBold(format, n.CommunityName)
+		view.ToURL = "/" + n.CommunityName
+	}
+	if n.ExpiresAt != nil {
+		view.Title = fmt.Sprintf("You have been banned from %s until %s", from, n.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"))
+	} else {
+		view.Title = fmt.Sprintf("You have been permanently banned from %s", from)
+	}
+	view.setIcon(nil)
+	return view, nil
+}
+
+// CreateBannedNotification creates a notification of type banned. If community
+// is empty, the ban is a site-wide one.
+func CreateBannedNotification(ctx context.Context, db *sql.DB, user uid.ID, community string, expires *time.Time, reason string) error {
+	n := NotificationBanned{
+		CommunityName: community,
+		Reason:        reason,
+		ExpiresAt:     expires,
+	}
+	return CreateNotification(ctx, db, user, NotificationTypeBanned, n)
+}
+
+// NotificationNewMessage is sent to the recipient of a private message.
+type NotificationNewMessage struct {
+	ConversationID uid.ID `json:"conversationId"`
+	MessageID      uid.ID `json:"messageId"` // The first unseen message.
+	Sender         string `json:"sender"`
+
+	// If NumMessages > 1, many messages have been received in the conversation
+	// since the notification was last seen.
+	NumMessages int `json:"noMessages"`
+}
+
+func (n NotificationNewMessage) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	type T NotificationNewMessage
+	out := struct {
+		T
+		SenderUser *User `json:"senderUser"`
+	}{T: (T)(n)}
+
+	user, err := GetUserByUsername(ctx, db, n.Sender, nil)
+	if err != nil {
+		return nil, err
+	}
+	out.SenderUser = user
+	return json.Marshal(out)
+}
+
+func (n NotificationNewMessage) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	user, err := GetUserByUsername(ctx, db, n.Sender, nil)
+	if err != nil {
+		return nil, err
+	}
+	view := &NotificationView{
+		ToURL: "/messages/" + n.ConversationID.String(),
+	}
+	if n.NumMessages > 1 {
+		view.Title = fmt.Sprintf("%d new messages from %s", n.NumMessages, encloseInBold(format, n.Sender))
+	} else {
+		view.Title = fmt.Sprintf("%s sent you a message", encloseInBold(format, n.Sender))
+		if message, err := GetMessage(ctx, db, n.MessageID); err != nil {
+			return nil, err
+		} else if !message.Deleted {
+			view.Body = utils.TruncateUnicodeString(message.Body, 200)
+		}
+	}
+	view.setIcon(user)
+	return view, nil
+}
+
+// CreateNewMessageNotification creates a notification of type new_message. If
+// an unseen notification of the same conversation exists in the last 10
+// items, it is updated instead.
+func CreateNewMessageNotification(ctx context.Context, db *sql.DB, receiver uid.ID, message *Message, sender *User) error {
+	notifs, _, err := GetNotifications(ctx, db, receiver, 10, "", false, "")
+	if err != nil {
+		return err
+	}
+	for _, notif := range notifs {
+		if notif.Type == NotificationTypeNewMessage && !notif.Seen {
+			nm := notif.Notif.(*NotificationNewMessage)
+			if nm.ConversationID.EqualsTo(message.ConversationID) {
+				nm.NumMessages++
+				return notif.Update(ctx)
+			}
+		}
+	}
+
+	n := NotificationNewMessage{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		Sender:         sender.Username,
+		NumMessages:    1,
+	}
+	return CreateNotification(ctx, db, receiver, NotificationTypeNewMessage, n)
+}
+
+// NotificationModmail is for a new message in a modmail thread. It is sent to
+// the moderators of the community if the message is by the user who opened
+// the thread, and to that user if the message is by the moderators.
+type NotificationModmail struct {
+	ThreadID      uid.ID `json:"threadId"`
+	CommunityName string `json:"communityName"`
+	Subject       string `json:"subject"`
+	ToMods        bool   `json:"toMods"`
+
+	// If NumMessages > 1, many messages have been added to the thread since
+	// the notification was last seen.
+	NumMessages int `json:"noMessages"`
+}
+
+func (n NotificationModmail) marshalJSONForAPI(ctx context.Context, db *sql.DB) ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func (n NotificationModmail) view(ctx context.Context, db *sql.DB, format TextFormat) (*NotificationView, error) {
+	community, err := GetCommunityByName(ctx, db, n.CommunityName, nil)
+	if err != nil {
+		return nil, err
+	}
+	view := &NotificationView{}
+	if n.ToMods {
+		view.ToURL = fmt.Sprintf("/%s/modtools/modmail/%s", n.CommunityName, n.ThreadID)
+		if n.NumMessages > 1 {
+			view.Title = fmt.Sprintf("%d new modmail messages in %s: %s", n.NumMessages, encloseInBold(format, n.CommunityName), encloseInBold(format, n.Subject))
+		} else {
+			view.Title = fmt.Sprintf("New modmail in %s: %s", encloseInBold(format, n.CommunityName), encloseInBold(format, n.Subject))
+		}
+	} else {
+		view.ToURL = "/modmail/" + n.ThreadID.String()
+		if n.NumMessages > 1 {
+			view.Title = fmt.Sprintf("%d new replies from the moderators of %s to %s", n.NumMessages, encloseInBold(format, n.CommunityName), encloseInBold(format, n.Subject))
+		} else {
+			view.Title = fmt.Sprintf("The moderators of %s replied to %s", encloseInBold(format, n.CommunityName), encloseInBold(format, n.Subject))
+		}
+	}
+	view.setIcon(community)
+	return view, nil
+}
+
+// CreateModmailNotification creates a notification of type modmail for user.
+// If an unseen notification of the same thread exists in the last 10 items,
+// it is updated instead.
+func CreateModmailNotification(ctx context.Context, db *sql.DB, user uid.ID, thread *ModmailThread, toMods bool) error {
+	notifs, _, err := GetNotifications(ctx, db, user, 10, "", false, "")
+	if err != nil {
+		return err
+	}
+	for _, notif := range notifs {
+		if notif.Type == NotificationTypeModmail && !notif.Seen {
+			nm := notif.Notif.(*NotificationModmail)
+			if nm.ThreadID.EqualsTo(thread.ID) {
+				nm.NumMessages++
+				return notif.Update(ctx)
+			}
+		}
+	}
+
+	n := NotificationModmail{
+		ThreadID:      thread.ID,
+		CommunityName: thread.CommunityName,
+		Subject:       thread.Subject,
+		ToMods:        toMods,
+		NumMessages:   1,
+	}
+	return CreateNotification(ctx, db, user, NotificationTypeModmail, n)
+}
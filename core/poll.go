@@ -0,0 +1,314 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	minPollOptions         = 2
+	maxPollOptions         = 10
+	maxPollOptionLength    = 140 // in runes.
+	maxPollDuration        = time.Hour * 24 * 90
+	pollClosesAtMinimumGap = time.Minute * 5
+)
+
+var (
+	errNotPoll       = httperr.NewBadRequest("post/not-poll", "Post is not a poll.")
+	errPollClosed    = httperr.NewForbidden("poll-closed", "Poll is closed.")
+	errPollVoted     = httperr.NewForbidden("poll-already-voted", "You have already voted in this poll.")
+	errInvalidOption = httperr.NewBadRequest("poll-invalid-option", "Invalid poll option.")
+)
+
+// Poll is the poll of a post of type [PostTypePoll].
+type Poll struct {
+	MultipleChoice bool          `json:"multipleChoice"`
+	ClosesAt       msql.NullTime `json:"closesAt"` // If null, the poll never closes.
+	Closed         bool          `json:"closed"`
+	Options        []*PollOption `json:"options"`
+
+	// ResultsVisible is true if either the poll is closed or the viewer has
+	// voted. Otherwise, NumVoters and the vote counts of the options are null.
+	ResultsVisible bool `json:"resultsVisible"`
+	NumVoters      *int `json:"noVoters"`
+
+	// The IDs of the options the viewer voted for (empty if the viewer hasn't
+	// voted).
+	ViewerVotes []int `json:"viewerVotes"`
+}
+
+// PollOption is an option of a poll.
+type PollOption struct {
+	ID       int    `json:"id"`
+	Text     string `json:"text"`
+	NumVotes *int   `json:"noVotes"`
+}
+
+// pollOpts are the options used to create a poll.
+type pollOpts struct {
+	options        []string
+	multipleChoice bool
+	closesAt       *time.Time
+}
+
+// newPollOpts validates the options of a new poll and returns them, cleaned
+// up. The poll closes at closesAt, unless it's nil.
+func newPollOpts(options []string, multipleChoice bool, closesAt *time.Time, now time.Time) (*pollOpts, error) {
+	if len(options) < minPollOptions || len(options) > maxPollOptions {
+		return nil, httperr.NewBadRequest("poll-options-count", fmt.Sprintf("A poll must have between %d and %d options.", minPollOptions, maxPollOptions))
+	}
+	opts := &pollOpts{multipleChoice: multipleChoice}
+	seen := make(map[string]bool)
+	for _, option := range options {
+		option = utils.TruncateUnicodeString(strings.TrimSpace(option), maxPollOptionLength)
+		if option == "" {
+			return nil, httperr.NewBadRequest("poll-option-empty", "Poll option is empty.")
+		}
+		key := strings.ToLower(option)
+		if seen[key] {
+			return nil, httperr.NewBadRequest("poll-option-duplicate", "Poll options must be unique.")
+		}
+		seen[key] = true
+		opts.options = append(opts.options, option)
+	}
+	if closesAt != nil {
+		if closesAt.Before(now.Add(pollClosesAtMinimumGap)) || closesAt.After(now.Add(maxPollDuration)) {
+			return nil, httperr.NewBadRequest("poll-invalid-closes-at", "Invalid poll closing time.")
+		}
+		t := closesAt.UTC()
+		opts.closesAt = &t
+	}
+	return opts, nil
+}
+
+// insertPoll saves the poll of post, as part of tx.
+func insertPoll(ctx context.Context, tx *sql.Tx, post uid.ID, opts *pollOpts) error {
+	var closesAt msql.NullTime
+	if opts.closesAt != nil {
+		closesAt = msql.NewNullTime(*opts.closesAt)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO polls (post_id, multiple_choice, closes_at) VALUES (?, ?, ?)", post, opts.multipleChoice, closesAt); err != nil {
+		return err
+	}
+	var rows [][]msql.ColumnValue
+	for i, option := range opts.options {
+		rows = append(rows, []msql.ColumnValue{
+			{Name: "post_id", Value: post},
+			{Name: "position", Value: i},
+			{Name: "text", Value: option},
+		})
+	}
+	query, args := msql.BuildInsertQuery("poll_options", rows...)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// CreatePollPost creates a poll post. The poll closes at closesAt, unless it's
+// nil.
+func CreatePollPost(ctx context.Context, db *sql.DB, author, community uid.ID, title, body string, options []string, multipleChoice bool, closesAt *time.Time, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
+	poll, err := newPollOpts(options, multipleChoice, closesAt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return createPost(ctx, db, &createPostOpts{
+		postType:  PostTypePoll,
+		author:    author,
+		community: community,
+		title:     title,
+		body:      body,
+		poll:      poll,
+
+		newUserPointsThreshold: newUserPointsThreshold,
+		newUserAgeThreshold:    newUserAgeThreshold,
+	})
+}
+
+// populatePostsPolls sets the Poll field of the poll posts in posts, with the
+// results only included where viewer (which may be nil) is allowed to see
+// them.
+func populatePostsPolls(ctx context.Context, db *sql.DB, posts []*Post, viewer *uid.ID) error {
+	polls := make(map[uid.ID]*Poll)
+	var ids []any
+	for _, post := range posts {
+		if post.Type == PostTypePoll {
+			if _, ok := polls[post.ID]; !ok {
+				polls[post.ID] = &Poll{Options: []*PollOption{}, ViewerVotes: []int{}}
+				ids = append(ids, post.ID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	in := msql.InClauseQuestionMarks(len(ids))
+
+	// The polls.
+	rows, err := db.QueryContext(ctx, "SELECT post_id, multiple_choice, closes_at, no_voters FROM polls WHERE post_id IN "+in, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	now := time.Now()
+	for rows.Next() {
+		var (
+			postID    uid.ID
+			numVoters int
+		)
+		p := &Poll{}
+		if err := rows.Scan(&postID, &p.MultipleChoice, &p.ClosesAt, &numVoters); err != nil {
+			return err
+		}
+		p.Options, p.ViewerVotes = []*PollOption{}, []int{}
+		polls[postID] = p
+		p.Closed = p.ClosesAt.Valid && !now.Before(p.ClosesAt.Time)
+		p.NumVoters = &numVoters
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The options.
+	rows, err = db.QueryContext(ctx, "SELECT id, post_id, text, no_votes FROM poll_options WHERE post_id IN "+in+" ORDER BY position", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			postID   uid.ID
+			numVotes int
+		)
+		option := &PollOption{NumVotes: &numVotes}
+		if err := rows.Scan(&option.ID, &postID, &option.Text, &numVotes); err != nil {
+			return err
+		}
+		polls[postID].Options = append(polls[postID].Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The viewer's votes.
+	if viewer != nil {
+		rows, err = db.QueryContext(ctx, "SELECT post_id, option_id FROM poll_votes WHERE user_id = ? AND post_id IN "+in, append([]any{*viewer}, ids...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				postID uid.ID
+				option int
+			)
+			if err := rows.Scan(&postID, &option); err != nil {
+				return err
+			}
+			polls[postID].ViewerVotes = append(polls[postID].ViewerVotes, option)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, poll := range polls {
+		poll.ResultsVisible = poll.Closed || len(poll.ViewerVotes) > 0
+		if !poll.ResultsVisible {
+			poll.NumVoters = nil
+			for _, option := range poll.Options {
+				option.NumVotes = nil
+			}
+		}
+	}
+	for _, post := range posts {
+		if post.Type == PostTypePoll {
+			post.Poll = polls[post.ID]
+		}
+	}
+	return nil
+}
+
+// VotePoll records the vote of user, for the options with IDs options, in the
+// poll of p. A user can vote only once in a poll, and, unless the poll is
+// multiple-choice, for exactly one option.
+func (p *Post) VotePoll(ctx context.Context, db *sql.DB, user uid.ID, options []int) error {
+	if p.Type != PostTypePoll {
+		return errNotPoll
+	}
+	if p.Deleted {
+		return errPostNotFound
+	}
+	if p.Locked {
+		return errPostLocked
+	}
+	if is, err := IsUserBannedFromCommunity(ctx, db, p.CommunityID, user); err != nil {
+		return err
+	} else if is {
+		return errUserBannedFromCommunity
+	}
+	if len(options) == 0 {
+		return errInvalidOption
+	}
+
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var (
+			multipleChoice bool
+			closesAt       msql.NullTime
+		)
+		// Lock the poll row so that concurrent votes of the same user are
+		// serialized.
+		if err := tx.QueryRowContext(ctx, "SELECT multiple_choice, closes_at FROM polls WHERE post_id = ? FOR UPDATE", p.ID).Scan(&multipleChoice, &closesAt); err != nil {
+			if err == sql.ErrNoRows {
+				return errNotPoll
+			}
+			return err
+		}
+		if closesAt.Valid && !time.Now().Before(closesAt.Time) {
+			return errPollClosed
+		}
+		if !multipleChoice && len(options) != 1 {
+			return httperr.NewBadRequest("poll-single-choice", "Only one option can be chosen in this poll.")
+		}
+
+		var voted int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM poll_votes WHERE post_id = ? AND user_id = ?", p.ID, user).Scan(&voted); err != nil {
+			return err
+		}
+		if voted > 0 {
+			return errPollVoted
+		}
+
+		seen := make(map[int]bool)
+		for _, option := range options {
+			if seen[option] {
+				return errInvalidOption
+			}
+			seen[option] = true
+			res, err := tx.ExecContext(ctx, "UPDATE poll_options SET no_votes = no_votes + 1 WHERE id = ? AND post_id = ?", option, p.ID)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return errInvalidOption
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO poll_votes (post_id, option_id, user_id) VALUES (?, ?, ?)", p.ID, option, user); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE polls SET no_voters = no_voters + 1 WHERE post_id = ?", p.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return populatePostsPolls(ctx, db, []*Post{p}, &user)
+}
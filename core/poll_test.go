@@ -0,0 +1,32 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewPollOpts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	tooLate := now.Add(maxPollDuration + time.Hour)
+	cases := []struct {
+		options  []string
+		closesAt *time.Time
+		valid    bool
+	}{
+		{[]string{"a", "b"}, nil, true},
+		{[]string{"a", "b", "c"}, &hour, true},
+		{[]string{"a"}, nil, false},
+		{[]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}, nil, false},
+		{[]string{"a", " "}, nil, false},
+		{[]string{"Yes", "yes "}, nil, false},
+		{[]string{"a", "b"}, &past, false},
+		{[]string{"a", "b"}, &tooLate, false},
+	}
+	for _, item := range cases {
+		if _, err := newPollOpts(item.options, false, item.closesAt, now); (err == nil) != item.valid {
+			t.Errorf("newPollOpts(%q, %v) = %v, want valid: %v", item.options, item.closesAt, err, item.valid)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +42,7 @@ const (
 	PostTypeText = PostType(iota)
 	PostTypeImage
 	PostTypeLink
+	PostTypePoll
 )
 
 // Valid reports whether t is a valid PostType.
@@ -59,6 +61,8 @@ func (t PostType) MarshalText() ([]byte, error) {
 		s = "image"
 	case PostTypeLink:
 		s = "link"
+	case PostTypePoll:
+		s = "poll"
 	default:
 		return nil, errPostTypeUnsupported
 	}
@@ -74,6 +78,8 @@ func (p *PostType) UnmarshalText(text []byte) error {
 		*p = PostTypeImage
 	case "link":
 		*p = PostTypeLink
+	case "poll":
+		*p = PostTypePoll
 	default:
 		return errPostTypeUnsupported
 	}
@@ -118,6 +124,17 @@ type Post struct {
 
 	Link *PostLink `json:"link,omitempty"` // what's sent to the client
 
+	Poll *Poll `json:"poll,omitempty"` // Only for poll posts.
+
+	flairID msql.NullInt32 `json:"-"`
+	Flair   *Flair         `json:"flair"`
+
+	crosspostOf uid.NullID    `json:"-"`
+	CrosspostOf *AbridgedPost `json:"crosspostOf"` // The original post, if the post is a crosspost.
+
+	// Populated only by FetchCrossposts.
+	Crossposts []*AbridgedPost `json:"crossposts,omitempty"`
+
 	Locked   bool       `json:"locked"`
 	LockedBy uid.NullID `json:"lockedBy"`
 
@@ -131,6 +148,8 @@ type Post struct {
 	Points    int `json:"-"` // Upvotes - Downvotes
 
 	Hotness        int           `json:"hotness"`
+	controversy    int           // See PostControversy.
+	rising         int           // See PostRisingScore.
 	CreatedAt      time.Time     `json:"createdAt"`
 	EditedAt       msql.NullTime `json:"editedAt"`
 	LastActivityAt time.Time     `json:"lastActivityAt"`
@@ -148,6 +167,10 @@ type Post struct {
 	DeletedContentBy uid.NullID    `json:"-"`
 	DeletedContentAs UserGroup     `json:"deletedContentAs,omitempty"`
 
+	// Pending is true if the post is held for approval by the mods. Pending
+	// posts are not shown in feeds.
+	Pending bool `json:"pending"`
+
 	NumComments  int             `json:"noComments"`
 	Comments     []*Comment      `json:"comments"`
 	CommentsNext msql.NullString `json:"commentsNext"` // pagination cursor
@@ -193,6 +216,8 @@ var selectPostCols = []string{
 	"posts.downvotes",
 	"posts.points",
 	"posts.hotness",
+	"posts.controversy",
+	"posts.rising",
 	"posts.created_at",
 	"posts.edited_at",
 	"posts.last_activity_at",
@@ -205,6 +230,9 @@ var selectPostCols = []string{
 	"posts.deleted_content_at",
 	"posts.deleted_content_by",
 	"posts.deleted_content_as",
+	"posts.pending",
+	"posts.flair_id",
+	"posts.crosspost_of",
 }
 
 var selectPostJoins = []string{
@@ -336,6 +364,8 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.Downvotes,
 			&post.Points,
 			&post.Hotness,
+			&post.controversy,
+			&post.rising,
 			&post.CreatedAt,
 			&post.EditedAt,
 			&post.LastActivityAt,
@@ -348,6 +378,9 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&post.DeletedContentAt,
 			&post.DeletedContentBy,
 			&post.DeletedContentAs,
+			&post.Pending,
+			&post.flairID,
+			&post.crosspostOf,
 		}
 
 		linkImage := &images.Image{}
@@ -426,6 +459,18 @@ func scanPosts(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 		return nil, err
 	}
 
+	if err := populatePostsPolls(ctx, db, posts, viewer); err != nil {
+		return nil, err
+	}
+
+	if err := populatePostsFlairs(ctx, db, posts); err != nil {
+		return nil, err
+	}
+
+	if err := populatePostsCrosspostOf(ctx, db, posts); err != nil {
+		return nil, err
+	}
+
 	if loggedIn {
 		if err := populateNewCommentsCounts(ctx, db, posts, viewer); err != nil {
 			return nil, err
@@ -636,6 +681,43 @@ type ImageUpload struct {
 	Caption string `json:"caption"`
 }
 
+// checkUserCanPost returns an error if user is not allowed to post in
+// community.
+func checkUserCanPost(ctx context.Context, db *sql.DB, community, user uid.ID) error {
+	comm, err := GetCommunityByID(ctx, db, community, nil)
+	if err != nil {
+		return err
+	}
+
+	banned, err := comm.UserBanned(ctx, db, user)
+	if err != nil {
+		return err
+	}
+	modOrAdmin := false
+	if comm.PostingRestricted {
+		if modOrAdmin, err = comm.UserModOrAdmin(ctx, db, user); err != nil {
+			return err
+		}
+	}
+	return communityAllowsPosting(comm, banned, modOrAdmin)
+}
+
+// communityAllowsPosting returns an error if a user, who is banned from comm
+// if banned is true, and who is a mod of comm (or an admin) if modOrAdmin is
+// true, is not allowed to post in comm.
+func communityAllowsPosting(comm *Community, banned, modOrAdmin bool) error {
+	// Check if the author is banned from community.
+	if banned {
+		return errUserBannedFromCommunity
+	}
+
+	// Check if posting in the community is restricted, and if so, if the user has permission.
+	if comm.PostingRestricted && !modOrAdmin {
+		return httperr.NewForbidden("posting-restricted", "Posting in this community is restricted.")
+	}
+	return nil
+}
+
 type createPostOpts struct {
 	// Required:
 	author    uid.ID
@@ -649,6 +731,13 @@ type createPostOpts struct {
 	linkImage []byte // for link posts (thumbnail image)
 	// image     uid.ID // for image posts
 	images []*ImageUpload // for image posts
+	poll   *pollOpts      // for poll posts
+
+	crosspostOf *uid.ID // for crossposts (which are text posts)
+
+	// For PostApprovalNewUsers:
+	newUserPointsThreshold int
+	newUserAgeThreshold    time.Duration
 }
 
 func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, error) {
@@ -656,32 +745,32 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, err
 	}
 
-	community, err := GetCommunityByID(ctx, db, opts.community, nil)
-	if err != nil {
+	if err := checkUserCanPost(ctx, db, opts.community, opts.author); err != nil {
 		return nil, err
 	}
 
-	// Check if the author is banned from community.
-	if is, err := community.UserBanned(ctx, db, opts.author); err != nil {
+	// Truncate title and body if max lengths are exceeded.
+	var post Post
+	post.Title = opts.title
+	post.Body.Valid, post.Body.String = opts.body != "", opts.body
+	post.truncateTitleAndBody()
+
+	automod, err := evaluateAutomod(ctx, db, opts.community, opts.author, &automodSubject{
+		contentType: ContentTypePost,
+		title:       post.Title,
+		body:        post.Body.String,
+		domain:      linkDomain(opts.link.Hostname),
+	}, false)
+	if err != nil {
 		return nil, err
-	} else if is {
-		return nil, errUserBannedFromCommunity
 	}
-
-	// Check if posting in the community is restricted, and if so, if the user has permission.
-	if community.PostingRestricted {
-		if is, err := community.UserModOrAdmin(ctx, db, opts.author); err != nil {
+	post.Pending = automod.has(AutomodActionHold)
+	if !post.Pending {
+		if post.Pending, err = postRequiresApproval(ctx, db, opts.community, opts.author, opts.newUserPointsThreshold, opts.newUserAgeThreshold); err != nil {
 			return nil, err
-		} else if !is {
-			return nil, httperr.NewForbidden("posting-restricted", "Posting in this community is restricted.")
 		}
 	}
 
-	// Truncate title and body if max lengths are exceeded.
-	var post Post
-	post.Title = opts.title
-	post.Body.Valid, post.Body.String = opts.body != "", opts.body
-	post.truncateTitleAndBody()
 	post.CreatedAt = time.Now()
 	post.ID = uid.New()
 	post.PublicID = utils.GenerateStringID(publicPostIDLength)
@@ -696,6 +785,7 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		{Name: "body", Value: post.Body},
 		{Name: "created_at", Value: post.CreatedAt},
 		{Name: "hotness", Value: PostHotness(0, 0, post.CreatedAt)},
+		{Name: "pending", Value: post.Pending},
 	}
 
 	if opts.postType == PostTypeLink {
@@ -704,6 +794,10 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 			return nil, err
 		}
 		cols = append(cols, msql.ColumnValue{Name: "link_info", Value: data})
+		cols = append(cols, msql.ColumnValue{Name: "link_domain", Value: linkDomain(opts.link.Hostname)})
+	}
+	if opts.crosspostOf != nil {
+		cols = append(cols, msql.ColumnValue{Name: "crosspost_of", Value: *opts.crosspostOf})
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
@@ -761,9 +855,8 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		}
 	}
 
-	for _, table := range postsTables {
-		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (community_id, post_id, user_id, created_at) VALUES (?, ?, ?, ?)", table),
-			opts.community, post.ID, opts.author, post.CreatedAt); err != nil {
+	if opts.postType == PostTypePoll {
+		if err := insertPoll(ctx, tx, post.ID, opts.poll); err != nil {
 			tx.Rollback()
 			return nil, err
 		}
@@ -776,34 +869,45 @@ func createPost(ctx context.Context, db *sql.DB, opts *createPostOpts) (*Post, e
 		return nil, err
 	}
 
-	if _, err := tx.ExecContext(ctx, "UPDATE users SET no_posts = no_posts + 1 WHERE id = ?", opts.author); err != nil {
-		tx.Rollback()
-		return nil, err
+	// Posts held for approval are listed once they are approved.
+	if !post.Pending {
+		if err := listPostTx(ctx, tx, opts.community, post.ID, opts.author, post.CreatedAt); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
-	if _, err := tx.ExecContext(ctx, "UPDATE communities SET posts_count = posts_count + 1 WHERE id = ?", opts.community); err != nil {
-		tx.Rollback()
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
+	p, err := GetPost(ctx, db, &post.ID, "", nil, false)
+	if err != nil {
 		return nil, err
 	}
-
-	return GetPost(ctx, db, &post.ID, "", nil, false)
+	if !p.Pending {
+		queueWebhookEvent(db, p.CommunityID, WebhookEventPostNew, p)
+	}
+	if err := automod.apply(ctx, db, p, nil); err != nil {
+		log.Printf("AutoModerator failed on new post %v: %v\n", p.ID, err)
+	}
+	return p, nil
 }
 
-func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string) (*Post, error) {
+func CreateTextPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, body string, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
 	return createPost(ctx, db, &createPostOpts{
 		postType:  PostTypeText,
 		author:    author,
 		community: community,
 		title:     title,
 		body:      body,
+
+		newUserPointsThreshold: newUserPointsThreshold,
+		newUserAgeThreshold:    newUserAgeThreshold,
 	})
 }
 
-func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imgs []*ImageUpload) (*Post, error) {
+func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, imgs []*ImageUpload, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
 	// We don't check whether the image belongs to the person who uploaded it.
 	// This is not a big deal as image ids are hard to guess.
 
@@ -825,6 +929,9 @@ func CreateImagePost(ctx context.Context, db *sql.DB, author, community uid.ID,
 		community: community,
 		title:     title,
 		images:    imgs,
+
+		newUserPointsThreshold: newUserPointsThreshold,
+		newUserAgeThreshold:    newUserAgeThreshold,
 	})
 }
 
@@ -882,7 +989,8 @@ func getLinkPostImage(u *url.URL) []byte {
 	return nil
 }
 
-func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string) (*Post, error) {
+// parsePostLink parses the URL of a link post.
+func parsePostLink(link string) (*url.URL, error) {
 	errInvalidURL := httperr.NewBadRequest("invalid-url", "Invalid URL.")
 	if len(link) > maxPostLinkLength {
 		link = link[:maxPostLinkLength]
@@ -898,6 +1006,14 @@ func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, t
 	if u.Hostname() == "" {
 		return nil, errInvalidURL
 	}
+	return u, nil
+}
+
+func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, title string, link string, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
+	u, err := parsePostLink(link)
+	if err != nil {
+		return nil, err
+	}
 
 	return createPost(ctx, db, &createPostOpts{
 		postType:  PostTypeLink,
@@ -910,6 +1026,9 @@ func CreateLinkPost(ctx context.Context, db *sql.DB, author, community uid.ID, t
 			URL:      u.String(),
 			Hostname: u.Hostname(),
 		},
+
+		newUserPointsThreshold: newUserPointsThreshold,
+		newUserAgeThreshold:    newUserAgeThreshold,
 	})
 }
 
@@ -936,20 +1055,105 @@ func (p *Post) Save(ctx context.Context, db *sql.DB, user uid.ID) error {
 
 	now := time.Now()
 	var args []any
+	var newBody *msql.NullString
 	query := "UPDATE posts SET title = ?"
 	args = append(args, p.Title)
-	if p.Type == PostTypeText && !p.DeletedContent {
+	if (p.Type == PostTypeText || p.Type == PostTypePoll) && !p.DeletedContent {
 		query += ", body = ?"
 		args = append(args, p.Body)
+		newBody = &p.Body
 	}
 	query += ", edited_at = ? WHERE id = ?"
 	args = append(args, now, p.ID)
 
-	_, err := db.ExecContext(ctx, query, args...)
-	if err == nil {
-		p.EditedAt.Valid = true
-		p.EditedAt.Time = now
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if err := savePostRevision(ctx, tx, p.ID, p.Title, newBody); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	p.EditedAt.Valid = true
+	p.EditedAt.Time = now
+	runPostAutomod(ctx, db, p, false)
+	return nil
+}
+
+// CheckViewable returns errPostNotFound if viewer (which may be nil) is not
+// allowed to see p. Posts held for approval are visible only to their authors,
+// the mods, and the admins.
+func (p *Post) CheckViewable(ctx context.Context, db *sql.DB, viewer *uid.ID) error {
+	if !p.Pending || (viewer != nil && p.AuthorID == *viewer) {
+		return nil
+	}
+	if viewer != nil {
+		if is, err := UserMod(ctx, db, p.CommunityID, *viewer); err != nil || is {
+			return err
+		}
+		if is, err := IsAdmin(db, viewer); err != nil || is {
+			return err
+		}
+	}
+	return errPostNotFound
+}
+
+// setPending sets whether p is held for approval by the mods. A post held for
+// approval is not listed (see listPostTx).
+func (p *Post) setPending(ctx context.Context, db *sql.DB, pending bool) error {
+	if p.Pending == pending {
+		return nil
+	}
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET pending = ? WHERE id = ?", pending, p.ID); err != nil {
+			return err
+		}
+		if pending {
+			return unlistPostTx(ctx, tx, p.CommunityID, p.ID, p.AuthorID)
+		}
+		return listPostTx(ctx, tx, p.CommunityID, p.ID, p.AuthorID, p.CreatedAt)
+	})
+	if err != nil {
+		return err
+	}
+	p.Pending = pending
+	return nil
+}
+
+// listPostTx adds a post to the posts_today, posts_week, etc, tables (the
+// ones whose period includes createdAt), and counts it in the number of posts
+// of its author and its community.
+func listPostTx(ctx context.Context, tx *sql.Tx, community, post, author uid.ID, createdAt time.Time) error {
+	now := time.Now()
+	for i, table := range postsTables {
+		if createdAt.Before(now.Add(postsTablesValidity[i])) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (community_id, post_id, user_id, created_at) VALUES (?, ?, ?, ?)", table),
+			community, post, author, createdAt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET no_posts = no_posts + 1 WHERE id = ?", author); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE communities SET posts_count = posts_count + 1 WHERE id = ?", community)
+	return err
+}
+
+// unlistPostTx undoes listPostTx.
+func unlistPostTx(ctx context.Context, tx *sql.Tx, community, post, author uid.ID) error {
+	for _, table := range postsTables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE post_id = ?", table), post); err != nil {
+			return err
+		}
 	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET no_posts = no_posts - 1 WHERE id = ? AND no_posts > 0", author); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE communities SET posts_count = posts_count - 1 WHERE id = ? AND posts_count > 0", community)
 	return err
 }
 
@@ -974,6 +1178,23 @@ func (p *Post) setGhostAuthorID() {
 // as g. In case the post is deleted by an admin or a mod, a notification is
 // sent to the original poster.
 func (p *Post) Delete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup, deleteContent bool, sendNotif bool) error {
+	if err := p.checkDeletable(ctx, db, user, g, deleteContent); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return p.deleteTx(ctx, tx, db, user, g, deleteContent, now)
+	}); err != nil {
+		return err
+	}
+	p.afterDelete(ctx, db, user, g, now, sendNotif)
+	return nil
+}
+
+// checkDeletable returns an error if p cannot be deleted by user in his
+// capacity as g.
+func (p *Post) checkDeletable(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup, deleteContent bool) error {
 	if p.Deleted && !(deleteContent && !p.DeletedContent) {
 		return &httperr.Error{
 			HTTPStatus: http.StatusConflict,
@@ -1011,81 +1232,114 @@ func (p *Post) Delete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup,
 		return errInvalidUserGroup
 	}
 
-	// Unpin all pins of this post:
-	if err := p.Pin(ctx, db, user, true, true, true); err != nil { // unpin site-wide pin
+	return nil
+}
+
+// deleteTx performs the database writes of Delete as part of tx. Permissions
+// are not checked.
+func (p *Post) deleteTx(ctx context.Context, tx *sql.Tx, db *sql.DB, user uid.ID, g UserGroup, deleteContent bool, now time.Time) error {
+	// Unpin all pins of this post (without logging the unpins).
+	if _, err := tx.ExecContext(ctx, "DELETE FROM pinned_posts WHERE post_id = ?", p.ID); err != nil {
 		return err
 	}
-	if err := p.Pin(ctx, db, user, false, true, true); err != nil { // unpin community pin
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET is_pinned = FALSE, is_pinned_site = FALSE WHERE id = ?", p.ID); err != nil {
 		return err
 	}
 
-	now := time.Now()
-	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
-		if !deleteContent || (deleteContent && !p.Deleted) {
-			q := "UPDATE posts SET deleted = ?, deleted_at = ?, deleted_by = ?, deleted_as = ? WHERE id = ?"
-			if _, err := tx.ExecContext(ctx, q, true, now, user, g, p.ID); err != nil {
-				return err
-			}
+	if !deleteContent || (deleteContent && !p.Deleted) {
+		q := "UPDATE posts SET deleted = ?, deleted_at = ?, deleted_by = ?, deleted_as = ? WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, q, true, now, user, g, p.ID); err != nil {
+			return err
 		}
+	}
 
-		if deleteContent {
-			var setBody string
-			if p.Body.Valid {
-				setBody = `body = "", `
-			}
-			q := fmt.Sprintf(`
-			UPDATE posts SET 
-				%s
-				link_image = NULL,
-				deleted_content = TRUE, 
-				deleted_content_at = ?, 
-				deleted_content_by = ?, 
-				deleted_content_as = ? 
-			WHERE id = ?`, setBody)
-
-			if _, err := tx.ExecContext(ctx, q, now, user, g, p.ID); err != nil {
-				return err
-			}
+	if deleteContent {
+		var setBody string
+		if p.Body.Valid {
+			setBody = `body = "", `
+		}
+		q := fmt.Sprintf(`
+		UPDATE posts SET 
+			%s
+			link_image = NULL,
+			deleted_content = TRUE, 
+			deleted_content_at = ?, 
+			deleted_content_by = ?, 
+			deleted_content_as = ? 
+		WHERE id = ?`, setBody)
 
-			if p.Type == PostTypeImage {
-				if _, err := tx.ExecContext(ctx, "DELETE FROM post_images WHERE post_id = ?", p.ID); err != nil {
-					return err
-				}
+		if _, err := tx.ExecContext(ctx, q, now, user, g, p.ID); err != nil {
+			return err
+		}
 
-				imageIDs := make([]uid.ID, len(p.Images))
-				for i := range p.Images {
-					imageIDs[i] = *p.Images[i].ID
-				}
+		// The previous versions of the post are purged along with it.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM post_revisions WHERE post_id = ?", p.ID); err != nil {
+			return err
+		}
 
-				if err := images.DeleteImagesTx(ctx, tx, db, imageIDs...); err != nil {
-					return err
-				}
-			} else if p.Type == PostTypeLink && p.HasLinkImage() {
-				if err := images.DeleteImagesTx(ctx, tx, db, *p.Link.Image.ID); err != nil {
-					return err
-				}
+		if p.Type == PostTypeImage {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM post_images WHERE post_id = ?", p.ID); err != nil {
+				return err
+			}
+
+			imageIDs := make([]uid.ID, len(p.Images))
+			for i := range p.Images {
+				imageIDs[i] = *p.Images[i].ID
 			}
-		}
 
-		for _, table := range postsTables {
-			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE post_id = ?", table), p.ID); err != nil {
+			if err := images.DeleteImagesTx(ctx, tx, db, imageIDs...); err != nil {
+				return err
+			}
+		} else if p.Type == PostTypeLink && p.HasLinkImage() {
+			if err := images.DeleteImagesTx(ctx, tx, db, *p.Link.Image.ID); err != nil {
 				return err
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		return err
 	}
 
+	for _, table := range postsTables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE post_id = ?", table), p.ID); err != nil {
+			return err
+		}
+	}
+
+	if g != UserGroupNormal {
+		action := ModLogActionPostDelete
+		if deleteContent {
+			action = ModLogActionPostDeleteContent
+		}
+		entry := newModLogEntry(&p.CommunityID, user, g, action, ModLogTargetPost, p.ID.String())
+		entry.Details["postPublicId"] = p.PublicID
+		if !deleteContent {
+			entry.Details["postTitle"] = p.Title
+		}
+		entry.Details["authorId"] = p.AuthorID
+		if err := entry.insert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterDelete updates p after it's deleted (by deleteTx), and does the things
+// that follow a deletion: resolving reports, sending webhooks, and notifying
+// the author.
+func (p *Post) afterDelete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup, now time.Time, sendNotif bool) {
+	p.Pinned, p.PinnedSite = false, false
 	p.Deleted = true
 	p.DeletedAt = msql.NewNullTime(now)
 	p.DeletedBy.Valid, p.DeletedBy.ID = true, user
 	p.DeletedAs = g
 
-	if g != UserGroupNormal {
-		RemoveAllReportsOfPost(ctx, db, p.ID)
+	action := ReportActionPostRemoved
+	if g == UserGroupNormal {
+		action = ReportActionDeletedByAuthor
 	}
+	if err := ResolveAllReportsOfPost(ctx, db, p.ID, action, user); err != nil {
+		log.Printf("Failed to resolve reports of post %v: %v\n", p.PublicID, err)
+	}
+
+	queueWebhookEvent(db, p.CommunityID, WebhookEventPostDeleted, p)
 
 	if sendNotif && (g == UserGroupAdmins || g == UserGroupMods) {
 		go func() {
@@ -1094,8 +1348,6 @@ func (p *Post) Delete(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup,
 			}
 		}()
 	}
-
-	return err
 }
 
 // Lock locks the post on behalf of user who's locking the post in his or her
@@ -1123,16 +1375,34 @@ func (p *Post) Lock(ctx context.Context, db *sql.DB, user uid.ID, g UserGroup) e
 	}
 
 	now := time.Now()
-	_, err := db.ExecContext(ctx, "UPDATE posts SET locked = ?, locked_by = ?, locked_by_group = ?, locked_at = ? WHERE id = ?", true, user, g, now, p.ID)
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		return p.lockTx(ctx, tx, user, g, now)
+	})
 	if err == nil {
-		p.Locked = true
-		p.LockedAt = msql.NewNullTime(now)
-		p.LockedBy.Valid, p.LockedBy.ID = true, user
-		p.LockedAs = g
+		p.setLocked(user, g, now)
 	}
 	return err
 }
 
+// lockTx performs the database writes of Lock as part of tx. Permissions are
+// not checked.
+func (p *Post) lockTx(ctx context.Context, tx *sql.Tx, user uid.ID, g UserGroup, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET locked = ?, locked_by = ?, locked_by_group = ?, locked_at = ? WHERE id = ?", true, user, g, now, p.ID); err != nil {
+		return err
+	}
+	entry := newModLogEntry(&p.CommunityID, user, g, ModLogActionPostLock, ModLogTargetPost, p.ID.String())
+	entry.Details["postPublicId"] = p.PublicID
+	entry.Details["postTitle"] = p.Title
+	return entry.insert(ctx, tx)
+}
+
+func (p *Post) setLocked(user uid.ID, g UserGroup, now time.Time) {
+	p.Locked = true
+	p.LockedAt = msql.NewNullTime(now)
+	p.LockedBy.Valid, p.LockedBy.ID = true, user
+	p.LockedAs = g
+}
+
 // Unlock unlocks the post on behalf of user.
 func (p *Post) Unlock(ctx context.Context, db *sql.DB, user uid.ID) error {
 	// TODO: Add a UserGroup argument to this method.
@@ -1150,7 +1420,19 @@ func (p *Post) Unlock(ctx context.Context, db *sql.DB, user uid.ID) error {
 		return httperr.NewForbidden("not-mod-not-admin", "User is neither a moderator nor an admin.")
 	}
 
-	_, err = db.ExecContext(ctx, "UPDATE posts SET locked = ?, locked_by = null, locked_by_group = ?, locked_at = null WHERE id = ?", false, UserGroupNaN, p.ID)
+	g := UserGroupAdmins
+	if isMod {
+		g = UserGroupMods
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET locked = ?, locked_by = null, locked_by_group = ?, locked_at = null WHERE id = ?", false, UserGroupNaN, p.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&p.CommunityID, user, g, ModLogActionPostUnlock, ModLogTargetPost, p.ID.String())
+		entry.Details["postPublicId"] = p.PublicID
+		entry.Details["postTitle"] = p.Title
+		return entry.insert(ctx, tx)
+	})
 	if err == nil {
 		p.Locked = false
 		p.LockedAt.Valid = false
@@ -1182,6 +1464,7 @@ func (p *Post) Pin(ctx context.Context, db *sql.DB, user uid.ID, siteWide, unpin
 	}
 
 	// Check permissions.
+	g := UserGroupAdmins // in what capacity the user is (un)pinning the post
 	if !skipPermissions {
 		if siteWide { // for site-wise pins
 			admin, err := IsAdmin(db, &user)
@@ -1196,7 +1479,9 @@ func (p *Post) Pin(ctx context.Context, db *sql.DB, user uid.ID, siteWide, unpin
 			if err != nil {
 				return err
 			}
-			if !isMod {
+			if isMod {
+				g = UserGroupMods
+			} else {
 				// User is not a mod of the community. See if he's an admin.
 				admin, err := IsAdmin(db, &user)
 				if err != nil {
@@ -1239,7 +1524,8 @@ func (p *Post) Pin(ctx context.Context, db *sql.DB, user uid.ID, siteWide, unpin
 			}
 		}
 
-		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
 			return err
 		}
 
@@ -1248,13 +1534,37 @@ func (p *Post) Pin(ctx context.Context, db *sql.DB, user uid.ID, siteWide, unpin
 		} else {
 			_, err = tx.ExecContext(ctx, "UPDATE posts SET is_pinned = ? WHERE id = ?", !unpin, p.ID)
 		}
-		return err
+		if err != nil {
+			return err
+		}
+
+		// Pins and unpins done on behalf of the system (like when a post is
+		// deleted) are not logged, nor are unpins of posts that were not
+		// pinned.
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if skipPermissions || n == 0 {
+			return nil
+		}
+		action := ModLogActionPostPin
+		if unpin {
+			action = ModLogActionPostUnpin
+		}
+		var community *uid.ID
+		if !siteWide {
+			community = &p.CommunityID
+		}
+		entry := newModLogEntry(community, user, g, action, ModLogTargetPost, p.ID.String())
+		entry.Details["postPublicId"] = p.PublicID
+		entry.Details["postTitle"] = p.Title
+		entry.Details["siteWide"] = siteWide
+		return entry.insert(ctx, tx)
 	})
 }
 
 func (p *Post) updatePostsTablesPoints(ctx context.Context, db *sql.DB) error {
 	for _, table := range postsTables {
-		if _, err := db.ExecContext(ctx, "UPDATE "+table+" SET points = ? WHERE post_id = ?", p.Points, p.ID); err != nil {
+		if _, err := db.ExecContext(ctx, "UPDATE "+table+" SET points = ?, controversy = ? WHERE post_id = ?", p.Points, p.controversy, p.ID); err != nil {
 			return err
 		}
 	}
@@ -1285,7 +1595,7 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool, newUs
 		if !up {
 			point = -1
 		}
-		query := "UPDATE posts SET points = points + ?, hotness = ?"
+		query := "UPDATE posts SET points = points + ?, hotness = ?, controversy = ?"
 		newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 		if up {
 			query += ", upvotes = upvotes + 1"
@@ -1295,7 +1605,10 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool, newUs
 			newDownvotes++
 		}
 		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID); err != nil {
+		if _, err := tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), PostControversy(newUpvotes, newDownvotes), p.ID); err != nil {
+			return err
+		}
+		if err := p.updateRisingScore(ctx, tx); err != nil {
 			return err
 		}
 		if up && !p.AuthorID.EqualsTo(user) && canUserIncrementPoints {
@@ -1305,6 +1618,7 @@ func (p *Post) Vote(ctx context.Context, db *sql.DB, user uid.ID, up bool, newUs
 		}
 		p.Upvotes = newUpvotes
 		p.Downvotes = newDownvotes
+		p.controversy = PostControversy(newUpvotes, newDownvotes)
 		p.Points += point
 		p.ViewerVoted = msql.NewNullBool(true)
 		p.ViewerVotedUp = msql.NewNullBool(up)
@@ -1344,7 +1658,7 @@ func (p *Post) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error {
 		if _, err := tx.ExecContext(ctx, "DELETE FROM post_votes WHERE id = ?", id); err != nil {
 			return err
 		}
-		query := "UPDATE posts SET points = points + ?, hotness = ?"
+		query := "UPDATE posts SET points = points + ?, hotness = ?, controversy = ?"
 		point := 1
 		newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 		if up {
@@ -1356,7 +1670,10 @@ func (p *Post) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error {
 			newDownvotes--
 		}
 		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID); err != nil {
+		if _, err := tx.ExecContext(ctx, query, point, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), PostControversy(newUpvotes, newDownvotes), p.ID); err != nil {
+			return err
+		}
+		if err := p.updateRisingScore(ctx, tx); err != nil {
 			return err
 		}
 		if up && !p.AuthorID.EqualsTo(user) && !userNew {
@@ -1366,6 +1683,7 @@ func (p *Post) DeleteVote(ctx context.Context, db *sql.DB, user uid.ID) error {
 		}
 		p.Upvotes = newUpvotes
 		p.Downvotes = newDownvotes
+		p.controversy = PostControversy(newUpvotes, newDownvotes)
 		p.Points += point
 		p.ViewerVoted.Valid = false
 		p.ViewerVotedUp.Valid = false
@@ -1401,7 +1719,7 @@ func (p *Post) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bool)
 		if _, err := tx.ExecContext(ctx, "UPDATE post_votes SET up = ? WHERE id = ?", up, id); err != nil {
 			return err
 		}
-		query := "UPDATE posts SET points = points + ?, hotness = ?"
+		query := "UPDATE posts SET points = points + ?, hotness = ?, controversy = ?"
 		points := 2
 		newUpvotes, newDownvotes := p.Upvotes, p.Downvotes
 		if dbUp {
@@ -1415,7 +1733,10 @@ func (p *Post) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bool)
 			newDownvotes--
 		}
 		query += " WHERE id = ?"
-		if _, err := tx.ExecContext(ctx, query, points, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), p.ID); err != nil {
+		if _, err := tx.ExecContext(ctx, query, points, PostHotness(newUpvotes, newDownvotes, p.CreatedAt), PostControversy(newUpvotes, newDownvotes), p.ID); err != nil {
+			return err
+		}
+		if err := p.updateRisingScore(ctx, tx); err != nil {
 			return err
 		}
 		if !p.AuthorID.EqualsTo(user) && !userNew {
@@ -1429,6 +1750,7 @@ func (p *Post) ChangeVote(ctx context.Context, db *sql.DB, user uid.ID, up bool)
 		}
 		p.Upvotes = newUpvotes
 		p.Downvotes = newDownvotes
+		p.controversy = PostControversy(newUpvotes, newDownvotes)
 		p.Points += points
 		p.ViewerVotedUp = msql.NewNullBool(up)
 		return nil
@@ -1484,21 +1806,24 @@ func getComments(ctx context.Context, db *sql.DB, viewer *uid.ID, where string,
 
 // CommentsCursor is an API pagination cursor.
 type CommentsCursor struct {
-	Upvotes int
-	NextID  uid.ID
+	Score  int // The value of the sort column (see CommentSort) of NextID.
+	NextID uid.ID
 }
 
-// GetComments populates c.Comments and returns the next comment's cursor.
-func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, cursor *CommentsCursor) (*CommentsCursor, error) {
+// GetComments populates c.Comments, in the order of sort, and returns the next
+// comment's cursor.
+func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, cursor *CommentsCursor, sort CommentSort) (*CommentsCursor, error) {
+	if !sort.Valid() {
+		return nil, ErrInvalidCommentSort
+	}
 	var args []any
 	currTime := time.Now()
 	where := "WHERE comments.post_id = ? "
 	args = append(args, p.ID)
 	if cursor != nil {
-		where += "AND (comments.upvotes, comments.id) <= (?, ?) "
-		args = append(args, cursor.Upvotes, cursor.NextID)
+		where, args = sort.whereCursor(where, args, cursor)
 	}
-	where += "ORDER BY upvotes DESC, comments.id DESC LIMIT ?"
+	where += sort.orderBy() + "LIMIT ?"
 	args = append(args, commentsFetchLimit+1)
 
 	all, err := getComments(ctx, db, viewer, where, args...)
@@ -1506,6 +1831,13 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 		return nil, err
 	}
 
+	var muted *regexp.Regexp // The keywords muted by viewer.
+	if viewer != nil {
+		if muted, err = mutedKeywordsCache.get(ctx, db, *viewer); err != nil {
+			return nil, err
+		}
+	}
+
 	comments := all
 
 	// assume a page visit is an API call where cursor is nil
@@ -1519,11 +1851,11 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 	var nextCursor *CommentsCursor
 	if len(all) >= commentsFetchLimit+1 {
 		nextCursor = new(CommentsCursor)
-		nextCursor.Upvotes = all[commentsFetchLimit].Upvotes
+		nextCursor.Score = sort.score(all[commentsFetchLimit])
 		nextCursor.NextID = all[commentsFetchLimit].ID
 		comments = all[:commentsFetchLimit]
 	}
-	p.Comments = comments
+	p.Comments = filterMutedComments(comments, muted)
 
 	ids := make(map[uid.ID]bool)
 	for _, c := range p.Comments {
@@ -1550,23 +1882,34 @@ func (p *Post) GetComments(ctx context.Context, db *sql.DB, viewer *uid.ID, curs
 	}
 
 	if len(toGet) > 0 {
-		c2, err := GetCommentsByIDs(ctx, db, viewer, toGet...)
+		where := fmt.Sprintf("WHERE comments.id IN %s ", msql.InClauseQuestionMarks(len(toGet)))
+		args := make([]any, len(toGet))
+		for i := range toGet {
+			args[i] = toGet[i]
+		}
+		c2, err := getComments(ctx, db, viewer, where, args...)
 		if err != nil {
 			return nil, err
 		}
-		p.Comments = append(p.Comments, c2...)
+		p.Comments = append(p.Comments, filterMutedComments(c2, muted)...)
+		if viewer != nil {
+			p.Comments = removeOrphanComments(p.Comments, nil)
+		}
 	}
 
 	if nextCursor != nil {
-		p.CommentsNext.String = strconv.Itoa(nextCursor.Upvotes) + "." + nextCursor.NextID.String()
+		p.CommentsNext.String = strconv.Itoa(nextCursor.Score) + "." + nextCursor.NextID.String()
 		p.CommentsNext.Valid = true
 	}
 
 	return nextCursor, nil
 }
 
-// GetCommentReplies returns all the replies of comment.
-func (p *Post) GetCommentReplies(ctx context.Context, db *sql.DB, viewer *uid.ID, comment uid.ID) ([]*Comment, error) {
+// GetCommentReplies returns all the replies of comment, in the order of sort.
+func (p *Post) GetCommentReplies(ctx context.Context, db *sql.DB, viewer *uid.ID, comment uid.ID, sort CommentSort) ([]*Comment, error) {
+	if !sort.Valid() {
+		return nil, ErrInvalidCommentSort
+	}
 	rows, err := db.QueryContext(ctx, "SELECT reply_id FROM comment_replies WHERE parent_id = ?", comment)
 	if err != nil {
 		return nil, err
@@ -1581,7 +1924,54 @@ func (p *Post) GetCommentReplies(ctx context.Context, db *sql.DB, viewer *uid.ID
 		return nil, nil
 	}
 
-	return GetCommentsByIDs(ctx, db, viewer, ids...)
+	where := fmt.Sprintf("WHERE comments.id IN %s ", msql.InClauseQuestionMarks(len(ids)))
+	args := make([]any, len(ids))
+	for i := range ids {
+		args[i] = ids[i]
+	}
+	replies, err := getComments(ctx, db, viewer, where+sort.orderBy(), args...)
+	if err != nil {
+		return nil, err
+	}
+	if viewer != nil {
+		muted, err := mutedKeywordsCache.get(ctx, db, *viewer)
+		if err != nil {
+			return nil, err
+		}
+		replies = removeOrphanComments(filterMutedComments(replies, muted), &comment)
+	}
+	return replies, nil
+}
+
+// removeOrphanComments removes, from comments, the comments that have an
+// ancestor that's not in comments (one that was filtered out because of a mute,
+// for instance), along with all their replies. If root is not nil, only the
+// ancestors that are descendants of root are considered.
+func removeOrphanComments(comments []*Comment, root *uid.ID) []*Comment {
+	ids := make(map[uid.ID]bool, len(comments))
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+	var kept []*Comment
+	for _, c := range comments {
+		ancestors := c.Ancestors
+		if root != nil {
+			if i := slices.Index(ancestors, *root); i != -1 {
+				ancestors = ancestors[i+1:]
+			}
+		}
+		orphan := false
+		for _, a := range ancestors {
+			if !ids[a] {
+				orphan = true
+				break
+			}
+		}
+		if !orphan {
+			kept = append(kept, c)
+		}
+	}
+	return kept
 }
 
 // UpdateVisitTime updates the logged-in viewer's last visit time to the post
@@ -1850,6 +2240,83 @@ func UpdateAllPostsHotness(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
+// PostControversy returns a score that's higher for posts with a larger number
+// of votes that are more evenly split between upvotes and downvotes.
+func PostControversy(upvotes, downvotes int) int {
+	return controversy(upvotes, downvotes)
+}
+
+// risingWindow is the length of the period of time, preceding the present,
+// over which the vote velocity of posts is measured for the rising sort.
+const risingWindow = time.Hour * 6
+
+// PostRisingScore returns the rising score of a post, which is the number of
+// net upvotes the post received in the last risingWindow per hour (multiplied
+// by 1000), where age is the age of the post. Posts with no net upvotes in the
+// window have a score of zero.
+func PostRisingScore(recentUpvotes, recentDownvotes int, age time.Duration) int {
+	net := recentUpvotes - recentDownvotes
+	if net <= 0 {
+		return 0
+	}
+	hours := min(age, risingWindow).Hours()
+	if hours < 1 {
+		// So that the first few votes of a brand new post don't catapult it
+		// to the top.
+		hours = 1
+	}
+	return int(math.Round(1000 * float64(net) / hours))
+}
+
+// updateRisingScore recalculates the rising score of p from the votes it got
+// in the last risingWindow.
+func (p *Post) updateRisingScore(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now()
+	var upvotes, downvotes int
+	row := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(up), 0), COALESCE(SUM(NOT up), 0) FROM post_votes WHERE post_id = ? AND created_at > ?", p.ID, now.Add(-risingWindow))
+	if err := row.Scan(&upvotes, &downvotes); err != nil {
+		return err
+	}
+	score := PostRisingScore(upvotes, downvotes, now.Sub(p.CreatedAt))
+	if _, err := tx.ExecContext(ctx, "UPDATE posts SET rising = ? WHERE id = ?", score, p.ID); err != nil {
+		return err
+	}
+	p.rising = score
+	return nil
+}
+
+// UpdatePostsRisingScores recalculates the rising scores of all the posts that
+// currently have one, so that the scores of posts that stop receiving votes
+// decay to zero. Call this function periodically.
+func UpdatePostsRisingScores(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, created_at FROM posts WHERE deleted = FALSE AND rising > 0")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var posts []*Post
+	for rows.Next() {
+		post := &Post{}
+		if err := rows.Scan(&post.ID, &post.CreatedAt); err != nil {
+			return err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+			return post.updateRisingScore(ctx, tx)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func SavePostImage(ctx context.Context, db *sql.DB, authorID uid.ID, image []byte) (*images.ImageRecord, error) {
 	var imageID uid.ID
 	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostRisingScore(t *testing.T) {
+	tests := []struct {
+		up, down int
+		age      time.Duration
+		want     int
+	}{
+		{0, 0, time.Hour, 0},
+		{2, 5, time.Hour, 0},
+		{3, 0, time.Minute * 10, 3000}, // Ages under an hour count as an hour.
+		{12, 0, time.Hour * 3, 4000},
+		{12, 0, time.Hour * 48, 2000}, // Only the votes in risingWindow count.
+		{10, 4, time.Hour * 2, 3000},
+	}
+	for _, test := range tests {
+		if got := PostRisingScore(test.up, test.down, test.age); got != test.want {
+			t.Errorf("PostRisingScore(%d, %d, %v) = %d, want %d", test.up, test.down, test.age, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// PostApproval is a community setting that determines which new posts are
+// held for approval by the mods (posts of the mods themselves never are).
+type PostApproval string
+
+const (
+	PostApprovalOff      = PostApproval("off")
+	PostApprovalNewUsers = PostApproval("new_users") // Posts of new users.
+	PostApprovalAll      = PostApproval("all")
+)
+
+// Valid reports whether a is a valid PostApproval.
+func (a PostApproval) Valid() bool {
+	switch a {
+	case PostApprovalOff, PostApprovalNewUsers, PostApprovalAll:
+		return true
+	}
+	return false
+}
+
+var errNotPending = httperr.NewBadRequest("not-pending", "Not pending approval.")
+
+// postRequiresApproval reports whether a new post of author in community is to
+// be held for approval, as per the PostApproval setting of community. A user
+// with fewer than newUserPointsThreshold points, or whose account is younger
+// than newUserAgeThreshold, is considered new.
+func postRequiresApproval(ctx context.Context, db *sql.DB, community, author uid.ID, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (bool, error) {
+	comm, err := GetCommunityByID(ctx, db, community, nil)
+	if err != nil {
+		return false, err
+	}
+	if comm.PostApproval == PostApprovalOff {
+		return false, nil
+	}
+	if is, err := comm.UserModOrAdmin(ctx, db, author); err != nil || is {
+		return false, err
+	}
+	if comm.PostApproval == PostApprovalAll {
+		return true, nil
+	}
+	points, createdAt, err := getUserPointsAndCreatedAt(ctx, db, nil, author)
+	if err != nil {
+		return false, err
+	}
+	return isNewUser(points, createdAt, newUserPointsThreshold, newUserAgeThreshold), nil
+}
+
+// moderatorGroup returns the capacity in which user moderates community. It
+// returns errNotMod if user is neither a mod of community nor an admin.
+func moderatorGroup(ctx context.Context, db *sql.DB, community, user uid.ID) (UserGroup, error) {
+	if is, err := UserModOrAdmin(ctx, db, community, user); err != nil {
+		return UserGroupNaN, err
+	} else if !is {
+		return UserGroupNaN, errNotMod
+	}
+	return modOrAdminGroup(ctx, db, community, user)
+}
+
+// GetPendingPosts returns the posts of community that are held for approval,
+// oldest first.
+func GetPendingPosts(ctx context.Context, db *sql.DB, community, viewer uid.ID, limit int, next *string) ([]*Post, *string, error) {
+	where := "WHERE posts.community_id = ? AND posts.pending = TRUE AND posts.deleted = FALSE "
+	args := []any{viewer, viewer, community}
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += "AND posts.id >= ? "
+		args = append(args, nextID)
+	}
+	where += "ORDER BY posts.id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, buildSelectPostQuery(true, where), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	posts, err := scanPosts(ctx, db, rows, &viewer)
+	if err != nil {
+		if err == errPostNotFound {
+			return []*Post{}, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(posts) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = posts[limit].ID.String()
+		posts = posts[:limit]
+	}
+	return posts, nextNext, nil
+}
+
+// GetPendingComments returns the comments in community that are held for
+// approval, oldest first.
+func GetPendingComments(ctx context.Context, db *sql.DB, community, viewer uid.ID, limit int, next *string) ([]*Comment, *string, error) {
+	where := "WHERE comments.community_id = ? AND comments.pending = TRUE AND comments.deleted_at IS NULL "
+	args := []any{viewer, community}
+	if next != nil {
+		nextID, err := uid.FromString(*next)
+		if err != nil {
+			return nil, nil, httperr.NewBadRequest("invalid-cursor", "Invalid pagination cursor.")
+		}
+		where += "AND comments.id >= ? "
+		args = append(args, nextID)
+	}
+	where += "ORDER BY comments.id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, buildSelectCommentsQuery(true, where), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	comments, err := scanComments(ctx, db, rows, &viewer)
+	if err != nil {
+		if err == errCommentNotFound {
+			return []*Comment{}, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var nextNext *string
+	if len(comments) >= limit+1 {
+		nextNext = new(string)
+		*nextNext = comments[limit].ID.String()
+		comments = comments[:limit]
+	}
+	return comments, nextNext, nil
+}
+
+// NumPending returns the number of posts and comments in community that are
+// held for approval.
+func NumPending(ctx context.Context, db *sql.DB, community uid.ID) (posts, comments int, err error) {
+	if err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE community_id = ? AND pending = TRUE AND deleted = FALSE", community).Scan(&posts); err != nil {
+		return
+	}
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE community_id = ? AND pending = TRUE AND deleted_at IS NULL", community).Scan(&comments)
+	return
+}
+
+// Approve approves p, which is held for approval, on behalf of mod (who's
+// either a mod of the community or an admin).
+func (p *Post) Approve(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if !p.Pending || p.Deleted {
+		return errNotPending
+	}
+	g, err := moderatorGroup(ctx, db, p.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET pending = FALSE WHERE id = ?", p.ID); err != nil {
+			return err
+		}
+		if err := listPostTx(ctx, tx, p.CommunityID, p.ID, p.AuthorID, p.CreatedAt); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&p.CommunityID, mod, g, ModLogActionPostApprove, ModLogTargetPost, p.ID.String())
+		entry.Details["postPublicId"] = p.PublicID
+		entry.Details["postTitle"] = p.Title
+		return entry.insert(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
+	p.Pending = false
+	queueWebhookEvent(db, p.CommunityID, WebhookEventPostNew, p)
+	return nil
+}
+
+// Reject removes p, which is held for approval, on behalf of mod (who's either
+// a mod of the community or an admin).
+func (p *Post) Reject(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if !p.Pending || p.Deleted {
+		return errNotPending
+	}
+	g, err := moderatorGroup(ctx, db, p.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+	return p.Delete(ctx, db, mod, g, false, true)
+}
+
+// Approve approves c, which is held for approval, on behalf of mod (who's
+// either a mod of the community or an admin).
+func (c *Comment) Approve(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if !c.Pending || c.Deleted {
+		return errNotPending
+	}
+	g, err := moderatorGroup(ctx, db, c.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE comments SET pending = FALSE WHERE id = ?", c.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(&c.CommunityID, mod, g, ModLogActionCommentApprove, ModLogTargetComment, c.ID.String())
+		entry.Details["postPublicId"] = c.PostPublicID
+		return entry.insert(ctx, tx)
+	})
+	if err != nil {
+		return err
+	}
+	c.Pending = false
+	queueWebhookEvent(db, c.CommunityID, WebhookEventCommentNew, c)
+
+	// The notifications of the comment were held back along with it.
+	post, err := GetPost(ctx, db, &c.PostID, "", nil, true)
+	if err != nil {
+		return err
+	}
+	author, err := GetUser(ctx, db, c.AuthorID, nil)
+	if err != nil {
+		return err
+	}
+	var parent *Comment
+	if c.ParentID.Valid {
+		if parent, err = GetComment(ctx, db, c.ParentID.ID, nil); err != nil {
+			return err
+		}
+	}
+	sendNewCommentNotifications(db, post, parent, c.ID, author)
+	return nil
+}
+
+// Reject removes c, which is held for approval, on behalf of mod (who's either
+// a mod of the community or an admin).
+func (c *Comment) Reject(ctx context.Context, db *sql.DB, mod uid.ID) error {
+	if !c.Pending || c.Deleted {
+		return errNotPending
+	}
+	g, err := moderatorGroup(ctx, db, c.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, db, mod, g)
+}
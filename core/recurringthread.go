@@ -0,0 +1,357 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const maxRecurringThreadsPerCommunity = 10
+
+// RecurringThreadDatePlaceholder is replaced, in the title of a recurring
+// thread, with the date on which each post is created.
+const RecurringThreadDatePlaceholder = "{date}"
+
+// RecurringFrequency is how often a recurring thread is posted.
+type RecurringFrequency string
+
+const (
+	RecurringFrequencyDaily  = RecurringFrequency("daily")
+	RecurringFrequencyWeekly = RecurringFrequency("weekly")
+)
+
+// Valid reports whether f is a valid RecurringFrequency.
+func (f RecurringFrequency) Valid() bool {
+	return f == RecurringFrequencyDaily || f == RecurringFrequencyWeekly
+}
+
+var (
+	errRecurringThreadNotFound = httperr.NewNotFound("recurring-thread-not-found", "Recurring thread not found.")
+	errInvalidRecurringTime    = httperr.NewBadRequest("invalid-recurring-time", "Invalid recurring thread schedule.")
+	errTooManyRecurringThreads = httperr.NewForbidden("too-many-recurring-threads", "Maximum number of recurring threads reached.")
+)
+
+// RecurringThread is a post that's created in a community on a schedule (every
+// day or every week, at a set time in UTC), on behalf of its moderators. Each
+// new post is pinned, and the previous one unpinned.
+type RecurringThread struct {
+	ID          int                `json:"id"`
+	CommunityID uid.ID             `json:"communityId"`
+	Title       string             `json:"title"` // May contain RecurringThreadDatePlaceholder.
+	Body        msql.NullString    `json:"body"`
+	Frequency   RecurringFrequency `json:"frequency"`
+	Weekday     time.Weekday       `json:"weekday"` // Only for weekly threads.
+	Hour        int                `json:"hour"`
+	Minute      int                `json:"minute"`
+	NextRunAt   time.Time          `json:"nextRunAt"`
+	LastPostID  uid.NullID         `json:"lastPostId"`
+	LastError   msql.NullString    `json:"lastError"`
+	CreatedBy   uid.ID             `json:"createdBy"` // The author of the posts.
+	CreatedAt   time.Time          `json:"createdAt"`
+}
+
+// RecurringThreadOpts are the user editable fields of a RecurringThread.
+type RecurringThreadOpts struct {
+	Title     string             `json:"title"`
+	Body      string             `json:"body"`
+	Frequency RecurringFrequency `json:"frequency"`
+	Weekday   time.Weekday       `json:"weekday"`
+	Hour      int                `json:"hour"`
+	Minute    int                `json:"minute"`
+}
+
+func (opts *RecurringThreadOpts) validate() error {
+	if err := validatePost(opts.Title, opts.Body); err != nil {
+		return err
+	}
+	opts.Title = utils.TruncateUnicodeString(opts.Title, maxPostTitleLength)
+	opts.Body = utils.TruncateUnicodeString(opts.Body, maxPostBodyLength)
+	if !opts.Frequency.Valid() {
+		return httperr.NewBadRequest("invalid-frequency", "Invalid recurring thread frequency.")
+	}
+	if opts.Frequency == RecurringFrequencyDaily {
+		opts.Weekday = time.Sunday
+	}
+	if opts.Weekday < time.Sunday || opts.Weekday > time.Saturday || opts.Hour < 0 || opts.Hour > 23 || opts.Minute < 0 || opts.Minute > 59 {
+		return errInvalidRecurringTime
+	}
+	return nil
+}
+
+// nextRun returns the first time, strictly after after, on which a thread with
+// the schedule in opts is due.
+func (opts *RecurringThreadOpts) nextRun(after time.Time) time.Time {
+	after = after.UTC()
+	t := time.Date(after.Year(), after.Month(), after.Day(), opts.Hour, opts.Minute, 0, 0, time.UTC)
+	if opts.Frequency == RecurringFrequencyWeekly {
+		t = t.AddDate(0, 0, (int(opts.Weekday)-int(t.Weekday())+7)%7)
+	}
+	for !t.After(after) {
+		if opts.Frequency == RecurringFrequencyWeekly {
+			t = t.AddDate(0, 0, 7)
+		} else {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+// recurringThreadTitle returns title with the date placeholder replaced with
+// date.
+func recurringThreadTitle(title string, date time.Time) string {
+	return strings.ReplaceAll(title, RecurringThreadDatePlaceholder, date.UTC().Format("January 2, 2006"))
+}
+
+func (rt *RecurringThread) opts() *RecurringThreadOpts {
+	return &RecurringThreadOpts{
+		Title:     rt.Title,
+		Body:      rt.Body.String,
+		Frequency: rt.Frequency,
+		Weekday:   rt.Weekday,
+		Hour:      rt.Hour,
+		Minute:    rt.Minute,
+	}
+}
+
+var selectRecurringThreadCols = []string{
+	"recurring_threads.id",
+	"recurring_threads.community_id",
+	"recurring_threads.title",
+	"recurring_threads.body",
+	"recurring_threads.frequency",
+	"recurring_threads.weekday",
+	"recurring_threads.hour",
+	"recurring_threads.minute",
+	"recurring_threads.next_run_at",
+	"recurring_threads.last_post_id",
+	"recurring_threads.last_error",
+	"recurring_threads.created_by",
+	"recurring_threads.created_at",
+}
+
+func getRecurringThreads(ctx context.Context, db *sql.DB, where string, args ...any) ([]*RecurringThread, error) {
+	query := msql.BuildSelectQuery("recurring_threads", selectRecurringThreadCols, nil, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*RecurringThread{}
+	for rows.Next() {
+		rt := &RecurringThread{}
+		err := rows.Scan(
+			&rt.ID,
+			&rt.CommunityID,
+			&rt.Title,
+			&rt.Body,
+			&rt.Frequency,
+			&rt.Weekday,
+			&rt.Hour,
+			&rt.Minute,
+			&rt.NextRunAt,
+			&rt.LastPostID,
+			&rt.LastError,
+			&rt.CreatedBy,
+			&rt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+// CreateRecurringThread adds a recurring thread to community. The posts are
+// authored by mod, who must be a moderator of community.
+func (c *Community) CreateRecurringThread(ctx context.Context, db *sql.DB, mod uid.ID, opts *RecurringThreadOpts) (*RecurringThread, error) {
+	if is, err := UserMod(ctx, db, c.ID, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recurring_threads WHERE community_id = ?", c.ID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxRecurringThreadsPerCommunity {
+		return nil, errTooManyRecurringThreads
+	}
+
+	query, args := msql.BuildInsertQuery("recurring_threads", []msql.ColumnValue{
+		{Name: "community_id", Value: c.ID},
+		{Name: "title", Value: opts.Title},
+		{Name: "body", Value: msql.NewNullString(opts.Body)},
+		{Name: "frequency", Value: opts.Frequency},
+		{Name: "weekday", Value: opts.Weekday},
+		{Name: "hour", Value: opts.Hour},
+		{Name: "minute", Value: opts.Minute},
+		{Name: "next_run_at", Value: opts.nextRun(time.Now())},
+		{Name: "created_by", Value: mod},
+	})
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetRecurringThread(ctx, db, c.ID, int(id))
+}
+
+// GetRecurringThread returns the recurring thread of community with the given
+// id.
+func GetRecurringThread(ctx context.Context, db *sql.DB, community uid.ID, id int) (*RecurringThread, error) {
+	threads, err := getRecurringThreads(ctx, db, "WHERE recurring_threads.id = ? AND recurring_threads.community_id = ?", id, community)
+	if err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return nil, errRecurringThreadNotFound
+	}
+	return threads[0], nil
+}
+
+// GetRecurringThreads returns all the recurring threads of community.
+func GetRecurringThreads(ctx context.Context, db *sql.DB, community uid.ID) ([]*RecurringThread, error) {
+	return getRecurringThreads(ctx, db, "WHERE recurring_threads.community_id = ? ORDER BY recurring_threads.id", community)
+}
+
+// Update replaces the user editable fields of rt with opts, and reschedules the
+// next post accordingly.
+func (rt *RecurringThread) Update(ctx context.Context, db *sql.DB, opts *RecurringThreadOpts) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	nextRunAt := opts.nextRun(time.Now())
+	_, err := db.ExecContext(ctx, "UPDATE recurring_threads SET title = ?, body = ?, frequency = ?, weekday = ?, hour = ?, minute = ?, next_run_at = ? WHERE id = ?",
+		opts.Title, msql.NewNullString(opts.Body), opts.Frequency, opts.Weekday, opts.Hour, opts.Minute, nextRunAt, rt.ID)
+	if err != nil {
+		return err
+	}
+	rt.Title, rt.Body = opts.Title, msql.NewNullString(opts.Body)
+	rt.Frequency, rt.Weekday, rt.Hour, rt.Minute = opts.Frequency, opts.Weekday, opts.Hour, opts.Minute
+	rt.NextRunAt = nextRunAt
+	return nil
+}
+
+// Delete deletes rt. Posts already created are left as they are.
+func (rt *RecurringThread) Delete(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM recurring_threads WHERE id = ?", rt.ID)
+	return err
+}
+
+// PostDueRecurringThreads creates the posts of all the recurring threads that
+// are due. It returns the number of posts created.
+func PostDueRecurringThreads(ctx context.Context, db *sql.DB) (int, error) {
+	threads, err := getRecurringThreads(ctx, db, "WHERE recurring_threads.next_run_at <= ? ORDER BY recurring_threads.next_run_at LIMIT 100", time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, rt := range threads {
+		post, err := rt.post(ctx, db)
+		if err != nil {
+			log.Printf("Error posting recurring thread %d: %v\n", rt.ID, err)
+		}
+		if post != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// post creates the post of rt, pins it, and unpins the previous one. The next
+// run is scheduled, and any error is recorded in rt.LastError, regardless of
+// whether the post is created.
+func (rt *RecurringThread) post(ctx context.Context, db *sql.DB) (*Post, error) {
+	now := time.Now()
+	nextRunAt := rt.opts().nextRun(now)
+
+	// Claim this run, so that the thread is not posted twice.
+	res, err := db.ExecContext(ctx, "UPDATE recurring_threads SET next_run_at = ?, last_error = NULL WHERE id = ? AND next_run_at = ?", nextRunAt, rt.ID, rt.NextRunAt)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, nil
+	}
+	rt.NextRunAt = nextRunAt
+
+	post, err := rt.createPost(ctx, db, now)
+	if post != nil {
+		rt.LastPostID = uid.NullID{Valid: true, ID: post.ID}
+		if _, dbErr := db.ExecContext(ctx, "UPDATE recurring_threads SET last_post_id = ? WHERE id = ?", post.ID, rt.ID); dbErr != nil {
+			return post, dbErr
+		}
+	}
+	if err != nil {
+		rt.LastError = msql.NewNullString(utils.TruncateUnicodeString(err.Error(), 255))
+		if _, dbErr := db.ExecContext(ctx, "UPDATE recurring_threads SET last_error = ? WHERE id = ?", rt.LastError, rt.ID); dbErr != nil {
+			return post, dbErr
+		}
+	}
+	return post, err
+}
+
+func (rt *RecurringThread) createPost(ctx context.Context, db *sql.DB, now time.Time) (*Post, error) {
+	// The author may have stepped down since the thread was set up.
+	if is, err := UserMod(ctx, db, rt.CommunityID, rt.CreatedBy); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, fmt.Errorf("author is no longer a moderator")
+	}
+
+	// The author being a mod, the post is never held for approval, and so the
+	// new user thresholds are left unset.
+	post, err := createPost(ctx, db, &createPostOpts{
+		postType:  PostTypeText,
+		author:    rt.CreatedBy,
+		community: rt.CommunityID,
+		title:     recurringThreadTitle(rt.Title, now),
+		body:      rt.Body.String,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := post.ChangeUserGroup(ctx, db, rt.CreatedBy, UserGroupMods); err != nil {
+		return post, err
+	}
+
+	// Unpin the previous instance, if it's still pinned, to make room for the
+	// new one.
+	if rt.LastPostID.Valid {
+		prev, err := GetPost(ctx, db, &rt.LastPostID.ID, "", nil, true)
+		if err != nil && err != errPostNotFound {
+			return post, err
+		}
+		if prev != nil && prev.Pinned {
+			if err := prev.Pin(ctx, db, rt.CreatedBy, false, true, true); err != nil {
+				return post, err
+			}
+		}
+	}
+	if err := post.Pin(ctx, db, rt.CreatedBy, false, false, true); err != nil {
+		return post, err
+	}
+	return post, nil
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurringThreadNextRun(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		opts RecurringThreadOpts
+		want time.Time
+	}{
+		{RecurringThreadOpts{Frequency: RecurringFrequencyDaily, Hour: 13}, time.Date(2024, 1, 3, 13, 0, 0, 0, time.UTC)},
+		{RecurringThreadOpts{Frequency: RecurringFrequencyDaily, Hour: 12}, time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)},
+		{RecurringThreadOpts{Frequency: RecurringFrequencyDaily, Hour: 9, Minute: 30}, time.Date(2024, 1, 4, 9, 30, 0, 0, time.UTC)},
+		{RecurringThreadOpts{Frequency: RecurringFrequencyWeekly, Weekday: time.Monday, Hour: 8}, time.Date(2024, 1, 8, 8, 0, 0, 0, time.UTC)},
+		{RecurringThreadOpts{Frequency: RecurringFrequencyWeekly, Weekday: time.Wednesday, Hour: 18}, time.Date(2024, 1, 3, 18, 0, 0, 0, time.UTC)},
+		{RecurringThreadOpts{Frequency: RecurringFrequencyWeekly, Weekday: time.Wednesday, Hour: 12}, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, item := range cases {
+		if got := item.opts.nextRun(now); !got.Equal(item.want) {
+			t.Errorf("nextRun(%+v) = %v, want %v", item.opts, got, item.want)
+		}
+	}
+}
+
+func TestRecurringThreadTitle(t *testing.T) {
+	date := time.Date(2024, 3, 7, 23, 0, 0, 0, time.UTC)
+	if got, want := recurringThreadTitle("Weekly thread ({date})", date), "Weekly thread (March 7, 2024)"; got != want {
+		t.Errorf("recurringThreadTitle() = %q, want %q", got, want)
+	}
+	if got, want := recurringThreadTitle("Daily thread", date), "Daily thread"; got != want {
+		t.Errorf("recurringThreadTitle() = %q, want %q", got, want)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/discuitnet/discuit/internal/httperr"
@@ -130,7 +132,24 @@ func NewReport(ctx context.Context, db *sql.DB, community uid.ID, post uid.NullI
 	if err != nil {
 		return nil, err
 	}
-	return GetReport(ctx, db, int(id))
+
+	report, err := GetReport(ctx, db, int(id))
+	if err != nil {
+		return nil, err
+	}
+	if err = report.FetchTarget(ctx, db); err == nil {
+		queueWebhookEvent(db, community, WebhookEventReportNew, report)
+
+		// AutoModerator rules with a reports condition are evaluated on each
+		// new report.
+		switch target := report.Target.(type) {
+		case *Post:
+			runPostAutomod(ctx, db, target, true)
+		case *Comment:
+			runCommentAutomod(ctx, db, target, true)
+		}
+	}
+	return report, nil
 }
 
 // NewPostReport creates a report on post.
@@ -239,17 +258,296 @@ func (r *Report) FetchTarget(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
-// // TakeAction takes action on r by moderator mod.
-// func (r *Report) TakeAction(ctx context.Context, action string, mod luid.ID) error {
-// 	now := time.Now()
-// 	_, err := r.db.ExecContext(ctx, "UPDATE reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE id = ?", action, now, mod, r.ID)
-// 	if err == nil {
-// 		r.ActionTaken = msql.NewNullString(action)
-// 		r.DealtBy.Valid, r.DealtBy.ID = true, mod
-// 		r.DealtAt = msql.NewNullTime(now)
-// 	}
-// 	return err
-// }
+// ReportAction is the action taken by a moderator (or an admin) to resolve a
+// report.
+type ReportAction string
+
+const (
+	ReportActionPostRemoved     = ReportAction("post_removed")
+	ReportActionCommentRemoved  = ReportAction("comment_removed")
+	ReportActionLocked          = ReportAction("locked")
+	ReportActionUserBanned      = ReportAction("user_banned")
+	ReportActionDismissed       = ReportAction("dismissed")
+	ReportActionDeletedByAuthor = ReportAction("deleted_by_author")
+)
+
+// Valid reports whether a is a valid ReportAction.
+func (a ReportAction) Valid() bool {
+	switch a {
+	case ReportActionPostRemoved,
+		ReportActionCommentRemoved,
+		ReportActionLocked,
+		ReportActionUserBanned,
+		ReportActionDismissed,
+		ReportActionDeletedByAuthor:
+		return true
+	}
+	return false
+}
+
+// ReportState is used to filter reports by whether they are resolved or not.
+type ReportState string
+
+const (
+	ReportStateAll      = ReportState("all")
+	ReportStateOpen     = ReportState("open")
+	ReportStateResolved = ReportState("resolved")
+)
+
+// Valid reports whether s is a valid ReportState.
+func (s ReportState) Valid() bool {
+	switch s {
+	case ReportStateAll, ReportStateOpen, ReportStateResolved:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrInvalidReportAction = httperr.NewBadRequest("invalid-report-action", "Invalid report action.")
+	errReportResolved      = httperr.NewBadRequest("report-already-resolved", "Report is already resolved.")
+)
+
+// Resolved returns true if action has been taken on the report.
+func (r *Report) Resolved() bool {
+	return r.DealtAt.Valid
+}
+
+// TakeAction resolves the report with action, taken by the moderator (or admin)
+// mod.
+func (r *Report) TakeAction(ctx context.Context, db *sql.DB, action ReportAction, mod uid.ID) error {
+	if !action.Valid() {
+		return ErrInvalidReportAction
+	}
+	if r.Resolved() {
+		return errReportResolved
+	}
+
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "UPDATE reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE id = ? AND dealt_at IS NULL", action, now, mod, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errReportResolved
+	}
+
+	r.ActionTaken = msql.NewNullString(string(action))
+	r.DealtAt = msql.NewNullTime(now)
+	r.DealtBy = uid.NullID{Valid: true, ID: mod}
+	return nil
+}
+
+// ReportActions are the moderation actions that can be taken, in one go, on the
+// target of a report (see Report.Act).
+type ReportActions struct {
+	Delete          bool       `json:"delete"`
+	DeleteContent   bool       `json:"deleteContent"` // Only for posts.
+	Lock            bool       `json:"lock"`
+	BanAuthor       bool       `json:"banAuthor"`
+	BanExpires      *time.Time `json:"banExpires"` // If nil, the ban is permanent.
+	BanReason       string     `json:"banReason"`
+	NotifyReporters bool       `json:"notifyReporters"`
+}
+
+// action returns the action recorded on the resolved reports. If more than one
+// action is taken, the most severe one is recorded.
+func (a *ReportActions) action(t ReportType) ReportAction {
+	switch {
+	case a.BanAuthor:
+		return ReportActionUserBanned
+	case a.Delete && t == ReportTypePost:
+		return ReportActionPostRemoved
+	case a.Delete:
+		return ReportActionCommentRemoved
+	case a.Lock:
+		return ReportActionLocked
+	}
+	return ""
+}
+
+// openReportsOf returns the ids of the unresolved reports of type t on
+// target, and the users who made them.
+func openReportsOf(ctx context.Context, tx *sql.Tx, target uid.ID, t ReportType) (ids []any, reporters []uid.ID, err error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, created_by FROM reports WHERE target_id = ? AND report_type = ? AND dealt_at IS NULL", target, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       int
+			reporter uid.ID
+		)
+		if err := rows.Scan(&id, &reporter); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		if !slices.Contains(reporters, reporter) {
+			reporters = append(reporters, reporter)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return ids, reporters, nil
+}
+
+// Act takes the moderation actions in actions on the target of the report, on
+// behalf of mod, and resolves the report, along with every other open report on
+// the same target. The target of the report must have already been fetched
+// (see Report.FetchTarget).
+func (r *Report) Act(ctx context.Context, db *sql.DB, mod uid.ID, actions *ReportActions) error {
+	action := actions.action(r.Type)
+	if action == "" {
+		return ErrInvalidReportAction
+	}
+	if r.Target == nil {
+		return errors.New("report target not fetched")
+	}
+
+	g, err := modOrAdminGroup(ctx, db, r.CommunityID, mod)
+	if err != nil {
+		return err
+	}
+
+	var (
+		author     uid.ID
+		targetType string
+		postID     string
+		notif      NotificationReportResolved
+		lock       bool
+		del        bool
+	)
+	switch target := r.Target.(type) {
+	case *Post:
+		author, targetType, postID = target.AuthorID, "post", target.PublicID
+		lock = actions.Lock && !target.Locked && !target.Deleted
+		del = actions.Delete && (!target.Deleted || (actions.DeleteContent && !target.DeletedContent))
+		if del {
+			if err := target.checkDeletable(ctx, db, mod, g, actions.DeleteContent); err != nil {
+				return err
+			}
+		}
+		notif.CommunityName = target.CommunityName
+	case *Comment:
+		author, targetType, postID = target.AuthorID, "comment", target.PostPublicID
+		lock = actions.Lock && !target.Locked && !target.Deleted
+		del = actions.Delete && !target.Deleted
+		notif.CommunityName = target.CommunityName
+	default:
+		return errors.New("unknown report target")
+	}
+
+	var comm *Community // Non-nil if the author is to be banned.
+	if actions.BanAuthor {
+		banned, err := IsUserBannedFromCommunity(ctx, db, r.CommunityID, author)
+		if err != nil {
+			return err
+		}
+		if !banned {
+			if err := validateBan(actions.BanExpires, actions.BanReason); err != nil {
+				return err
+			}
+			if comm, err = GetCommunityByID(ctx, db, r.CommunityID, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	var reporters []uid.ID
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		// The reports to resolve are found before taking any action, because
+		// deleting the target resolves the reports on it (with a possibly
+		// different action).
+		var ids []any
+		if ids, reporters, err = openReportsOf(ctx, tx, r.TargetID, r.Type); err != nil {
+			return err
+		}
+		switch target := r.Target.(type) {
+		case *Post:
+			if lock {
+				if err := target.lockTx(ctx, tx, mod, g, now); err != nil {
+					return err
+				}
+			}
+			if del {
+				if err := target.deleteTx(ctx, tx, db, mod, g, actions.DeleteContent, now); err != nil {
+					return err
+				}
+			}
+		case *Comment:
+			if lock {
+				if err := target.lockTx(ctx, tx, mod, g, now); err != nil {
+					return err
+				}
+			}
+			if del {
+				if err := target.deleteTx(ctx, tx, mod, g, now); err != nil {
+					return err
+				}
+			}
+		}
+		if comm != nil {
+			if err := comm.banUserTx(ctx, tx, mod, g, author, actions.BanExpires, actions.BanReason); err != nil {
+				return err
+			}
+		}
+		if len(ids) > 0 {
+			args := append([]any{action, now, mod}, ids...)
+			if _, err := tx.ExecContext(ctx, "UPDATE reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE id IN "+msql.InClauseQuestionMarks(len(ids)), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch target := r.Target.(type) {
+	case *Post:
+		if lock {
+			target.setLocked(mod, g, now)
+		}
+		if del {
+			target.afterDelete(ctx, db, mod, g, now, true)
+		}
+	case *Comment:
+		if lock {
+			target.setLocked(mod, g, now)
+		}
+		if del {
+			target.afterDelete(ctx, db, mod, g, now)
+		}
+	}
+	if comm != nil {
+		comm.afterBan(db, mod, author, actions.BanExpires, actions.BanReason)
+	}
+
+	r.ActionTaken = msql.NewNullString(string(action))
+	r.DealtAt = msql.NewNullTime(now)
+	r.DealtBy = uid.NullID{Valid: true, ID: mod}
+
+	if actions.NotifyReporters {
+		notif.TargetType = targetType
+		notif.TargetID = r.TargetID
+		notif.PostPublicID = postID
+		notif.Action = action
+		go func() {
+			for _, reporter := range reporters {
+				if err := CreateNotification(context.Background(), db, reporter, NotificationTypeReportResolved, notif); err != nil {
+					log.Printf("Failed to create report_resolved notification (report: %v): %v\n", r.ID, err)
+				}
+			}
+		}()
+	}
+	return nil
+}
 
 // Delete deletes the report permanently.
 func (r *Report) Delete(ctx context.Context, db *sql.DB, mod uid.ID) error {
@@ -258,21 +556,23 @@ func (r *Report) Delete(ctx context.Context, db *sql.DB, mod uid.ID) error {
 }
 
 // GetReports retrives user submitted reports in community. The results are paginated.
-func GetReports(ctx context.Context, db *sql.DB, community uid.ID, t ReportType, limit, page int) ([]*Report, error) {
-	query := msql.BuildSelectQuery("reports", selectReportCols, selectReportJoins, "WHERE reports.community_id = ?")
+func GetReports(ctx context.Context, db *sql.DB, community uid.ID, t ReportType, state ReportState, limit, page int) ([]*Report, error) {
+	where, args := "WHERE reports.community_id = ?", []any{community}
 	if t != ReportTypeAll {
-		query += " AND report_type = ?"
+		where += " AND report_type = ?"
+		args = append(args, t)
 	}
-	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
-
-	var rows *sql.Rows
-	var err error
-	offset := limit * (page - 1)
-	if t == ReportTypeAll {
-		rows, err = db.QueryContext(ctx, query, community, limit, offset)
-	} else {
-		rows, err = db.QueryContext(ctx, query, community, t, limit, offset)
+	switch state {
+	case ReportStateOpen:
+		where += " AND reports.dealt_at IS NULL"
+	case ReportStateResolved:
+		where += " AND reports.dealt_at IS NOT NULL"
 	}
+	where += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, limit*(page-1))
+
+	query := msql.BuildSelectQuery("reports", selectReportCols, selectReportJoins, where)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -324,12 +624,16 @@ func RemoveAllReportsOfCommunity(ctx context.Context, db *sql.DB, community uid.
 	return err
 }
 
-func RemoveAllReportsOfPost(ctx context.Context, db *sql.DB, post uid.ID) error {
-	_, err := db.ExecContext(ctx, "DELETE FROM reports WHERE post_id = ?", post)
+// ResolveAllReportsOfPost resolves all the open reports made on the post, and
+// on its comments, with action.
+func ResolveAllReportsOfPost(ctx context.Context, db *sql.DB, post uid.ID, action ReportAction, mod uid.ID) error {
+	_, err := db.ExecContext(ctx, "UPDATE reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE post_id = ? AND dealt_at IS NULL", action, time.Now(), mod, post)
 	return err
 }
 
-func RemoveAllReportsOfComment(ctx context.Context, db *sql.DB, comment uid.ID) error {
-	_, err := db.ExecContext(ctx, "DELETE FROM reports WHERE target_id = ? AND report_type = ?", comment, ReportTypeComment)
+// ResolveAllReportsOfComment resolves all the open reports made on the comment
+// with action.
+func ResolveAllReportsOfComment(ctx context.Context, db *sql.DB, comment uid.ID, action ReportAction, mod uid.ID) error {
+	_, err := db.ExecContext(ctx, "UPDATE reports SET action_taken = ?, dealt_at = ?, dealt_by = ? WHERE target_id = ? AND report_type = ? AND dealt_at IS NULL", action, time.Now(), mod, comment, ReportTypeComment)
 	return err
 }
@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// maxDiffTableSize is the maximum size of the LCS table (in cells) computed
+// when diffing two texts. If the changed region of two texts is bigger than
+// this, the diff is reported as the deletion of the one and the insertion of the
+// other.
+const maxDiffTableSize = 1 << 20
+
+var errRevisionsForbidden = httperr.NewForbidden("revisions-forbidden", "Only the author, the moderators, and the admins can view the revisions.")
+
+// A PostRevision is a version of a post, as it was before it was edited (or as
+// it is now, if Current is true).
+type PostRevision struct {
+	ID        int             `json:"id"` // Zero for the current version.
+	PostID    uid.ID          `json:"postId"`
+	Title     string          `json:"title"`
+	Body      msql.NullString `json:"body"`
+	Link      *PostLink       `json:"link"`
+	WrittenAt time.Time       `json:"writtenAt"`
+	Current   bool            `json:"current"`
+}
+
+// A CommentRevision is a version of a comment, as it was before it was edited
+// (or as it is now, if Current is true).
+type CommentRevision struct {
+	ID        int       `json:"id"` // Zero for the current version.
+	CommentID uid.ID    `json:"commentId"`
+	Body      string    `json:"body"`
+	WrittenAt time.Time `json:"writtenAt"`
+	Current   bool      `json:"current"`
+}
+
+// DiffOpType is the type of a DiffOp.
+type DiffOpType string
+
+const (
+	DiffOpEqual  = DiffOpType("equal")
+	DiffOpInsert = DiffOpType("insert")
+	DiffOpDelete = DiffOpType("delete")
+)
+
+// A DiffOp is a run of lines that's either unchanged, inserted, or deleted
+// between two versions of a text.
+type DiffOp struct {
+	Type DiffOpType `json:"type"`
+	Text string     `json:"text"`
+}
+
+// RevisionDiff is what changed between two consecutive revisions. Fields that
+// did not change are nil.
+type RevisionDiff struct {
+	From  int      `json:"from"` // Revision ID.
+	To    int      `json:"to"`   // Revision ID.
+	Title []DiffOp `json:"title,omitempty"`
+	Body  []DiffOp `json:"body,omitempty"`
+	Link  []DiffOp `json:"link,omitempty"`
+}
+
+// diffLines returns a line-by-line diff of a and b. Consecutive lines of the
+// same op type are joined together.
+func diffLines(a, b string) []DiffOp {
+	if a == b {
+		if a == "" {
+			return nil
+		}
+		return []DiffOp{{Type: DiffOpEqual, Text: a}}
+	}
+
+	x, y := splitLines(a), splitLines(b)
+
+	var ops []DiffOp
+	add := func(t DiffOpType, line string) {
+		if n := len(ops); n > 0 && ops[n-1].Type == t {
+			ops[n-1].Text += line
+			return
+		}
+		ops = append(ops, DiffOp{Type: t, Text: line})
+	}
+
+	// Strip the common prefix and suffix, so that the LCS table is computed
+	// only for the changed region.
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	for _, line := range x[:prefix] {
+		add(DiffOpEqual, line)
+	}
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+
+	if (len(mx)+1)*(len(my)+1) > maxDiffTableSize {
+		for _, line := range mx {
+			add(DiffOpDelete, line)
+		}
+		for _, line := range my {
+			add(DiffOpInsert, line)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of mx[i:]
+		// and my[j:].
+		lcs := make([][]int, len(mx)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(my)+1)
+		}
+		for i := len(mx) - 1; i >= 0; i-- {
+			for j := len(my) - 1; j >= 0; j-- {
+				if mx[i] == my[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(mx) && j < len(my) {
+			switch {
+			case mx[i] == my[j]:
+				add(DiffOpEqual, mx[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				add(DiffOpDelete, mx[i])
+				i++
+			default:
+				add(DiffOpInsert, my[j])
+				j++
+			}
+		}
+		for ; i < len(mx); i++ {
+			add(DiffOpDelete, mx[i])
+		}
+		for ; j < len(my); j++ {
+			add(DiffOpInsert, my[j])
+		}
+	}
+
+	for _, line := range x[len(x)-suffix:] {
+		add(DiffOpEqual, line)
+	}
+	return ops
+}
+
+// splitLines splits s into lines, each line retaining its trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// canViewRevisions reports whether viewer can view the revisions of a post or a
+// comment by author in community.
+func canViewRevisions(ctx context.Context, db *sql.DB, viewer, author, community uid.ID) (bool, error) {
+	if viewer == author {
+		return true, nil
+	}
+	return UserModOrAdmin(ctx, db, community, viewer)
+}
+
+// savePostRevision saves the version of the post currently in the database as a
+// revision, if it differs from the new title and body. A nil newBody means that
+// the body is not being changed.
+func savePostRevision(ctx context.Context, tx *sql.Tx, post uid.ID, newTitle string, newBody *msql.NullString) error {
+	var (
+		title     string
+		body      msql.NullString
+		link      []byte
+		createdAt time.Time
+		editedAt  msql.NullTime
+	)
+	row := tx.QueryRowContext(ctx, "SELECT title, body, link_info, created_at, edited_at FROM posts WHERE id = ? FOR UPDATE", post)
+	if err := row.Scan(&title, &body, &link, &createdAt, &editedAt); err != nil {
+		return err
+	}
+	if title == newTitle && (newBody == nil || body == *newBody) {
+		return nil
+	}
+
+	writtenAt := createdAt
+	if editedAt.Valid {
+		writtenAt = editedAt.Time
+	}
+	var linkInfo any
+	if link != nil {
+		linkInfo = link
+	}
+	query, args := msql.BuildInsertQuery("post_revisions", []msql.ColumnValue{
+		{Name: "post_id", Value: post},
+		{Name: "title", Value: title},
+		{Name: "body", Value: body},
+		{Name: "link_info", Value: linkInfo},
+		{Name: "written_at", Value: writtenAt},
+	})
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// saveCommentRevision saves the version of the comment currently in the
+// database as a revision, if it differs from newBody.
+func saveCommentRevision(ctx context.Context, tx *sql.Tx, comment uid.ID, newBody string) error {
+	var (
+		body      msql.NullString
+		createdAt time.Time
+		editedAt  msql.NullTime
+	)
+	row := tx.QueryRowContext(ctx, "SELECT body, created_at, edited_at FROM comments WHERE id = ? FOR UPDATE", comment)
+	if err := row.Scan(&body, &createdAt, &editedAt); err != nil {
+		return err
+	}
+	if body.String == newBody {
+		return nil
+	}
+
+	writtenAt := createdAt
+	if editedAt.Valid {
+		writtenAt = editedAt.Time
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO comment_revisions (comment_id, body, written_at) VALUES (?, ?, ?)", comment, body, writtenAt)
+	return err
+}
+
+// GetRevisions returns all the versions of the post, oldest first, with the
+// current version of the post being the last item. Only the author, the mods of
+// the community, and the admins are permitted to view revisions.
+func (p *Post) GetRevisions(ctx context.Context, db *sql.DB, viewer uid.ID) ([]*PostRevision, error) {
+	if ok, err := canViewRevisions(ctx, db, viewer, p.AuthorID, p.CommunityID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRevisionsForbidden
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, post_id, title, body, link_info, written_at FROM post_revisions WHERE post_id = ? ORDER BY id", p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []*PostRevision
+	for rows.Next() {
+		rev := &PostRevision{}
+		var link []byte
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.Title, &rev.Body, &link, &rev.WrittenAt); err != nil {
+			return nil, err
+		}
+		if link != nil {
+			dbLink := &postLink{}
+			if err := json.Unmarshal(link, dbLink); err != nil {
+				return nil, err
+			}
+			rev.Link = dbLink.PostLink()
+		}
+		revs = append(revs, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	current := &PostRevision{
+		PostID:    p.ID,
+		Title:     p.Title,
+		Body:      p.Body,
+		WrittenAt: p.CreatedAt,
+		Current:   true,
+	}
+	if p.link != nil {
+		current.Link = p.link.PostLink()
+	}
+	if p.EditedAt.Valid {
+		current.WrittenAt = p.EditedAt.Time
+	}
+	return append(revs, current), nil
+}
+
+// PostRevisionsDiffs returns the diffs between each consecutive pair of revs.
+func PostRevisionsDiffs(revs []*PostRevision) []*RevisionDiff {
+	diffs := []*RevisionDiff{}
+	for i := 1; i < len(revs); i++ {
+		from, to := revs[i-1], revs[i]
+		diff := &RevisionDiff{From: from.ID, To: to.ID}
+		if from.Title != to.Title {
+			diff.Title = diffLines(from.Title, to.Title)
+		}
+		if from.Body != to.Body {
+			diff.Body = diffLines(from.Body.String, to.Body.String)
+		}
+		var fromURL, toURL string
+		if from.Link != nil {
+			fromURL = from.Link.URL
+		}
+		if to.Link != nil {
+			toURL = to.Link.URL
+		}
+		if fromURL != toURL {
+			diff.Link = diffLines(fromURL, toURL)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// GetRevisions returns all the versions of the comment, oldest first, with the
+// current version of the comment being the last item. Only the author, the mods
+// of the community, and the admins are permitted to view revisions.
+func (c *Comment) GetRevisions(ctx context.Context, db *sql.DB, viewer uid.ID) ([]*CommentRevision, error) {
+	if ok, err := canViewRevisions(ctx, db, viewer, c.AuthorID, c.CommunityID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errRevisionsForbidden
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, comment_id, body, written_at FROM comment_revisions WHERE comment_id = ? ORDER BY id", c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []*CommentRevision
+	for rows.Next() {
+		rev := &CommentRevision{}
+		var body msql.NullString
+		if err := rows.Scan(&rev.ID, &rev.CommentID, &body, &rev.WrittenAt); err != nil {
+			return nil, err
+		}
+		rev.Body = body.String
+		revs = append(revs, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	current := &CommentRevision{
+		CommentID: c.ID,
+		Body:      c.Body,
+		WrittenAt: c.CreatedAt,
+		Current:   true,
+	}
+	if c.EditedAt.Valid {
+		current.WrittenAt = c.EditedAt.Time
+	}
+	return append(revs, current), nil
+}
+
+// CommentRevisionsDiffs returns the diffs between each consecutive pair of
+// revs.
+func CommentRevisionsDiffs(revs []*CommentRevision) []*RevisionDiff {
+	diffs := []*RevisionDiff{}
+	for i := 1; i < len(revs); i++ {
+		from, to := revs[i-1], revs[i]
+		diffs = append(diffs, &RevisionDiff{
+			From: from.ID,
+			To:   to.ID,
+			Body: diffLines(from.Body, to.Body),
+		})
+	}
+	return diffs
+}
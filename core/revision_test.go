@@ -0,0 +1,34 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want []DiffOp
+	}{
+		{"", "", nil},
+		{"same", "same", []DiffOp{{DiffOpEqual, "same"}}},
+		{"", "new", []DiffOp{{DiffOpInsert, "new"}}},
+		{"old", "", []DiffOp{{DiffOpDelete, "old"}}},
+		{"old", "new", []DiffOp{{DiffOpDelete, "old"}, {DiffOpInsert, "new"}}},
+		{
+			"a\nb\nc\n",
+			"a\nx\nc\n",
+			[]DiffOp{{DiffOpEqual, "a\n"}, {DiffOpDelete, "b\n"}, {DiffOpInsert, "x\n"}, {DiffOpEqual, "c\n"}},
+		},
+		{
+			"a\nb\nc\nd\n",
+			"b\nc\nd\ne\n",
+			[]DiffOp{{DiffOpDelete, "a\n"}, {DiffOpEqual, "b\nc\nd\n"}, {DiffOpInsert, "e\n"}},
+		},
+	}
+	for _, item := range cases {
+		if got := diffLines(item.a, item.b); !reflect.DeepEqual(got, item.want) {
+			t.Errorf("diffLines(%q, %q) = %v, want %v", item.a, item.b, got, item.want)
+		}
+	}
+}
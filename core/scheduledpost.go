@@ -0,0 +1,443 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	// Posts can be scheduled to be published between these durations from now.
+	minPostScheduleAhead = time.Minute
+	maxPostScheduleAhead = time.Hour * 24 * 90
+)
+
+var (
+	ErrScheduledPostNotFound  = httperr.NewNotFound("scheduled-post-not-found", "Scheduled post not found.")
+	errScheduledPostPublished = httperr.NewBadRequest("scheduled-post-published", "Post is already published.")
+	errInvalidPublishAt       = httperr.NewBadRequest("invalid-publish-at", "Invalid publish time.")
+)
+
+// ScheduledPost is a post that is published, by a background task, at a later
+// time (PublishAt). Until it is published, it is visible only to its author.
+type ScheduledPost struct {
+	ID            uid.ID          `json:"id"`
+	AuthorID      uid.ID          `json:"userId"`
+	CommunityID   uid.ID          `json:"communityId"`
+	CommunityName string          `json:"communityName"`
+	PostedAs      UserGroup       `json:"userGroup"`
+	Type          PostType        `json:"type"`
+	Title         string          `json:"title"`
+	Body          msql.NullString `json:"body"`
+	URL           msql.NullString `json:"url"`    // For link posts.
+	Images        []*ImageUpload  `json:"images"` // For image posts.
+	Poll          *ScheduledPoll  `json:"poll"`   // For poll posts.
+
+	// Whether to pin the post to the community once it is published.
+	Pin bool `json:"pin"`
+
+	PublishAt   time.Time       `json:"publishAt"`
+	PublishedAt msql.NullTime   `json:"publishedAt"`
+	PostID      uid.NullID      `json:"postId"` // The published post.
+	Error       msql.NullString `json:"error"`  // Why publishing failed (or only partly succeeded), if it did.
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// ScheduledPoll is the poll of a scheduled poll post.
+type ScheduledPoll struct {
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multipleChoice"`
+	ClosesAt       *time.Time `json:"closesAt"`
+}
+
+var selectScheduledPostCols = []string{
+	"scheduled_posts.id",
+	"scheduled_posts.user_id",
+	"scheduled_posts.community_id",
+	"communities.name",
+	"scheduled_posts.user_group",
+	"scheduled_posts.type",
+	"scheduled_posts.title",
+	"scheduled_posts.body",
+	"scheduled_posts.link_url",
+	"scheduled_posts.images",
+	"scheduled_posts.poll",
+	"scheduled_posts.pin",
+	"scheduled_posts.publish_at",
+	"scheduled_posts.published_at",
+	"scheduled_posts.post_id",
+	"scheduled_posts.error",
+	"scheduled_posts.created_at",
+}
+
+var selectScheduledPostJoins = []string{
+	"INNER JOIN communities ON communities.id = scheduled_posts.community_id",
+}
+
+func scanScheduledPosts(rows *sql.Rows) ([]*ScheduledPost, error) {
+	defer rows.Close()
+
+	var posts []*ScheduledPost
+	for rows.Next() {
+		sp := &ScheduledPost{}
+		var imagesJSON, pollJSON []byte
+		err := rows.Scan(
+			&sp.ID,
+			&sp.AuthorID,
+			&sp.CommunityID,
+			&sp.CommunityName,
+			&sp.PostedAs,
+			&sp.Type,
+			&sp.Title,
+			&sp.Body,
+			&sp.URL,
+			&imagesJSON,
+			&pollJSON,
+			&sp.Pin,
+			&sp.PublishAt,
+			&sp.PublishedAt,
+			&sp.PostID,
+			&sp.Error,
+			&sp.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if imagesJSON != nil {
+			if err := json.Unmarshal(imagesJSON, &sp.Images); err != nil {
+				return nil, err
+			}
+		}
+		if pollJSON != nil {
+			sp.Poll = &ScheduledPoll{}
+			if err := json.Unmarshal(pollJSON, sp.Poll); err != nil {
+				return nil, err
+			}
+		}
+		posts = append(posts, sp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func getScheduledPosts(ctx context.Context, db *sql.DB, where string, args ...any) ([]*ScheduledPost, error) {
+	query := msql.BuildSelectQuery("scheduled_posts", selectScheduledPostCols, selectScheduledPostJoins, where)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduledPosts(rows)
+}
+
+// GetScheduledPost returns the scheduled post with ID id.
+func GetScheduledPost(ctx context.Context, db *sql.DB, id uid.ID) (*ScheduledPost, error) {
+	posts, err := getScheduledPosts(ctx, db, "WHERE scheduled_posts.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, ErrScheduledPostNotFound
+	}
+	return posts[0], nil
+}
+
+// GetScheduledPosts returns the scheduled posts of user that are yet to be
+// published, or that failed to be published, earliest first.
+func GetScheduledPosts(ctx context.Context, db *sql.DB, user uid.ID) ([]*ScheduledPost, error) {
+	posts, err := getScheduledPosts(ctx, db, "WHERE scheduled_posts.user_id = ? AND scheduled_posts.post_id IS NULL ORDER BY scheduled_posts.publish_at", user)
+	if err != nil {
+		return nil, err
+	}
+	if posts == nil {
+		posts = []*ScheduledPost{}
+	}
+	return posts, nil
+}
+
+// validatePublishAt checks that t is within the allowed range for scheduling
+// posts.
+func validatePublishAt(t, now time.Time) error {
+	if t.Before(now.Add(minPostScheduleAhead)) || t.After(now.Add(maxPostScheduleAhead)) {
+		return errInvalidPublishAt
+	}
+	return nil
+}
+
+// validate checks whether sp can be scheduled (or re-scheduled), with most of
+// the same checks that are done when a post is created.
+func (sp *ScheduledPost) validate(ctx context.Context, db *sql.DB) error {
+	if err := validatePublishAt(sp.PublishAt, time.Now()); err != nil {
+		return err
+	}
+	if err := validatePost(sp.Title, sp.Body.String); err != nil {
+		return err
+	}
+	sp.Title = utils.TruncateUnicodeString(sp.Title, maxPostTitleLength)
+	sp.Body.String = utils.TruncateUnicodeString(sp.Body.String, maxPostBodyLength)
+	sp.Body.Valid = sp.Body.String != ""
+
+	if err := checkUserCanPost(ctx, db, sp.CommunityID, sp.AuthorID); err != nil {
+		return err
+	}
+
+	// Check permissions for posting as a mod or admin, and for pinning.
+	isMod, err := UserMod(ctx, db, sp.CommunityID, sp.AuthorID)
+	if err != nil {
+		return err
+	}
+	switch sp.PostedAs {
+	case UserGroupNormal:
+	case UserGroupMods:
+		if !isMod {
+			return errNotMod
+		}
+	case UserGroupAdmins:
+		if isAdmin, err := IsAdmin(db, &sp.AuthorID); err != nil {
+			return err
+		} else if !isAdmin {
+			return errNotAdmin
+		}
+	default:
+		return errInvalidUserGroup
+	}
+	if sp.Pin && !isMod {
+		return errNotMod
+	}
+
+	switch sp.Type {
+	case PostTypeText:
+	case PostTypeImage:
+		if len(sp.Images) == 0 {
+			return errImageNotFound
+		}
+	case PostTypeLink:
+		u, err := parsePostLink(sp.URL.String)
+		if err != nil {
+			return err
+		}
+		sp.URL = msql.NewNullString(u.String())
+	case PostTypePoll:
+		if sp.Poll == nil {
+			return httperr.NewBadRequest("poll-missing", "Poll is missing.")
+		}
+		if _, err := newPollOpts(sp.Poll.Options, sp.Poll.MultipleChoice, sp.Poll.ClosesAt, sp.PublishAt); err != nil {
+			return err
+		}
+	default:
+		return errPostTypeUnsupported
+	}
+	return nil
+}
+
+// NewScheduledPost schedules sp to be published at sp.PublishAt. The fields
+// ID, CommunityName, PublishedAt, PostID, Error, and CreatedAt of sp are
+// ignored.
+func NewScheduledPost(ctx context.Context, db *sql.DB, sp *ScheduledPost) (*ScheduledPost, error) {
+	if err := sp.validate(ctx, db); err != nil {
+		return nil, err
+	}
+
+	var imagesJSON, pollJSON []byte
+	var err error
+	if sp.Type == PostTypeImage {
+		recordIDs := make([]uid.ID, len(sp.Images))
+		for i := range sp.Images {
+			recordIDs[i] = sp.Images[i].ImageID
+		}
+		if _, err := images.GetImageRecords(ctx, db, recordIDs...); err != nil {
+			if err == images.ErrImageNotFound {
+				return nil, errImageNotFound
+			}
+			return nil, err
+		}
+		if imagesJSON, err = json.Marshal(sp.Images); err != nil {
+			return nil, err
+		}
+	}
+	if sp.Type == PostTypePoll {
+		if pollJSON, err = json.Marshal(sp.Poll); err != nil {
+			return nil, err
+		}
+	}
+
+	id := uid.New()
+	err = msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		query, args := msql.BuildInsertQuery("scheduled_posts", []msql.ColumnValue{
+			{Name: "id", Value: id},
+			{Name: "user_id", Value: sp.AuthorID},
+			{Name: "community_id", Value: sp.CommunityID},
+			{Name: "user_group", Value: sp.PostedAs},
+			{Name: "type", Value: sp.Type},
+			{Name: "title", Value: sp.Title},
+			{Name: "body", Value: sp.Body},
+			{Name: "link_url", Value: sp.URL},
+			{Name: "images", Value: imagesJSON},
+			{Name: "poll", Value: pollJSON},
+			{Name: "pin", Value: sp.Pin},
+			{Name: "publish_at", Value: sp.PublishAt},
+		})
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		// Keep the images from being removed as unused temporary images
+		// until the post is published. Only the author's own images, which
+		// are not yet used elsewhere, can be claimed; so every image of a
+		// scheduled post is one that was taken from temp_images.
+		for _, image := range sp.Images {
+			res, err := tx.ExecContext(ctx, "DELETE FROM temp_images WHERE image_id = ? AND user_id = ?", image.ImageID, sp.AuthorID)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return errImageNotFound
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetScheduledPost(ctx, db, id)
+}
+
+// Update saves the title, the body, and the publish time of sp, which must not
+// yet be published.
+func (sp *ScheduledPost) Update(ctx context.Context, db *sql.DB) error {
+	if sp.PublishedAt.Valid {
+		return errScheduledPostPublished
+	}
+	if err := sp.validate(ctx, db); err != nil {
+		return err
+	}
+	res, err := db.ExecContext(ctx, "UPDATE scheduled_posts SET title = ?, body = ?, publish_at = ? WHERE id = ? AND published_at IS NULL", sp.Title, sp.Body, sp.PublishAt, sp.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errScheduledPostPublished
+	}
+	return nil
+}
+
+// Delete deletes sp. If sp is not yet published, its images (if any), which
+// were taken from the author's temporary images when sp was scheduled, are
+// queued for removal again, unless they have since been used in a post.
+func (sp *ScheduledPost) Delete(ctx context.Context, db *sql.DB) error {
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if !sp.PostID.Valid {
+			for _, image := range sp.Images {
+				query := "INSERT INTO temp_images (user_id, image_id) SELECT ?, ? FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM post_images WHERE image_id = ?)"
+				if _, err := tx.ExecContext(ctx, query, sp.AuthorID, image.ImageID, image.ImageID); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM scheduled_posts WHERE id = ?", sp.ID)
+		return err
+	})
+}
+
+// GetDueScheduledPosts returns at most limit scheduled posts that are due to be
+// published.
+func GetDueScheduledPosts(ctx context.Context, db *sql.DB, limit int) ([]*ScheduledPost, error) {
+	return getScheduledPosts(ctx, db, "WHERE scheduled_posts.published_at IS NULL AND scheduled_posts.publish_at <= ? ORDER BY scheduled_posts.publish_at LIMIT ?", time.Now(), limit)
+}
+
+// Publish creates the post of sp, and pins it to the community if sp.Pin is
+// true. A scheduled post is attempted to be published only once; if it fails,
+// the error is recorded in sp.Error (and returned). Failing to post as
+// sp.PostedAs, or to pin the post, once the post is created, is not fatal; it's
+// only recorded in sp.Error.
+func (sp *ScheduledPost) Publish(ctx context.Context, db *sql.DB, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (*Post, error) {
+	// Claim the scheduled post, so that it's not published twice.
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "UPDATE scheduled_posts SET published_at = ? WHERE id = ? AND published_at IS NULL", now, sp.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errScheduledPostPublished
+	}
+	sp.PublishedAt = msql.NewNullTime(now)
+
+	post, err := sp.createPost(ctx, db, newUserPointsThreshold, newUserAgeThreshold)
+	if err != nil {
+		if dbErr := sp.setError(ctx, db, err); dbErr != nil {
+			return nil, dbErr
+		}
+		return nil, fmt.Errorf("publishing scheduled post %v: %w", sp.ID, err)
+	}
+
+	// The images of sp now belong to the post, so post_id is set before
+	// anything else can fail (see ScheduledPost.Delete).
+	sp.PostID = uid.NullID{Valid: true, ID: post.ID}
+	if _, err := db.ExecContext(ctx, "UPDATE scheduled_posts SET post_id = ? WHERE id = ?", post.ID, sp.ID); err != nil {
+		return nil, err
+	}
+
+	var warning error
+	if sp.PostedAs != UserGroupNormal {
+		if err := post.ChangeUserGroup(ctx, db, sp.AuthorID, sp.PostedAs); err != nil {
+			warning = fmt.Errorf("post published, but not as %s: %w", sp.PostedAs, err)
+		}
+	}
+	if sp.Pin {
+		if err := post.Pin(ctx, db, sp.AuthorID, false, false, false); err != nil {
+			warning = errors.Join(warning, fmt.Errorf("post published, but not pinned: %w", err))
+		}
+	}
+	if warning != nil {
+		log.Printf("Scheduled post %v: %v\n", sp.ID, warning)
+		if err := sp.setError(ctx, db, warning); err != nil {
+			return nil, err
+		}
+	}
+	return post, nil
+}
+
+// setError records err in sp.Error.
+func (sp *ScheduledPost) setError(ctx context.Context, db *sql.DB, err error) error {
+	sp.Error = msql.NewNullString(utils.TruncateUnicodeString(err.Error(), 255))
+	_, dbErr := db.ExecContext(ctx, "UPDATE scheduled_posts SET error = ? WHERE id = ?", sp.Error, sp.ID)
+	return dbErr
+}
+
+func (sp *ScheduledPost) createPost(ctx context.Context, db *sql.DB, newUserPointsThreshold int, newUserAgeThreshold time.Duration) (post *Post, err error) {
+	switch sp.Type {
+	case PostTypeText:
+		post, err = CreateTextPost(ctx, db, sp.AuthorID, sp.CommunityID, sp.Title, sp.Body.String, newUserPointsThreshold, newUserAgeThreshold)
+	case PostTypeImage:
+		post, err = CreateImagePost(ctx, db, sp.AuthorID, sp.CommunityID, sp.Title, sp.Images, newUserPointsThreshold, newUserAgeThreshold)
+	case PostTypeLink:
+		post, err = CreateLinkPost(ctx, db, sp.AuthorID, sp.CommunityID, sp.Title, sp.URL.String, newUserPointsThreshold, newUserAgeThreshold)
+	case PostTypePoll:
+		if sp.Poll == nil {
+			return nil, httperr.NewBadRequest("poll-missing", "Poll is missing.")
+		}
+		post, err = CreatePollPost(ctx, db, sp.AuthorID, sp.CommunityID, sp.Title, sp.Body.String, sp.Poll.Options, sp.Poll.MultipleChoice, sp.Poll.ClosesAt, newUserPointsThreshold, newUserAgeThreshold)
+	default:
+		return nil, errPostTypeUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
@@ -0,0 +1,374 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	minSearchQueryLength = 2
+	maxSearchQueryLength = 200 // in bytes
+	maxSearchQueryTerms  = 16
+)
+
+// SearchType is the kind of item a search is performed on.
+type SearchType string
+
+const (
+	SearchTypePosts       = SearchType("posts")
+	SearchTypeComments    = SearchType("comments")
+	SearchTypeCommunities = SearchType("communities")
+	SearchTypeUsers       = SearchType("users")
+)
+
+// Valid reports whether t is a valid SearchType.
+func (t SearchType) Valid() bool {
+	switch t {
+	case SearchTypePosts, SearchTypeComments, SearchTypeCommunities, SearchTypeUsers:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrInvalidSearchQuery = httperr.NewBadRequest("invalid-search-query", "Invalid search query.")
+	ErrInvalidSearchType  = httperr.NewBadRequest("invalid-search-type", "Invalid search type.")
+	ErrInvalidSearchSort  = httperr.NewBadRequest("invalid-search-sort", "Invalid search sort (only latest and all are supported).")
+)
+
+// SearchOptions are the parameters of a search. The Community, Author,
+// PostType, From, and To filters are optional and apply only to the search
+// types where they make sense (PostType only to posts, for instance).
+type SearchOptions struct {
+	Query     string
+	Type      SearchType
+	Sort      FeedSort // Either FeedSortLatest or FeedSortTopAll.
+	Viewer    *uid.ID
+	Community *uid.ID
+	Author    *uid.ID
+	PostType  *PostType
+	From, To  *time.Time // Created at range.
+	Limit     int
+	Next      string // The pagination cursor, taken from previous API response.
+}
+
+// SearchResultSet is a page of search results. Only the slice corresponding to
+// the requested SearchType is set.
+type SearchResultSet struct {
+	Type        SearchType   `json:"type"`
+	Posts       []*Post      `json:"posts"`
+	Comments    []*Comment   `json:"comments"`
+	Communities []*Community `json:"communities"`
+	Users       []*User      `json:"users"`
+	Next        any          `json:"next"`
+}
+
+// searchBooleanQuery converts q, a user-inputted search string, to a query
+// suitable for a MATCH ... AGAINST (... IN BOOLEAN MODE) clause, in which
+// every term of q is required and prefix-matched. The characters that have
+// special meaning in boolean mode are stripped from q. An empty string is
+// returned if q has no searchable terms.
+func searchBooleanQuery(q string) string {
+	q = strings.Map(func(r rune) rune {
+		switch r {
+		case '+', '-', '<', '>', '(', ')', '~', '*', '"', '@', '\'':
+			return ' '
+		}
+		return r
+	}, q)
+
+	var b strings.Builder
+	for i, term := range strings.Fields(q) {
+		if i == maxSearchQueryTerms {
+			break
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString("+" + term + "*")
+	}
+	return b.String()
+}
+
+// whereSearchFilters appends the filters in opts to where. The table name is
+// used to qualify column names.
+func (o *SearchOptions) whereSearchFilters(where, table string, args []any) (string, []any) {
+	if o.Community != nil {
+		where += "AND " + table + ".community_id = ? "
+		args = append(args, *o.Community)
+	}
+	if o.Author != nil {
+		where += "AND " + table + ".user_id = ? "
+		args = append(args, *o.Author)
+	}
+	if o.From != nil {
+		where += "AND " + table + ".created_at >= ? "
+		args = append(args, *o.From)
+	}
+	if o.To != nil {
+		where += "AND " + table + ".created_at <= ? "
+		args = append(args, *o.To)
+	}
+	return where, args
+}
+
+// whereSearchCursor appends the pagination condition (and the ORDER BY and
+// LIMIT clauses) to where. The cursors are of the same form as those of the
+// feeds: an ID for the latest sort, and a points-ID pair for the top sort.
+func (o *SearchOptions) whereSearchCursor(where, table string, args []any) (string, []any, error) {
+	fo := &FeedOptions{Next: o.Next}
+	if o.Sort == FeedSortTopAll {
+		if o.Next != "" {
+			nextPoints, nextID, err := fo.nextPointsID()
+			if err != nil {
+				return "", nil, err
+			}
+			where += "AND (" + table + ".points, " + table + ".id) <= (?, ?) "
+			args = append(args, nextPoints, nextID)
+		}
+		where += "ORDER BY " + table + ".points DESC, " + table + ".id DESC LIMIT ?"
+	} else {
+		if o.Next != "" {
+			nextID, err := fo.nextID()
+			if err != nil {
+				return "", nil, err
+			}
+			where += "AND " + table + ".id <= ? "
+			args = append(args, nextID)
+		}
+		where += "ORDER BY " + table + ".id DESC LIMIT ?"
+	}
+	args = append(args, o.Limit+1)
+	return where, args, nil
+}
+
+// nextSearchCursor returns the cursor of the item (with the given points and
+// id) that begins the next page.
+func nextSearchCursor(sort FeedSort, points int, id uid.ID) any {
+	if sort == FeedSortTopAll {
+		return strconv.Itoa(points) + "." + id.String()
+	}
+	return id
+}
+
+// Search performs a full-text search of the type opts.Type. Posts and comments
+// of users (and communities) that are muted by opts.Viewer, and posts that are
+// hidden by opts.Viewer, are excluded from the results.
+func Search(ctx context.Context, db *sql.DB, opts *SearchOptions) (*SearchResultSet, error) {
+	if n := len(strings.TrimSpace(opts.Query)); n < minSearchQueryLength || n > maxSearchQueryLength {
+		return nil, ErrInvalidSearchQuery
+	}
+	if !opts.Type.Valid() {
+		return nil, ErrInvalidSearchType
+	}
+	if !(opts.Sort == FeedSortLatest || opts.Sort == FeedSortTopAll) {
+		return nil, ErrInvalidSearchSort
+	}
+
+	match := searchBooleanQuery(opts.Query)
+	if match == "" {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	switch opts.Type {
+	case SearchTypePosts:
+		return searchPosts(ctx, db, match, opts)
+	case SearchTypeComments:
+		return searchComments(ctx, db, match, opts)
+	case SearchTypeCommunities:
+		return searchCommunities(ctx, db, match, opts)
+	default:
+		return searchUsers(ctx, db, match, opts)
+	}
+}
+
+func searchPosts(ctx context.Context, db *sql.DB, match string, opts *SearchOptions) (*SearchResultSet, error) {
+	loggedIn := opts.Viewer != nil
+	var args []any
+	if loggedIn {
+		args = append(args, *opts.Viewer, *opts.Viewer)
+	}
+
+	where := "WHERE MATCH (posts.title, posts.body) AGAINST (? IN BOOLEAN MODE) AND posts.deleted = FALSE AND posts.pending = FALSE "
+	args = append(args, match)
+	where, args = opts.whereSearchFilters(where, "posts", args)
+	if opts.PostType != nil {
+		where += "AND posts.type = ? "
+		args = append(args, *opts.PostType)
+	}
+	if loggedIn {
+		where, args = whereMutedAndHidden(where, "posts", args, *opts.Viewer, true)
+	}
+
+	where, args, err := opts.whereSearchCursor(where, "posts", args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, buildSelectPostQuery(loggedIn, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := scanPosts(ctx, db, rows, opts.Viewer)
+	if err != nil && err != errPostNotFound {
+		return nil, err
+	}
+
+	set := &SearchResultSet{Type: SearchTypePosts, Posts: []*Post{}}
+	if len(posts) > opts.Limit {
+		set.Next = nextSearchCursor(opts.Sort, posts[opts.Limit].Points, posts[opts.Limit].ID)
+		posts = posts[:opts.Limit]
+	}
+	if posts != nil {
+		set.Posts = posts
+	}
+	return set, nil
+}
+
+func searchComments(ctx context.Context, db *sql.DB, match string, opts *SearchOptions) (*SearchResultSet, error) {
+	loggedIn := opts.Viewer != nil
+	var args []any
+	if loggedIn {
+		args = append(args, *opts.Viewer)
+	}
+
+	where := "WHERE MATCH (comments.body) AGAINST (? IN BOOLEAN MODE) AND comments.deleted_at IS NULL "
+	args = append(args, match)
+	where, args = opts.whereSearchFilters(where, "comments", args)
+	if loggedIn {
+		where, args = whereMutedAndHidden(where, "comments", args, *opts.Viewer, true)
+	}
+
+	where, args, err := opts.whereSearchCursor(where, "comments", args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, buildSelectCommentsQuery(loggedIn, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := scanComments(ctx, db, rows, opts.Viewer)
+	if err != nil && err != errCommentNotFound {
+		return nil, err
+	}
+
+	set := &SearchResultSet{Type: SearchTypeComments, Comments: []*Comment{}}
+	if len(comments) > opts.Limit {
+		set.Next = nextSearchCursor(opts.Sort, comments[opts.Limit].Points, comments[opts.Limit].ID)
+		comments = comments[:opts.Limit]
+	}
+	if len(comments) > 0 {
+		if err := getCommentsPostTitles(ctx, db, comments, opts.Viewer); err != nil {
+			return nil, err
+		}
+		set.Comments = comments
+	}
+	return set, nil
+}
+
+func searchCommunities(ctx context.Context, db *sql.DB, match string, opts *SearchOptions) (*SearchResultSet, error) {
+	// Communities are sorted by their number of members for the top sort.
+	// Since the cursor is of the same points-ID form, the number of members
+	// stands in for points.
+	where := "WHERE MATCH (communities.about) AGAINST (? IN BOOLEAN MODE) AND communities.deleted_at IS NULL "
+	args := []any{match}
+	if opts.From != nil {
+		where += "AND communities.created_at >= ? "
+		args = append(args, *opts.From)
+	}
+	if opts.To != nil {
+		where += "AND communities.created_at <= ? "
+		args = append(args, *opts.To)
+	}
+	if opts.Viewer != nil {
+		where += "AND communities.id NOT IN (SELECT community_id FROM muted_communities WHERE user_id = ?) "
+		args = append(args, *opts.Viewer)
+	}
+
+	fo := &FeedOptions{Next: opts.Next}
+	if opts.Sort == FeedSortTopAll {
+		if opts.Next != "" {
+			nextMembers, nextID, err := fo.nextPointsID()
+			if err != nil {
+				return nil, err
+			}
+			where += "AND (communities.no_members, communities.id) <= (?, ?) "
+			args = append(args, nextMembers, nextID)
+		}
+		where += "ORDER BY communities.no_members DESC, communities.id DESC LIMIT ?"
+	} else {
+		if opts.Next != "" {
+			nextID, err := fo.nextID()
+			if err != nil {
+				return nil, err
+			}
+			where += "AND communities.id <= ? "
+			args = append(args, nextID)
+		}
+		where += "ORDER BY communities.id DESC LIMIT ?"
+	}
+	args = append(args, opts.Limit+1)
+
+	comms, err := getCommunities(ctx, db, opts.Viewer, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &SearchResultSet{Type: SearchTypeCommunities, Communities: []*Community{}}
+	if len(comms) > opts.Limit {
+		set.Next = nextSearchCursor(opts.Sort, comms[opts.Limit].NumMembers, comms[opts.Limit].ID)
+		comms = comms[:opts.Limit]
+	}
+	if comms != nil {
+		set.Communities = comms
+	}
+	return set, nil
+}
+
+func searchUsers(ctx context.Context, db *sql.DB, match string, opts *SearchOptions) (*SearchResultSet, error) {
+	where := "WHERE MATCH (users.username) AGAINST (? IN BOOLEAN MODE) AND users.deleted_at IS NULL AND users.banned_at IS NULL "
+	args := []any{match}
+	if opts.From != nil {
+		where += "AND users.created_at >= ? "
+		args = append(args, *opts.From)
+	}
+	if opts.To != nil {
+		where += "AND users.created_at <= ? "
+		args = append(args, *opts.To)
+	}
+	if opts.Viewer != nil {
+		where += "AND users.id NOT IN (SELECT muted_user_id FROM muted_users WHERE user_id = ?) "
+		args = append(args, *opts.Viewer)
+	}
+
+	where, args, err := opts.whereSearchCursor(where, "users", args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, buildSelectUserQuery(where), args...)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(ctx, db, rows, opts.Viewer)
+	if err != nil && err != errUserNotFound {
+		return nil, err
+	}
+
+	set := &SearchResultSet{Type: SearchTypeUsers, Users: []*User{}}
+	if len(users) > opts.Limit {
+		set.Next = nextSearchCursor(opts.Sort, users[opts.Limit].Points, users[opts.Limit].ID)
+		users = users[:opts.Limit]
+	}
+	if users != nil {
+		set.Users = users
+	}
+	return set, nil
+}
@@ -0,0 +1,24 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestSearchBooleanQuery(t *testing.T) {
+	cases := []struct {
+		q    string
+		want string
+	}{
+		{"hello", "+hello*"},
+		{"  hello   world ", "+hello* +world*"},
+		{"+go -rust", "+go* +rust*"},
+		{`"exact phrase"`, "+exact* +phrase*"},
+		{"(*)~", ""},
+		{"", ""},
+	}
+	for _, item := range cases {
+		if got := searchBooleanQuery(item.q); got != item.want {
+			t.Errorf("searchBooleanQuery(%q) = %q, want %q", item.q, got, item.want)
+		}
+	}
+}
@@ -17,6 +17,11 @@ type SiteSettings struct {
 	SignupsDisabled bool `json:"signupsDisabled"`
 	TorBlocked      bool `json:"torBlocked"`
 
+	// Two-factor authentication policy. Users it applies to cannot perform
+	// admin or moderator actions until they enable two-factor authentication.
+	Require2FAForAdmins         bool `json:"require2faForAdmins"`
+	Require2FAForModsMinMembers int  `json:"require2faForModsMinMembers"` // Zero for no requirement.
+
 	// note: ssCache.store() and ssCache.get() uses shallow-copy on this struct.
 	// So those lines of code need updating if pointer fields are added to this
 	// struct.
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/totp"
+)
+
+// numRecoveryCodes is the number of recovery codes generated at a time. Each
+// recovery code can be used, once, in place of a TOTP code.
+const numRecoveryCodes = 10
+
+var (
+	ErrInvalidTwoFactorCode = httperr.NewForbidden("invalid-2fa-code", "Invalid two-factor authentication code.")
+	errTwoFactorEnabled     = httperr.NewBadRequest("2fa-already-enabled", "Two-factor authentication is already enabled.")
+	errTwoFactorNotEnabled  = httperr.NewBadRequest("2fa-not-enabled", "Two-factor authentication is not enabled.")
+	errTwoFactorNotEnrolled = httperr.NewBadRequest("2fa-not-enrolled", "Two-factor authentication setup was not started.")
+)
+
+// TOTPEnrollment is what a user needs to add their account to an
+// authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // An otpauth:// URI, to be shown as a QR code.
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for u. Two-factor
+// authentication is not enabled until EnableTOTP is called with a code
+// generated from the secret.
+func (u *User) BeginTOTPEnrollment(ctx context.Context, db *sql.DB, issuer string) (*TOTPEnrollment, error) {
+	if u.TwoFactorEnabled {
+		return nil, errTwoFactorEnabled
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled_at IS NULL", secret, u.ID); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, u.Username, secret),
+	}, nil
+}
+
+// EnableTOTP enables two-factor authentication for u, provided that code is a
+// valid code of the secret generated by BeginTOTPEnrollment. It returns a new
+// set of recovery codes.
+func (u *User) EnableTOTP(ctx context.Context, db *sql.DB, code string) ([]string, error) {
+	if u.TwoFactorEnabled {
+		return nil, errTwoFactorEnabled
+	}
+	var codes []string
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var secret msql.NullString
+		if err := tx.QueryRowContext(ctx, "SELECT totp_secret FROM users WHERE id = ? FOR UPDATE", u.ID).Scan(&secret); err != nil {
+			return err
+		}
+		if !secret.Valid {
+			return errTwoFactorNotEnrolled
+		}
+		step, ok := totp.Validate(secret.String, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE id = ?", time.Now(), step, u.ID); err != nil {
+			return err
+		}
+		var err error
+		codes, err = newRecoveryCodes(ctx, tx, u)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.TwoFactorEnabled = true
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor authentication for u and deletes all of u's
+// recovery codes.
+func (u *User) DisableTOTP(ctx context.Context, db *sql.DB) error {
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?", u.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", u.ID)
+		return err
+	})
+	if err == nil {
+		u.TwoFactorEnabled = false
+	}
+	return err
+}
+
+// VerifyTwoFactorCode returns nil if code is either a valid TOTP code of u, or
+// one of u's unused recovery codes (in which case the recovery code is marked as
+// used). A TOTP code is not accepted more than once.
+func (u *User) VerifyTwoFactorCode(ctx context.Context, db *sql.DB, code string) error {
+	if !u.TwoFactorEnabled {
+		return errTwoFactorNotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		var (
+			secret   msql.NullString
+			lastStep int64
+		)
+		if err := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_last_step FROM users WHERE id = ? FOR UPDATE", u.ID).Scan(&secret, &lastStep); err != nil {
+			return err
+		}
+		if !secret.Valid {
+			return errTwoFactorNotEnabled
+		}
+		if step, ok := totp.Validate(secret.String, code, time.Now()); ok {
+			if step <= lastStep {
+				return ErrInvalidTwoFactorCode // The code was already used.
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE users SET totp_last_step = ? WHERE id = ?", step, u.ID)
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, "UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1", time.Now(), u.ID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	})
+}
+
+// NewRecoveryCodes replaces all of u's recovery codes with a new set.
+func (u *User) NewRecoveryCodes(ctx context.Context, db *sql.DB) ([]string, error) {
+	if !u.TwoFactorEnabled {
+		return nil, errTwoFactorNotEnabled
+	}
+	var codes []string
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) (err error) {
+		codes, err = newRecoveryCodes(ctx, tx, u)
+		return
+	})
+	return codes, err
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of u.
+func (u *User) RecoveryCodesLeft(ctx context.Context, db *sql.DB) (n int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", u.ID).Scan(&n)
+	return
+}
+
+// TwoFactorRequired reports whether u is required to have two-factor
+// authentication enabled, given the site's policy: whether it's required of
+// all admins, and the minimum number of members of a community for its mods
+// to be required to have it (zero meaning no such requirement).
+func (u *User) TwoFactorRequired(ctx context.Context, db *sql.DB, admins bool, modsMinMembers int) (bool, error) {
+	if admins && u.Admin {
+		return true, nil
+	}
+	if modsMinMembers <= 0 {
+		return false, nil
+	}
+	var n int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM community_mods
+		INNER JOIN communities ON communities.id = community_mods.community_id
+		WHERE community_mods.user_id = ? AND communities.no_members >= ?`, u.ID, modsMinMembers).Scan(&n)
+	return n > 0, err
+}
+
+// normalizeRecoveryCode removes the formatting of a recovery code.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hashRecoveryCode(code string) []byte {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return sum[:]
+}
+
+// newRecoveryCodes deletes all the recovery codes of u and creates
+// numRecoveryCodes new ones, as part of tx.
+func newRecoveryCodes(ctx context.Context, tx *sql.Tx, u *User) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", u.ID); err != nil {
+		return nil, err
+	}
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, numRecoveryCodes)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(enc.EncodeToString(b)) // 8 characters
+		codes[i] = s[:4] + "-" + s[4:]
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", u.ID, hashRecoveryCode(codes[i])); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
@@ -135,13 +135,19 @@ type User struct {
 	EmbedsOff               bool     `json:"embedsOff"`
 	HideUserProfilePictures bool     `json:"hideUserProfilePictures"`
 	RequireAltText          bool     `json:"requireAltText"`
+	EmailDigest             bool     `json:"emailDigest"` // Opt-in daily digest of unseen notifications.
+
+	TwoFactorEnabled       bool  `json:"-"`
+	TwoFactorEnabledPublic *bool `json:"twoFactorEnabled"` // Only for the user themself and admins.
 
 	WelcomeNotificationSent bool `json:"-"`
 
 	// No banned users are supposed to be logged in. Make sure to log them out
 	// before banning.
-	BannedAt msql.NullTime `json:"bannedAt"`
-	Banned   bool          `json:"isBanned"`
+	BannedAt    msql.NullTime   `json:"bannedAt"`
+	BannedUntil msql.NullTime   `json:"bannedUntil"` // If null, the ban (if any) is permanent.
+	BanReason   msql.NullString `json:"-"`
+	Banned      bool            `json:"isBanned"`
 
 	MutedByViewer bool `json:"-"`
 
@@ -245,6 +251,8 @@ func buildSelectUserQuery(where string) string {
 		"users.created_ip",
 		"users.deleted_at",
 		"users.banned_at",
+		"users.banned_until",
+		"users.ban_reason",
 		"users.upvote_notifications_off",
 		"users.reply_notifications_off",
 		"users.home_feed",
@@ -253,6 +261,8 @@ func buildSelectUserQuery(where string) string {
 		"users.hide_user_profile_pictures",
 		"users.welcome_notification_sent",
 		"users.require_alt_text",
+		"users.email_digest",
+		"users.totp_enabled_at IS NOT NULL",
 	}
 	cols = append(cols, images.ImageColumns("pro_pic")...)
 	joins := []string{
@@ -369,6 +379,8 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.CreatedIP,
 			&u.DeletedAt,
 			&u.BannedAt,
+			&u.BannedUntil,
+			&u.BanReason,
 			&u.UpvoteNotificationsOff,
 			&u.ReplyNotificationsOff,
 			&u.HomeFeed,
@@ -377,6 +389,8 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 			&u.HideUserProfilePictures,
 			&u.WelcomeNotificationSent,
 			&u.RequireAltText,
+			&u.EmailDigest,
+			&u.TwoFactorEnabled,
 		}
 
 		proPic := &images.Image{}
@@ -445,6 +459,7 @@ func scanUsers(ctx context.Context, db *sql.DB, rows *sql.Rows, viewer *uid.ID)
 				user.EmailPublic = new(string)
 				*user.EmailPublic = user.Email.String
 			}
+			user.TwoFactorEnabledPublic = &user.TwoFactorEnabled
 		}
 		if viewerAdmin {
 			user.LastSeenAdminView = &user.LastSeen
@@ -642,7 +657,13 @@ func userAllowedToIncrementPoints(ctx context.Context, tx *sql.Tx, user uid.ID,
 	if err != nil {
 		return false, err
 	}
-	return points >= requiredPoints && time.Since(createdAt) > requiredAge, nil
+	return !isNewUser(points, createdAt, requiredPoints, requiredAge), nil
+}
+
+// isNewUser reports whether a user with points, and whose account was created
+// at createdAt, is below either of the thresholds of a trusted user.
+func isNewUser(points int, createdAt time.Time, requiredPoints int, requiredAge time.Duration) bool {
+	return !(points >= requiredPoints && time.Since(createdAt) > requiredAge)
 }
 
 func UserAllowedToPostImages(ctx context.Context, db *sql.DB, user uid.ID, requiredPoints int) (bool, error) {
@@ -662,7 +683,8 @@ func (u *User) Update(ctx context.Context, db *sql.DB) error {
 	u.About.String = utils.TruncateUnicodeString(u.About.String, maxUserProfileAboutLength)
 	_, err := db.ExecContext(ctx, `
 	UPDATE users SET
-		email = ?, 
+		email_confirmed_at = IF(email <=> ?, email_confirmed_at, NULL),
+		email = ?,
 		about_me = ?,
 		upvote_notifications_off = ?,
 		reply_notifications_off = ?,
@@ -670,8 +692,10 @@ func (u *User) Update(ctx context.Context, db *sql.DB) error {
 		remember_feed_sort = ?,
 		embeds_off = ?,
 		hide_user_profile_pictures = ?,
-		require_alt_text = ?
+		require_alt_text = ?,
+		email_digest = ?
 	WHERE id = ?`,
+		u.EmailPublic,
 		u.EmailPublic,
 		u.About,
 		u.UpvoteNotificationsOff,
@@ -681,8 +705,21 @@ func (u *User) Update(ctx context.Context, db *sql.DB) error {
 		u.EmbedsOff,
 		u.HideUserProfilePictures,
 		u.RequireAltText,
+		u.EmailDigest,
 		u.ID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	var email msql.NullString
+	if u.EmailPublic != nil {
+		email = msql.NewNullString(*u.EmailPublic)
+	}
+	if email != u.Email {
+		u.Email = email
+		u.EmailConfirmedAt = msql.NullTime{}
+	}
+	return nil
 }
 
 func (u *User) IsGhost() bool {
@@ -898,23 +935,99 @@ func (u *User) DeleteContent(ctx context.Context, db *sql.DB, n int, admin uid.I
 	return nil
 }
 
-// Ban bans the user from site. Important: Make sure to log out all sessions of
-// this user before calling this function, and never allow this user to login.
+// maxBanReasonLength is the maximum length, in bytes, of the reason given for a
+// ban (both community and site-wide).
+const maxBanReasonLength = 1024
+
+var errBanExpiresInPast = httperr.NewBadRequest("ban-expires-in-past", "Ban expiry is in the past.")
+
+// validateBan checks the expiry and the reason of a new ban. Expires may be nil
+// (for permanent bans).
+func validateBan(expires *time.Time, reason string) error {
+	if expires != nil && !expires.After(time.Now()) {
+		return errBanExpiresInPast
+	}
+	if len(reason) > maxBanReasonLength {
+		return httperr.NewBadRequest("ban-reason-too-long", "Ban reason too long.")
+	}
+	return nil
+}
+
+// Ban bans the user from site on behalf of admin. If expires is nil, the ban is
+// permanent. Important: Make sure to log out all sessions of this user before
+// calling this function, and never allow this user to login.
 //
 // Note: An admin can be banned.
-func (u *User) Ban(ctx context.Context, db *sql.DB) error {
+func (u *User) Ban(ctx context.Context, db *sql.DB, admin uid.ID, expires *time.Time, reason string) error {
+	if err := validateBan(expires, reason); err != nil {
+		return err
+	}
+
+	var until msql.NullTime
+	if expires != nil {
+		until = msql.NewNullTime(*expires)
+	}
 	t := time.Now()
-	_, err := db.ExecContext(ctx, "UPDATE users SET banned_at = ? WHERE id = ?", t, u.ID)
-	if err == nil {
-		u.BannedAt = msql.NewNullTime(t)
-		u.Banned = true
+	err := msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET banned_at = ?, banned_until = ?, ban_reason = ? WHERE id = ?", t, until, msql.NewNullString(reason), u.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(nil, admin, UserGroupAdmins, ModLogActionSiteBan, ModLogTargetUser, u.ID.String())
+		entry.Details["username"] = u.Username
+		entry.Details["expires"] = until
+		entry.Details["reason"] = reason
+		return entry.insert(ctx, tx)
+	})
+	if err != nil {
+		return err
 	}
-	return err
+
+	u.BannedAt = msql.NewNullTime(t)
+	u.BannedUntil = until
+	u.Banned = true
+
+	go func() {
+		if err := CreateBannedNotification(context.Background(), db, u.ID, "", expires, reason); err != nil {
+			log.Printf("Failed to create banned notification for user %v: %v\n", u.Username, err)
+		}
+	}()
+	return nil
 }
 
-func (u *User) Unban(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, "UPDATE users SET banned_at = NULL WHERE id = ?", u.ID)
-	return err
+// Unban lifts the site ban of the user on behalf of admin.
+func (u *User) Unban(ctx context.Context, db *sql.DB, admin uid.ID) error {
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET banned_at = NULL, banned_until = NULL, ban_reason = NULL WHERE id = ?", u.ID); err != nil {
+			return err
+		}
+		entry := newModLogEntry(nil, admin, UserGroupAdmins, ModLogActionSiteUnban, ModLogTargetUser, u.ID.String())
+		entry.Details["username"] = u.Username
+		return entry.insert(ctx, tx)
+	})
+}
+
+// LiftExpiredBans removes all community bans, and lifts all site-wide bans,
+// that have expired. It returns the number of bans lifted.
+func LiftExpiredBans(ctx context.Context, db *sql.DB) (int, error) {
+	now := time.Now()
+	res, err := db.ExecContext(ctx, "DELETE FROM community_banned WHERE expires IS NOT NULL AND expires <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	n1, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = db.ExecContext(ctx, "UPDATE users SET banned_at = NULL, banned_until = NULL, ban_reason = NULL WHERE banned_until IS NOT NULL AND banned_until <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n1 + n2), nil
 }
 
 // MakeAdmin makes the user an admin of the site. If isAdmin is false
@@ -984,7 +1097,7 @@ func (u *User) GetBannedFromCommunities(ctx context.Context, db *sql.DB) ([]uid.
 
 	var nonExpired []uid.ID
 	for i := range ids {
-		if !expires[i].Valid || time.Since(expires[i].Time) > 0 {
+		if !expires[i].Valid || time.Now().Before(expires[i].Time) {
 			nonExpired = append(nonExpired, ids[i])
 		}
 	}
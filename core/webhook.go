@@ -0,0 +1,578 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/discuitnet/discuit/internal/utils"
+)
+
+const (
+	maxWebhooksPerCommunity = 10
+	maxWebhookURLLength     = 2048
+
+	// maxWebhookAttempts is the number of times a delivery is attempted before
+	// it's marked as failed.
+	maxWebhookAttempts = 8
+
+	// webhookRetryBackoff is the wait before the first retry of a failed
+	// delivery. It doubles after each attempt.
+	webhookRetryBackoff = 30 * time.Second
+
+	webhookDeliveryTimeout = 10 * time.Second
+
+	// webhookDeliveryWorkers is the maximum number of webhook calls made at
+	// the same time.
+	webhookDeliveryWorkers = 10
+
+	// webhookDeliveryRetention is how long the deliveries (that are not
+	// pending) are kept in the delivery log.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// WebhookEvent is a community event for which webhooks are called.
+type WebhookEvent string
+
+const (
+	WebhookEventPostNew     = WebhookEvent("post_new")
+	WebhookEventCommentNew  = WebhookEvent("comment_new")
+	WebhookEventReportNew   = WebhookEvent("report_new")
+	WebhookEventPostDeleted = WebhookEvent("post_deleted")
+	WebhookEventUserBanned  = WebhookEvent("user_banned")
+)
+
+// Valid reports whether e is a valid WebhookEvent.
+func (e WebhookEvent) Valid() bool {
+	switch e {
+	case WebhookEventPostNew, WebhookEventCommentNew, WebhookEventReportNew, WebhookEventPostDeleted, WebhookEventUserBanned:
+		return true
+	}
+	return false
+}
+
+// WebhookDeliveryStatus is the state of a WebhookDelivery.
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   = WebhookDeliveryStatus("pending")
+	WebhookDeliverySucceeded = WebhookDeliveryStatus("succeeded")
+	WebhookDeliveryFailed    = WebhookDeliveryStatus("failed")
+)
+
+var (
+	errWebhookNotFound     = httperr.NewNotFound("webhook-not-found", "Webhook not found.")
+	errInvalidWebhookURL   = httperr.NewBadRequest("invalid-webhook-url", "Invalid webhook URL (only public http and https URLs are allowed).")
+	errInvalidWebhookEvent = httperr.NewBadRequest("invalid-webhook-event", "Invalid webhook event.")
+	errTooManyWebhooks     = httperr.NewForbidden("too-many-webhooks", "Maximum number of webhooks reached.")
+)
+
+// Webhook is a URL registered by the moderators of a community that is called
+// (with a POST request) on each occurrence of Events in the community.
+type Webhook struct {
+	ID          int            `json:"id"`
+	CommunityID uid.ID         `json:"communityId"`
+	URL         string         `json:"url"`
+	Secret      string         `json:"-"` // Used to sign payloads.
+	Events      []WebhookEvent `json:"events"`
+	CreatedBy   uid.ID         `json:"createdBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// WebhookDelivery is a single call of a webhook (along with its retries).
+type WebhookDelivery struct {
+	ID             int                   `json:"id"`
+	WebhookID      int                   `json:"webhookId"`
+	Event          WebhookEvent          `json:"event"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"nextAttemptAt"`
+	LastAttemptAt  msql.NullTime         `json:"lastAttemptAt"`
+	ResponseStatus int                   `json:"responseStatus"` // Of the last attempt (0 if there was no response).
+	LastError      msql.NullString       `json:"lastError"`
+	CreatedAt      time.Time             `json:"createdAt"`
+}
+
+// webhookPayload is the JSON body of a webhook call.
+type webhookPayload struct {
+	Event       WebhookEvent `json:"event"`
+	CommunityID uid.ID       `json:"communityId"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	Data        any          `json:"data"`
+}
+
+// SignWebhookPayload returns the signature of payload with secret, as sent in
+// the X-Discuit-Signature-256 header.
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func parseWebhookEvents(s string) []WebhookEvent {
+	events := []WebhookEvent{}
+	for _, e := range strings.Split(s, ",") {
+		if e != "" {
+			events = append(events, WebhookEvent(e))
+		}
+	}
+	return events
+}
+
+// validateWebhookURL returns an error if rawURL is not an absolute http(s) URL
+// of a public host.
+func validateWebhookURL(rawURL string) error {
+	if len(rawURL) > maxWebhookURLLength {
+		return errInvalidWebhookURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || !(u.Scheme == "http" || u.Scheme == "https") || u.Hostname() == "" {
+		return errInvalidWebhookURL
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublicIP(ip) {
+		return errInvalidWebhookURL
+	}
+	if strings.EqualFold(u.Hostname(), "localhost") {
+		return errInvalidWebhookURL
+	}
+	return nil
+}
+
+// nonPublicIPNets are the reserved address blocks that are not covered by the
+// net.IP methods used in isPublicIP.
+var nonPublicIPNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "This" network.
+		"100.64.0.0/10", // Carrier-grade NAT.
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicIPNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookClient is the HTTP client used to deliver webhooks. It refuses to
+// connect to non-public addresses, so that webhooks cannot be used to probe the
+// internal network (the check is done at connection time, after DNS
+// resolution).
+var webhookClient = &http.Client{
+	Timeout: webhookDeliveryTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: webhookDeliveryTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("webhook address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+var selectWebhookCols = []string{
+	"community_webhooks.id",
+	"community_webhooks.community_id",
+	"community_webhooks.url",
+	"community_webhooks.secret",
+	"community_webhooks.events",
+	"community_webhooks.created_by",
+	"community_webhooks.created_at",
+}
+
+func scanWebhooks(rows *sql.Rows) ([]*Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w := &Webhook{}
+		var events string
+		if err := rows.Scan(&w.ID, &w.CommunityID, &w.URL, &w.Secret, &events, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.Events = parseWebhookEvents(events)
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook registers a new webhook in community. Only mods and admins can
+// create webhooks.
+func (c *Community) CreateWebhook(ctx context.Context, db *sql.DB, mod uid.ID, rawURL string, events []WebhookEvent) (*Webhook, error) {
+	if is, err := c.UserModOrAdmin(ctx, db, mod); err != nil {
+		return nil, err
+	} else if !is {
+		return nil, errNotMod
+	}
+
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, errInvalidWebhookEvent
+	}
+	var strEvents []string
+	for _, e := range events {
+		if !e.Valid() {
+			return nil, errInvalidWebhookEvent
+		}
+		if !slices.Contains(strEvents, string(e)) {
+			strEvents = append(strEvents, string(e))
+		}
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM community_webhooks WHERE community_id = ?", c.ID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooksPerCommunity {
+		return nil, errTooManyWebhooks
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret := hex.EncodeToString(b)
+
+	res, err := db.ExecContext(ctx, "INSERT INTO community_webhooks (community_id, url, secret, events, created_by) VALUES (?, ?, ?, ?, ?)",
+		c.ID, rawURL, secret, strings.Join(strEvents, ","), mod)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetWebhook(ctx, db, c.ID, int(id))
+}
+
+// GetWebhook returns the webhook of community with the given id.
+func GetWebhook(ctx context.Context, db *sql.DB, community uid.ID, id int) (*Webhook, error) {
+	query := msql.BuildSelectQuery("community_webhooks", selectWebhookCols, nil, "WHERE community_webhooks.id = ? AND community_webhooks.community_id = ?")
+	rows, err := db.QueryContext(ctx, query, id, community)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, errWebhookNotFound
+	}
+	return webhooks[0], nil
+}
+
+// GetWebhooks returns all the webhooks of community.
+func GetWebhooks(ctx context.Context, db *sql.DB, community uid.ID) ([]*Webhook, error) {
+	query := msql.BuildSelectQuery("community_webhooks", selectWebhookCols, nil, "WHERE community_webhooks.community_id = ? ORDER BY community_webhooks.id")
+	rows, err := db.QueryContext(ctx, query, community)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+// Delete deletes the webhook, along with its delivery log.
+func (w *Webhook) Delete(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM community_webhooks WHERE id = ?", w.ID)
+	return err
+}
+
+// queueWebhookEvent queues a delivery of event, with data as its payload, for
+// each webhook of community that's subscribed to event. Data is marshaled right
+// away, but the rest is done in the background; errors are only logged.
+func queueWebhookEvent(db *sql.DB, community uid.ID, event WebhookEvent, data any) {
+	payload, err := json.Marshal(webhookPayload{
+		Event:       event,
+		CommunityID: community,
+		CreatedAt:   time.Now(),
+		Data:        data,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal %s webhook payload (community %v): %v\n", event, community, err)
+		return
+	}
+	go func() {
+		if err := insertWebhookDeliveries(context.Background(), db, community, event, payload); err != nil {
+			log.Printf("Failed to queue %s webhook event (community %v): %v\n", event, community, err)
+		}
+	}()
+}
+
+func insertWebhookDeliveries(ctx context.Context, db *sql.DB, community uid.ID, event WebhookEvent, payload []byte) error {
+	webhooks, err := GetWebhooks(ctx, db, community)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for _, w := range webhooks {
+		if slices.Contains(w.Events, event) {
+			ids = append(ids, w.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return msql.Transact(ctx, db, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event, payload) VALUES (?, ?, ?)", id, event, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeliverPendingWebhooks makes all the webhook deliveries that are due, at most
+// webhookDeliveryWorkers at a time. Failed deliveries are retried, with
+// exponential backoff, up to maxWebhookAttempts times. It returns the number of
+// successful deliveries.
+func DeliverPendingWebhooks(ctx context.Context, db *sql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT webhook_deliveries.id, webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.attempts, community_webhooks.url, community_webhooks.secret
+		FROM webhook_deliveries
+		INNER JOIN community_webhooks ON community_webhooks.id = webhook_deliveries.webhook_id
+		WHERE webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?
+		ORDER BY webhook_deliveries.id LIMIT 100`, WebhookDeliveryPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type delivery struct {
+		id          int
+		event       WebhookEvent
+		payload     []byte
+		attempts    int
+		url, secret string
+	}
+	var deliveries []delivery
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			return 0, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex // Guards n and firstErr.
+		n        int
+		firstErr error
+		sem      = make(chan struct{}, webhookDeliveryWorkers)
+	)
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d delivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			succeeded, err := makeWebhookDelivery(ctx, db, d.id, d.attempts, d.url, d.secret, d.event, d.payload)
+			mu.Lock()
+			defer mu.Unlock()
+			if succeeded {
+				n++
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(d)
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return n, firstErr
+}
+
+// makeWebhookDelivery makes a single attempt of a delivery and records its
+// outcome. It reports whether the webhook call succeeded.
+func makeWebhookDelivery(ctx context.Context, db *sql.DB, id, prevAttempts int, url, secret string, event WebhookEvent, payload []byte) (bool, error) {
+	status, err := deliverWebhook(ctx, id, url, secret, event, payload)
+
+	now := time.Now()
+	attempts := prevAttempts + 1
+	var responseStatus sql.NullInt32
+	if status != 0 {
+		responseStatus = sql.NullInt32{Int32: int32(status), Valid: true}
+	}
+	var lastError msql.NullString
+	if err != nil {
+		lastError = msql.NewNullString(utils.TruncateUnicodeString(err.Error(), 1024))
+	}
+
+	succeeded := err == nil
+	newStatus, next := WebhookDeliverySucceeded, now
+	if !succeeded {
+		if attempts >= maxWebhookAttempts {
+			newStatus = WebhookDeliveryFailed
+		} else {
+			newStatus = WebhookDeliveryPending
+			next = now.Add(webhookRetryBackoff * time.Duration(1<<(attempts-1)))
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, response_status = ?, last_error = ? WHERE id = ?",
+		newStatus, attempts, next, now, responseStatus, lastError, id); err != nil {
+		return succeeded, err
+	}
+	return succeeded, nil
+}
+
+// PurgeWebhookDeliveries removes the deliveries, that are no longer pending,
+// older than webhookDeliveryRetention from the delivery log. It returns the
+// number of deliveries removed. Call this function periodically.
+func PurgeWebhookDeliveries(ctx context.Context, db *sql.DB) (int, error) {
+	bulk, total := 1000, 0
+	t := time.Now().Add(-webhookDeliveryRetention)
+	for {
+		res, err := db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE created_at < ? AND status <> ? LIMIT ?", t, WebhookDeliveryPending, bulk)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += int(n)
+		if n < int64(bulk) {
+			return total, nil
+		}
+	}
+}
+
+// deliverWebhook makes a single webhook call. It returns the status code of the
+// response (zero if there was no response) and an error if the call was not
+// successful.
+func deliverWebhook(ctx context.Context, id int, url, secret string, event WebhookEvent, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Discuit-Webhook/1.0")
+	req.Header.Set("X-Discuit-Event", string(event))
+	req.Header.Set("X-Discuit-Delivery", strconv.Itoa(id))
+	req.Header.Set("X-Discuit-Signature-256", SignWebhookPayload(secret, payload))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, errors.New("unexpected response status: " + res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// GetDeliveries returns the delivery log of the webhook, latest first. Next is
+// the pagination cursor (a delivery ID); if nil, the first page is returned.
+// The returned int pointer is the cursor of the next page.
+func (w *Webhook) GetDeliveries(ctx context.Context, db *sql.DB, limit int, next *int) ([]*WebhookDelivery, *int, error) {
+	where, args := "WHERE webhook_id = ?", []any{w.ID}
+	if next != nil {
+		where += " AND id <= ?"
+		args = append(args, *next)
+	}
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error, created_at
+		FROM webhook_deliveries `+where+` ORDER BY id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		var (
+			payload        []byte
+			responseStatus sql.NullInt32
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastAttemptAt, &responseStatus, &d.LastError, &d.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		d.Payload = payload
+		d.ResponseStatus = int(responseStatus.Int32)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var nextCursor *int
+	if len(deliveries) > limit {
+		nextCursor = &deliveries[limit].ID
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nextCursor, nil
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	cases := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hook", true},
+		{"http://example.com:8080/hook?x=1", true},
+		{"ftp://example.com/hook", false},
+		{"/relative/path", false},
+		{"https://localhost/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://100.127.255.254/hook", false},
+		{"http://0.1.2.3/hook", false},
+		{"http://100.128.0.1/hook", true},
+		{"http://93.184.216.34/hook", true},
+	}
+	for _, item := range cases {
+		if err := validateWebhookURL(item.url); (err == nil) != item.valid {
+			t.Errorf("validateWebhookURL(%q) = %v, want valid: %v", item.url, err, item.valid)
+		}
+	}
+}
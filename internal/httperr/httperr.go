@@ -18,6 +18,10 @@ type Error struct {
 	// Message is a human readable error message. Message should begin with a
 	// capital letter and each sentence should end in a period.
 	Message string `json:"message"`
+
+	// Details, if not nil, holds additional, endpoint specific, information
+	// about the error.
+	Details any `json:"details,omitempty"`
 }
 
 func (err *Error) Error() string {
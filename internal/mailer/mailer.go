@@ -0,0 +1,132 @@
+// Package mailer sends (plain text) emails.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is an email message.
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text.
+}
+
+// Mailer is the interface implemented by the different ways of sending emails.
+type Mailer interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+var ErrInvalidAddress = errors.New("mailer: invalid email address")
+
+// encode returns m as an RFC 5322 message.
+func (m *Message) encode(from string) ([]byte, error) {
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return nil, ErrInvalidAddress
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return nil, errors.New("mailer: subject contains a newline")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i != -1 {
+		domain = strings.Trim(from[i+1:], "> ")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
+
+// SMTP sends emails through an SMTP server.
+type SMTP struct {
+	Addr     string // Of the form host:port.
+	Username string // If empty, no authentication is performed.
+	Password string
+	From     string
+}
+
+// Send implements Mailer.
+func (s *SMTP) Send(ctx context.Context, m *Message) error {
+	data, err := m.encode(s.From)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid from address: %w", err)
+	}
+	to, _ := mail.ParseAddress(m.To)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, data)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// File writes emails to files in Dir (one file per email), instead of sending
+// them. If Dir is empty, emails are written to the log. It's meant for local
+// development.
+type File struct {
+	Dir  string
+	From string
+}
+
+// Send implements Mailer.
+func (f *File) Send(ctx context.Context, m *Message) error {
+	data, err := m.encode(f.From)
+	if err != nil {
+		return err
+	}
+	if f.Dir == "" {
+		log.Printf("Email (not sent):\n%s\n", data)
+		return nil
+	}
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(m.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), data, 0644)
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMessageEncode(t *testing.T) {
+	m := &Message{To: "user@example.com", Subject: "Hello", Body: "line 1\nline 2\n"}
+	data, err := m.encode("Site <noreply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	for _, want := range []string{"From: Site <noreply@example.com>\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline 1\r\nline 2\r\n"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("encoded message does not contain %q:\n%s", want, s)
+		}
+	}
+
+	invalid := []*Message{
+		{To: "not an address", Subject: "Hello"},
+		{To: "user@example.com", Subject: "Hello\r\nBcc: other@example.com"},
+	}
+	for _, m := range invalid {
+		if _, err := m.encode("noreply@example.com"); err == nil {
+			t.Errorf("expected an error encoding message (to: %q, subject: %q)", m.To, m.Subject)
+		}
+	}
+}
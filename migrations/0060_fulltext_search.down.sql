@@ -0,0 +1,4 @@
+DROP INDEX ft_posts_title_body ON posts;
+DROP INDEX ft_comments_body ON comments;
+DROP INDEX ft_communities_about ON communities;
+DROP INDEX ft_users_username ON users;
@@ -0,0 +1,4 @@
+CREATE FULLTEXT INDEX ft_posts_title_body ON posts(title, body);
+CREATE FULLTEXT INDEX ft_comments_body ON comments(body);
+CREATE FULLTEXT INDEX ft_communities_about ON communities(about);
+CREATE FULLTEXT INDEX ft_users_username ON users(username);
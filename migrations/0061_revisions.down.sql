@@ -0,0 +1,2 @@
+drop table post_revisions;
+drop table comment_revisions;
@@ -0,0 +1,25 @@
+create table if not exists post_revisions (
+	id int unsigned not null auto_increment,
+	post_id binary (12) not null,
+	title varchar (255) not null,
+	body text,
+	link_info JSON,
+	written_at datetime not null, /* when this version of the post was written */
+	created_at datetime not null default current_timestamp(), /* when it was replaced */
+
+	primary key (id),
+	foreign key (post_id) references posts (id),
+	index (post_id, id)
+);
+
+create table if not exists comment_revisions (
+	id int unsigned not null auto_increment,
+	comment_id binary (12) not null,
+	body text,
+	written_at datetime not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (comment_id) references comments (id),
+	index (comment_id, id)
+);
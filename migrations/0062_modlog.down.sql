@@ -0,0 +1,3 @@
+drop table modlog;
+
+ALTER TABLE communities DROP COLUMN modlog_public;
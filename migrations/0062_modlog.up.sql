@@ -0,0 +1,21 @@
+create table if not exists modlog (
+	id int unsigned not null auto_increment,
+	community_id binary (12), /* null for site-wide actions */
+	actor_id binary (12) not null,
+	actor_group tinyint not null,
+	action varchar (64) not null,
+	target_type varchar (32) not null,
+	target_id varchar (32) not null,
+	details JSON,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (actor_id) references users (id),
+	index (community_id, id),
+	index (actor_id, id),
+	index (action, id),
+	index (target_type, target_id)
+);
+
+ALTER TABLE communities ADD COLUMN modlog_public bool not null default false;
@@ -0,0 +1,6 @@
+alter table users drop index banned_until;
+alter table users drop column ban_reason;
+alter table users drop column banned_until;
+
+alter table community_banned drop index expires;
+alter table community_banned drop column reason;
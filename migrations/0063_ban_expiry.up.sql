@@ -0,0 +1,6 @@
+alter table community_banned add column reason varchar (1024);
+alter table community_banned add index (expires);
+
+alter table users add column banned_until datetime;
+alter table users add column ban_reason varchar (1024);
+alter table users add index (banned_until);
@@ -0,0 +1,15 @@
+create table if not exists api_tokens (
+	id int unsigned not null auto_increment,
+	user_id binary (12) not null,
+	name varchar (128) not null,
+	token_hash binary (32) not null, /* sha256 of the token */
+	scopes varchar (255) not null, /* comma separated */
+	last_used_at datetime,
+	last_used_ip inet6,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (token_hash),
+	foreign key (user_id) references users (id) on delete cascade,
+	index (user_id)
+);
@@ -0,0 +1,33 @@
+create table if not exists community_webhooks (
+	id int unsigned not null auto_increment,
+	community_id binary (12) not null,
+	url varchar (2048) not null,
+	secret varchar (64) not null,
+	events varchar (255) not null, /* comma separated */
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (created_by) references users (id)
+);
+
+create table if not exists webhook_deliveries (
+	id int unsigned not null auto_increment,
+	webhook_id int unsigned not null,
+	event varchar (32) not null,
+	payload mediumtext not null,
+	status varchar (16) not null default "pending", /* pending, succeeded, or failed */
+	attempts int not null default 0,
+	next_attempt_at datetime not null default current_timestamp(),
+	last_attempt_at datetime,
+	response_status int,
+	last_error varchar (1024),
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (webhook_id) references community_webhooks (id) on delete cascade,
+	index (status, next_attempt_at),
+	index (webhook_id, id),
+	index (created_at)
+);
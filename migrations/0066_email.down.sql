@@ -0,0 +1,5 @@
+drop table email_tokens;
+
+alter table users drop column last_digest_at;
+
+alter table users drop column email_digest;
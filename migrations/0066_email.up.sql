@@ -0,0 +1,19 @@
+alter table users add column email_digest bool not null default false;
+
+alter table users add column last_digest_at datetime;
+
+create table if not exists email_tokens (
+	id int unsigned not null auto_increment,
+	user_id binary (12) not null,
+	purpose varchar (32) not null,
+	email varchar (255) not null, /* the address the token was sent to */
+	token_hash binary (32) not null, /* sha256 of the token */
+	expires_at datetime not null,
+	used_at datetime,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (token_hash),
+	foreign key (user_id) references users (id) on delete cascade,
+	index (user_id, purpose)
+);
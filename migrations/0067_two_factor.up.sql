@@ -0,0 +1,17 @@
+alter table users add column totp_secret varchar (64); /* base32 encoded */
+
+alter table users add column totp_enabled_at datetime;
+
+alter table users add column totp_last_step bigint not null default 0; /* of the last accepted code, to prevent reuse */
+
+create table if not exists recovery_codes (
+	id int unsigned not null auto_increment,
+	user_id binary (12) not null,
+	code_hash binary (32) not null, /* sha256 of the code */
+	used_at datetime,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (user_id) references users (id) on delete cascade,
+	index (user_id)
+);
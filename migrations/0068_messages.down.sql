@@ -0,0 +1,5 @@
+drop table message_reports;
+
+drop table messages;
+
+drop table conversations;
@@ -0,0 +1,47 @@
+create table if not exists conversations (
+	id binary (12) not null,
+	user1_id binary (12) not null, /* user1_id < user2_id */
+	user2_id binary (12) not null,
+	last_message_id binary (12),
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (user1_id, user2_id),
+	foreign key (user1_id) references users (id) on delete cascade,
+	foreign key (user2_id) references users (id) on delete cascade,
+	index (user2_id),
+	index (last_message_id)
+);
+
+create table if not exists messages (
+	id binary (12) not null,
+	conversation_id binary (12) not null,
+	author_id binary (12) not null,
+	body text not null,
+	read_at datetime,
+	created_at datetime not null default current_timestamp(),
+	deleted_at datetime,
+
+	primary key (id),
+	foreign key (conversation_id) references conversations (id) on delete cascade,
+	foreign key (author_id) references users (id) on delete cascade,
+	index (conversation_id, id)
+);
+
+create table if not exists message_reports (
+	id int unsigned not null auto_increment,
+	message_id binary (12) not null,
+	reason_id int unsigned not null,
+	created_by binary (12) not null,
+	action_taken varchar (32),
+	dealt_at datetime,
+	dealt_by binary (12),
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (message_id, created_by),
+	foreign key (message_id) references messages (id) on delete cascade,
+	foreign key (reason_id) references report_reasons (id),
+	foreign key (created_by) references users (id) on delete cascade,
+	index (dealt_at)
+);
@@ -0,0 +1,3 @@
+drop table modmail_messages;
+
+drop table modmail_threads;
@@ -0,0 +1,29 @@
+create table if not exists modmail_threads (
+	id binary (12) not null,
+	community_id binary (12) not null,
+	user_id binary (12) not null, /* The user who opened the thread. */
+	subject varchar (255) not null,
+	state varchar (16) not null default 'new',
+	last_message_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (user_id) references users (id) on delete cascade,
+	index (community_id, state, last_message_id),
+	index (user_id, last_message_id)
+);
+
+create table if not exists modmail_messages (
+	id binary (12) not null,
+	thread_id binary (12) not null,
+	author_id binary (12) not null,
+	as_mod bool not null default false, /* Sent on behalf of the mod team. */
+	body text not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (thread_id) references modmail_threads (id) on delete cascade,
+	foreign key (author_id) references users (id) on delete cascade,
+	index (thread_id, id)
+);
@@ -0,0 +1,5 @@
+drop table poll_votes;
+
+drop table poll_options;
+
+drop table polls;
@@ -0,0 +1,37 @@
+create table if not exists polls (
+	post_id binary (12) not null,
+	multiple_choice bool not null default false,
+	closes_at datetime, /* If null, the poll never closes. */
+	no_voters int unsigned not null default 0,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (post_id),
+	foreign key (post_id) references posts (id) on delete cascade
+);
+
+create table if not exists poll_options (
+	id int unsigned not null auto_increment,
+	post_id binary (12) not null,
+	position tinyint unsigned not null,
+	text varchar (255) not null,
+	no_votes int unsigned not null default 0,
+
+	primary key (id),
+	foreign key (post_id) references polls (post_id) on delete cascade,
+	index (post_id, position)
+);
+
+create table if not exists poll_votes (
+	id int unsigned not null auto_increment,
+	post_id binary (12) not null,
+	option_id int unsigned not null,
+	user_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique (option_id, user_id),
+	foreign key (post_id) references polls (post_id) on delete cascade,
+	foreign key (option_id) references poll_options (id) on delete cascade,
+	foreign key (user_id) references users (id) on delete cascade,
+	index (post_id, user_id)
+);
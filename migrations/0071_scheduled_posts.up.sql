@@ -0,0 +1,24 @@
+create table if not exists scheduled_posts (
+	id binary (12) not null,
+	user_id binary (12) not null,
+	community_id binary (12) not null,
+	user_group tinyint not null default 1,
+	type tinyint not null default 0,
+	title varchar (255) not null,
+	body text,
+	link_url varchar (2048),
+	images json, /* For image posts. */
+	poll json, /* For poll posts. */
+	pin bool not null default false,
+	publish_at datetime not null,
+	published_at datetime,
+	post_id binary (12), /* The published post. */
+	error varchar (255), /* Why publishing failed, if it did. */
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (user_id) references users (id) on delete cascade,
+	foreign key (community_id) references communities (id) on delete cascade,
+	index (user_id, publish_at),
+	index (published_at, publish_at)
+);
@@ -0,0 +1 @@
+drop table recurring_threads;
@@ -0,0 +1,21 @@
+create table if not exists recurring_threads (
+	id int unsigned not null auto_increment,
+	community_id binary (12) not null,
+	title varchar (255) not null, /* may contain the {date} placeholder */
+	body text,
+	frequency varchar (16) not null, /* daily or weekly */
+	weekday tinyint not null default 0, /* for weekly threads; 0 is Sunday */
+	hour tinyint not null default 0, /* in UTC */
+	minute tinyint not null default 0,
+	next_run_at datetime not null,
+	last_post_id binary (12),
+	last_error varchar (255),
+	created_by binary (12) not null, /* the author of the posts */
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (created_by) references users (id) on delete cascade,
+	foreign key (last_post_id) references posts (id) on delete set null,
+	index (next_run_at)
+);
@@ -0,0 +1,7 @@
+alter table comments drop column pending;
+
+alter table posts drop column pending;
+
+drop table automod_fired_rules;
+
+drop table community_automod;
@@ -0,0 +1,22 @@
+create table if not exists community_automod (
+	community_id binary (12) not null,
+	rules mediumtext not null, /* yaml or json */
+	updated_by binary (12), /* the actions are taken on behalf of this mod */
+	updated_at datetime not null default current_timestamp(),
+
+	primary key (community_id),
+	foreign key (community_id) references communities (id) on delete cascade,
+	constraint community_automod_fk_updated_by foreign key (updated_by) references users (id) on delete set null
+);
+
+create table if not exists automod_fired_rules (
+	target_id binary (12) not null, /* post or comment id */
+	rule_hash binary (32) not null, /* sha256 of the rule */
+	created_at datetime not null default current_timestamp(),
+
+	primary key (target_id, rule_hash)
+);
+
+alter table posts add column pending bool not null default false;
+
+alter table comments add column pending bool not null default false;
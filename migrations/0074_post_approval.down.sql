@@ -0,0 +1,5 @@
+alter table comments drop index community_id_pending;
+
+alter table posts drop index community_id_pending;
+
+alter table communities drop column post_approval;
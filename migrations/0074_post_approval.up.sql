@@ -0,0 +1,5 @@
+alter table communities add column post_approval varchar (16) not null default "off"; /* off, new_users, or all */
+
+alter table posts add index community_id_pending (community_id, pending);
+
+alter table comments add index community_id_pending (community_id, pending);
@@ -0,0 +1,7 @@
+alter table posts drop index community_id_flair_id;
+
+alter table posts drop foreign key posts_fk_flair_id;
+
+alter table posts drop column flair_id;
+
+drop table community_flairs;
@@ -0,0 +1,21 @@
+create table if not exists community_flairs (
+	id int unsigned not null auto_increment,
+	community_id binary (12) not null,
+	name varchar (64) not null,
+	color binary (12) not null, /* images.RGB */
+	mod_only bool not null default false, /* if true, only mods may assign the flair */
+	z_index int not null default 0,
+	created_by binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	unique key community_id_name (community_id, name),
+	foreign key (community_id) references communities (id) on delete cascade,
+	foreign key (created_by) references users (id) on delete cascade
+);
+
+alter table posts add column flair_id int unsigned;
+
+alter table posts add constraint posts_fk_flair_id foreign key (flair_id) references community_flairs (id) on delete set null;
+
+alter table posts add index community_id_flair_id (community_id, flair_id);
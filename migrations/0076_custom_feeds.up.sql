@@ -0,0 +1,23 @@
+create table if not exists custom_feeds (
+	id int unsigned not null auto_increment,
+	user_id binary (12) not null,
+	name varchar (100) not null,
+	description text,
+	public bool not null default false,
+	num_communities int not null default 0,
+	created_at datetime not null default current_timestamp(),
+	last_updated_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (user_id) references users (id) on delete cascade
+);
+
+create table if not exists custom_feed_communities (
+	feed_id int unsigned not null,
+	community_id binary (12) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (feed_id, community_id),
+	foreign key (feed_id) references custom_feeds (id) on delete cascade,
+	foreign key (community_id) references communities (id) on delete cascade
+);
@@ -0,0 +1,5 @@
+alter table posts drop column link_domain;
+
+drop table muted_domains;
+
+drop table muted_keywords;
@@ -0,0 +1,26 @@
+create table if not exists muted_keywords (
+	id bigint not null auto_increment,
+	user_id binary (12) not null,
+	keyword varchar (100) not null,
+	pattern varchar (255) not null, /* keyword as a regular expression, see core.mutedKeywordPattern */
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (user_id) references users (id) on delete cascade,
+	unique (user_id, keyword)
+);
+
+create table if not exists muted_domains (
+	id bigint not null auto_increment,
+	user_id binary (12) not null,
+	domain varchar (255) not null,
+	created_at datetime not null default current_timestamp(),
+
+	primary key (id),
+	foreign key (user_id) references users (id) on delete cascade,
+	unique (user_id, domain)
+);
+
+alter table posts add column link_domain varchar (255); /* lowercase hostname of the link, without the www. prefix */
+
+update posts set link_domain = regexp_replace(lower(json_value(link_info, '$.h')), '^www\\.', '') where link_info is not null;
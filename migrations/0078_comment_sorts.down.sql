@@ -0,0 +1,7 @@
+alter table comments drop index post_id_controversy;
+
+alter table comments drop index post_id_best_score;
+
+alter table comments drop column controversy;
+
+alter table comments drop column best_score;
@@ -0,0 +1,15 @@
+alter table comments add column best_score int not null default 0; /* see core.CommentBestScore */
+
+alter table comments add column controversy int not null default 0; /* see core.CommentControversy */
+
+update comments set best_score = round(1000000 * (
+		(upvotes / (upvotes + downvotes) + 1.6423744151508406 / (2 * (upvotes + downvotes))
+		- 1.281551565545 * sqrt((upvotes / (upvotes + downvotes) * (1 - upvotes / (upvotes + downvotes)) + 1.6423744151508406 / (4 * (upvotes + downvotes))) / (upvotes + downvotes)))
+		/ (1 + 1.6423744151508406 / (upvotes + downvotes))
+	)) where upvotes + downvotes > 0;
+
+update comments set controversy = round(1000 * power(upvotes + downvotes, if(upvotes > downvotes, downvotes / upvotes, upvotes / downvotes))) where upvotes > 0 and downvotes > 0;
+
+alter table comments add index post_id_best_score (post_id, best_score, id);
+
+alter table comments add index post_id_controversy (post_id, controversy, id);
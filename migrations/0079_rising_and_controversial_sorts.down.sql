@@ -0,0 +1,35 @@
+alter table posts_year drop index community_id_controversy;
+
+alter table posts_month drop index community_id_controversy;
+
+alter table posts_week drop index community_id_controversy;
+
+alter table posts_today drop index community_id_controversy;
+
+alter table posts_year drop index controversy_post_id;
+
+alter table posts_month drop index controversy_post_id;
+
+alter table posts_week drop index controversy_post_id;
+
+alter table posts_today drop index controversy_post_id;
+
+alter table posts_year drop column controversy;
+
+alter table posts_month drop column controversy;
+
+alter table posts_week drop column controversy;
+
+alter table posts_today drop column controversy;
+
+alter table posts drop index deleted_community_id_rising_id;
+
+alter table posts drop index deleted_rising_id;
+
+alter table posts drop index deleted_community_id_controversy_id;
+
+alter table posts drop index deleted_controversy_id;
+
+alter table posts drop column rising;
+
+alter table posts drop column controversy;
@@ -0,0 +1,45 @@
+alter table posts add column controversy int not null default 0; /* see core.PostControversy */
+
+alter table posts add column rising int not null default 0; /* see core.PostRisingScore; filled in as posts receive votes */
+
+update posts set controversy = round(1000 * power(upvotes + downvotes, if(upvotes > downvotes, downvotes / upvotes, upvotes / downvotes))) where upvotes > 0 and downvotes > 0;
+
+alter table posts add index deleted_controversy_id (deleted, controversy, id);
+
+alter table posts add index deleted_community_id_controversy_id (deleted, community_id, controversy, id);
+
+alter table posts add index deleted_rising_id (deleted, rising, id);
+
+alter table posts add index deleted_community_id_rising_id (deleted, community_id, rising, id);
+
+alter table posts_today add column controversy int not null default 0;
+
+alter table posts_week add column controversy int not null default 0;
+
+alter table posts_month add column controversy int not null default 0;
+
+alter table posts_year add column controversy int not null default 0;
+
+update posts_today set controversy = (select posts.controversy from posts where posts.id = posts_today.post_id);
+
+update posts_week set controversy = (select posts.controversy from posts where posts.id = posts_week.post_id);
+
+update posts_month set controversy = (select posts.controversy from posts where posts.id = posts_month.post_id);
+
+update posts_year set controversy = (select posts.controversy from posts where posts.id = posts_year.post_id);
+
+alter table posts_today add index controversy_post_id (controversy, post_id);
+
+alter table posts_week add index controversy_post_id (controversy, post_id);
+
+alter table posts_month add index controversy_post_id (controversy, post_id);
+
+alter table posts_year add index controversy_post_id (controversy, post_id);
+
+alter table posts_today add index community_id_controversy (community_id, controversy);
+
+alter table posts_week add index community_id_controversy (community_id, controversy);
+
+alter table posts_month add index community_id_controversy (community_id, controversy);
+
+alter table posts_year add index community_id_controversy (community_id, controversy);
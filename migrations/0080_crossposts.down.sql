@@ -0,0 +1,5 @@
+alter table posts drop foreign key posts_fk_crosspost_of;
+
+alter table posts drop index crosspost_of_id;
+
+alter table posts drop column crosspost_of;
@@ -0,0 +1,5 @@
+alter table posts add column crosspost_of binary (12); /* the original post, if the post is a crosspost */
+
+alter table posts add index crosspost_of_id (crosspost_of, id);
+
+alter table posts add constraint posts_fk_crosspost_of foreign key (crosspost_of) references posts (id) on delete set null;
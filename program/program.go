@@ -76,6 +76,9 @@ func (pg *Program) startBackgroundTasks(delay time.Duration) {
 	pg.tr.New("Purge temp posts", func(ctx context.Context) error {
 		return core.PurgePostsFromTempTables(ctx, pg.db)
 	}, time.Hour, false)
+	pg.tr.New("Update rising scores of posts", func(ctx context.Context) error {
+		return core.UpdatePostsRisingScores(ctx, pg.db)
+	}, time.Minute*10, false)
 	pg.tr.New("Delete temp images", func(ctx context.Context) error {
 		n, err := core.RemoveTempImages(ctx, pg.db)
 		log.Printf("Removed %d temp images\n", n)
@@ -120,6 +123,52 @@ func (pg *Program) startBackgroundTasks(delay time.Duration) {
 		}
 		return nil
 	}, time.Second*100, false)
+	pg.tr.New("Lift expired bans", func(ctx context.Context) error {
+		n, err := core.LiftExpiredBans(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Lifted %d expired ban(s)\n", n)
+		}
+		return err
+	}, time.Minute, false)
+	pg.tr.New("Send notification digests", func(ctx context.Context) error {
+		n, err := pg.server.SendNotificationDigests(ctx)
+		if n > 0 {
+			log.Printf("Sent %d notification digest(s)\n", n)
+		}
+		return err
+	}, time.Minute*10, false)
+	pg.tr.New("Publish scheduled posts", func(ctx context.Context) error {
+		n, err := pg.server.PublishScheduledPosts(ctx)
+		if n > 0 {
+			log.Printf("Published %d scheduled post(s)\n", n)
+		}
+		return err
+	}, time.Minute, false)
+	pg.tr.New("Post recurring threads", func(ctx context.Context) error {
+		n, err := core.PostDueRecurringThreads(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Posted %d recurring thread(s)\n", n)
+		}
+		return err
+	}, time.Minute, false)
+	pg.tr.New("Deliver webhooks", func(ctx context.Context) error {
+		_, err := core.DeliverPendingWebhooks(ctx, pg.db)
+		return err
+	}, time.Second*10, false)
+	pg.tr.New("Purge webhook deliveries", func(ctx context.Context) error {
+		n, err := core.PurgeWebhookDeliveries(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Purged %d webhook deliveries\n", n)
+		}
+		return err
+	}, time.Hour, false)
+	pg.tr.New("Purge AutoModerator fired rules", func(ctx context.Context) error {
+		n, err := core.PurgeAutomodFiredRules(ctx, pg.db)
+		if n > 0 {
+			log.Printf("Purged %d AutoModerator fired rule(s)\n", n)
+		}
+		return err
+	}, time.Hour, false)
 
 	go func() {
 		time.Sleep(delay)
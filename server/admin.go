@@ -80,7 +80,19 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 				return err
 			}
 		}
-		if err := user.Ban(r.ctx, s.db); err != nil {
+		var expires *time.Time
+		if _, ok := reqBody["expiresAt"]; ok {
+			expiresText, ok := reqBody["expiresAt"].(string)
+			if !ok {
+				return invalidJSONErr
+			}
+			expires = new(time.Time)
+			if err := expires.UnmarshalText([]byte(expiresText)); err != nil {
+				return httperr.NewBadRequest("invalid_expires", "Invalid expires.")
+			}
+		}
+		reason, _ := reqBody["reason"].(string)
+		if err := user.Ban(r.ctx, s.db, admin.ID, expires, reason); err != nil {
 			return err
 		}
 	case "unban_user":
@@ -92,7 +104,7 @@ func (s *Server) adminActions(w *responseWriter, r *request) error {
 		if err != nil {
 			return err
 		}
-		if err := user.Unban(r.ctx, s.db); err != nil {
+		if err := user.Unban(r.ctx, s.db, admin.ID); err != nil {
 			return err
 		}
 	case "add_default_forum", "remove_default_forum":
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/httputil"
+	"github.com/discuitnet/discuit/internal/sessions"
+	"github.com/gorilla/mux"
+)
+
+const (
+	scopeRead     = core.APITokenScopeRead
+	scopePost     = core.APITokenScopePost
+	scopeVote     = core.APITokenScopeVote
+	scopeModerate = core.APITokenScopeModerate
+	scopeAdmin    = core.APITokenScopeAdmin
+)
+
+// apiTokenRoutes are the routes (path template, then method) that can be
+// accessed with an API token, and the scope the token must have for each. Any
+// route not in here (like the ones that create API tokens, or delete the
+// account) cannot be accessed with an API token.
+var apiTokenRoutes = map[string]map[string]core.APITokenScope{
+	"/api/_initial": {"GET": scopeRead},
+	"/api/_user":    {"GET": scopeRead},
+
+	"/api/users/{username}":                  {"GET": scopeRead},
+	"/api/users/{username}/feed":             {"GET": scopeRead},
+	"/api/users/{username}/pro_pic":          {"POST": scopePost, "DELETE": scopePost},
+	"/api/users/{username}/badges":           {"POST": scopeAdmin},
+	"/api/users/{username}/badges/{badgeId}": {"DELETE": scopeAdmin},
+	"/api/hidden_posts":                      {"POST": scopePost},
+	"/api/hidden_posts/{postId}":             {"DELETE": scopePost},
+
+	"/api/users/{username}/lists":                  {"GET": scopeRead, "POST": scopePost},
+	"/api/lists/_saved_to":                         {"GET": scopeRead},
+	"/api/users/{username}/lists/{listname}":       {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+	"/api/lists/{listId}":                          {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+	"/api/users/{username}/lists/{listname}/items": {"GET": scopeRead, "POST": scopePost, "DELETE": scopePost},
+	"/api/lists/{listId}/items":                    {"GET": scopeRead, "POST": scopePost, "DELETE": scopePost},
+	"/api/lists/{listId}/items/{itemId}":           {"DELETE": scopePost},
+
+	"/api/users/{username}/custom_feeds":     {"GET": scopeRead, "POST": scopePost},
+	"/api/custom_feeds/{feedID}":             {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+	"/api/custom_feeds/{feedID}/communities": {"POST": scopePost, "DELETE": scopePost},
+
+	"/api/mutes":                                {"GET": scopeRead, "POST": scopePost, "DELETE": scopePost},
+	"/api/mutes/users/{mutedUserID}":            {"DELETE": scopePost},
+	"/api/mutes/communities/{mutedCommunityID}": {"DELETE": scopePost},
+	"/api/mutes/{muteID}":                       {"DELETE": scopePost},
+
+	"/api/posts":                               {"GET": scopeRead, "POST": scopePost},
+	"/api/posts/{postID}":                      {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+	"/api/posts/{postID}/revisions":            {"GET": scopeRead},
+	"/api/posts/{postID}/crossposts":           {"GET": scopeRead, "POST": scopePost},
+	"/api/_postVote":                           {"POST": scopeVote},
+	"/api/_pollVote":                           {"POST": scopeVote},
+	"/api/_uploads":                            {"POST": scopePost},
+	"/api/images/{imageID}":                    {"PUT": scopePost},
+	"/api/posts/{postID}/comments":             {"GET": scopeRead, "POST": scopePost},
+	"/api/posts/{postID}/comments/{commentID}": {"PUT": scopePost, "DELETE": scopePost},
+	"/api/comments/{commentID}":                {"GET": scopeRead},
+	"/api/comments/{commentID}/revisions":      {"GET": scopeRead},
+	"/api/_commentVote":                        {"POST": scopeVote},
+
+	"/api/communities":                                  {"GET": scopeRead, "POST": scopePost},
+	"/api/_joinCommunity":                               {"POST": scopePost},
+	"/api/communities/{communityID}":                    {"GET": scopeRead, "PUT": scopeModerate},
+	"/api/communities/{communityID}/rules":              {"GET": scopeRead, "POST": scopeModerate},
+	"/api/communities/{communityID}/rules/{ruleID}":     {"GET": scopeRead, "PUT": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/flairs":             {"GET": scopeRead, "POST": scopeModerate},
+	"/api/communities/{communityID}/flairs/{flairID}":   {"PUT": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/mods":               {"GET": scopeRead, "POST": scopeModerate},
+	"/api/communities/{communityID}/mods/{mod}":         {"DELETE": scopeModerate},
+	"/api/communities/{communityID}/reports":            {"GET": scopeModerate},
+	"/api/communities/{communityID}/reports/{reportID}": {"PUT": scopeModerate, "POST": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/modlog":             {"GET": scopeRead},
+
+	"/api/communities/{communityID}/webhooks":                        {"GET": scopeModerate, "POST": scopeModerate},
+	"/api/communities/{communityID}/webhooks/{webhookID}":            {"DELETE": scopeModerate},
+	"/api/communities/{communityID}/webhooks/{webhookID}/deliveries": {"GET": scopeModerate},
+	"/api/communities/{communityID}/modmail":                         {"GET": scopeModerate},
+	"/api/communities/{communityID}/modmail/{threadID}":              {"GET": scopeModerate, "POST": scopeModerate, "PUT": scopeModerate},
+	"/api/communities/{communityID}/recurring_threads":               {"GET": scopeModerate, "POST": scopeModerate},
+	"/api/communities/{communityID}/recurring_threads/{threadID}":    {"GET": scopeModerate, "PUT": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/automod":                         {"GET": scopeModerate, "PUT": scopeModerate},
+	"/api/communities/{communityID}/automod/test":                    {"POST": scopeModerate},
+	"/api/communities/{communityID}/queue":                           {"GET": scopeModerate, "POST": scopeModerate},
+	"/api/communities/{communityID}/banned":                          {"GET": scopeModerate, "POST": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/pro_pic":                         {"POST": scopeModerate, "DELETE": scopeModerate},
+	"/api/communities/{communityID}/banner_image":                    {"POST": scopeModerate, "DELETE": scopeModerate},
+
+	"/api/notifications":                  {"GET": scopeRead, "POST": scopePost},
+	"/api/notifications/{notificationID}": {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+
+	"/api/conversations":                           {"GET": scopeRead, "POST": scopePost},
+	"/api/conversations/{conversationID}":          {"GET": scopeRead, "PUT": scopePost},
+	"/api/conversations/{conversationID}/messages": {"GET": scopeRead, "POST": scopePost},
+	"/api/messages/{messageID}":                    {"DELETE": scopePost},
+	"/api/messages/{messageID}/reports":            {"POST": scopePost},
+	"/api/modmail":                                 {"GET": scopeRead, "POST": scopePost},
+	"/api/modmail/{threadID}":                      {"GET": scopeRead, "POST": scopePost},
+
+	"/api/scheduled_posts":                   {"GET": scopeRead},
+	"/api/scheduled_posts/{scheduledPostID}": {"GET": scopeRead, "PUT": scopePost, "DELETE": scopePost},
+
+	"/api/community_requests":             {"GET": scopeAdmin, "POST": scopePost},
+	"/api/community_requests/{requestID}": {"DELETE": scopeAdmin},
+	"/api/_report":                        {"POST": scopePost},
+
+	"/api/_admin":                     {"POST": scopeAdmin},
+	"/api/users":                      {"GET": scopeAdmin},
+	"/api/comments":                   {"GET": scopeAdmin},
+	"/api/message_reports":            {"GET": scopeAdmin},
+	"/api/message_reports/{reportID}": {"PUT": scopeAdmin},
+
+	"/api/_link_info":         {"GET": scopeRead},
+	"/api/search":             {"GET": scopeRead},
+	"/api/modlog":             {"GET": scopeAdmin},
+	"/api/analytics/bss":      {"GET": scopeAdmin},
+	"/api/site_settings":      {"GET": scopeRead, "PUT": scopeAdmin},
+	"/api/ipblocks":           {"GET": scopeAdmin, "POST": scopeAdmin, "DELETE": scopeAdmin},
+	"/api/ipblocks/{blockID}": {"GET": scopeAdmin, "DELETE": scopeAdmin},
+}
+
+// apiTokenScope returns the scope an API token must have to access the route
+// of r. If the route cannot be accessed with an API token, ok is false.
+func apiTokenScope(r *http.Request) (scope core.APITokenScope, ok bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	if scope, ok = apiTokenRoutes[path][r.Method]; !ok {
+		return "", false
+	}
+
+	// Posts and comments are moderated with the same endpoints that their
+	// authors use to edit and delete them.
+	if (path == "/api/posts/{postID}" || path == "/api/posts/{postID}/comments/{commentID}") && r.Method != "GET" {
+		query := r.URL.Query()
+		action := query.Get("action")
+		switch {
+		case query.Get("deleteAs") == "admins", query.Get("lockAs") == "admins", query.Get("userGroup") == "admins":
+			return scopeAdmin, true
+		case action == "announce", (action == "pin" || action == "unpin") && strings.ToLower(query.Get("siteWide")) == "true":
+			return scopeAdmin, true
+		case action != "" && action != "changeFlair", query.Get("deleteAs") != "" && query.Get("deleteAs") != "normal":
+			return scopeModerate, true
+		}
+	}
+	return scope, true
+}
+
+// bearerToken returns the token in the Authorization header of r, if there's
+// one.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// serveWithAPIToken serves r, authenticated with an API token instead of a
+// session. No cookies are set, and no CSRF check is done.
+func (s *Server) serveWithAPIToken(w http.ResponseWriter, r *http.Request, h handler, token string) {
+	t, err := core.AuthenticateAPIToken(r.Context(), s.db, token, httputil.GetIP(r))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	scope, ok := apiTokenScope(r)
+	if !ok {
+		s.writeError(w, r, httperr.NewForbidden("api_token_not_allowed", "This endpoint cannot be accessed with an API token."))
+		return
+	}
+	if !t.HasScope(scope) {
+		s.writeError(w, r, httperr.NewForbidden("api_token_missing_scope", "API token does not have the "+string(scope)+" scope."))
+		return
+	}
+
+	req := newRequest(r, &sessions.Session{Values: make(map[string]any)})
+	req.viewer, req.loggedIn = &t.UserID, true
+	if err := s.checkTwoFactorPolicy(w, req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err = h(&responseWriter{w: w}, req); err != nil {
+		s.writeError(w, r, err)
+	}
+}
+
+// /api/api_tokens [GET, POST]
+func (s *Server) handleAPITokens(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "GET" {
+		tokens, err := core.GetAPITokens(r.ctx, s.db, *r.viewer)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(tokens)
+	}
+
+	body := struct {
+		Name   string               `json:"name"`
+		Scopes []core.APITokenScope `json:"scopes"`
+	}{}
+	if err := r.unmarshalJSONBody(&body); err != nil {
+		return err
+	}
+
+	t, token, err := core.CreateAPIToken(r.ctx, s.db, *r.viewer, body.Name, body.Scopes)
+	if err != nil {
+		return err
+	}
+
+	// The token is returned only this once.
+	w.WriteHeader(http.StatusCreated)
+	return w.writeJSON(struct {
+		*core.APIToken
+		Token string `json:"token"`
+	}{t, token})
+}
+
+// /api/api_tokens/{tokenID} [DELETE]
+func (s *Server) deleteAPIToken(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strconv.Atoi(r.muxVar("tokenID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_token_id", "Invalid token ID.")
+	}
+	if err := core.DeleteAPIToken(r.ctx, s.db, *r.viewer, id); err != nil {
+		return err
+	}
+	return w.writeString(`{"success":true}`)
+}
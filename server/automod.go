@@ -0,0 +1,74 @@
+package server
+
+import (
+	"github.com/discuitnet/discuit/core"
+)
+
+// /api/communities/{communityID}/automod [GET, PUT]
+//
+// A PUT request, with body {"rules": "..."}, replaces the AutoModerator rules
+// of the community. The rules are written in YAML (or JSON).
+func (s *Server) handleCommunityAutomod(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "PUT" {
+		body := struct {
+			Rules string `json:"rules"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		config, err := comm.SetAutomodRules(r.ctx, s.db, *r.viewer, body.Rules)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(config)
+	}
+
+	config, err := core.GetAutomodConfig(r.ctx, s.db, comm.ID)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(config)
+}
+
+// /api/communities/{communityID}/automod/test [POST]
+//
+// A dry-run of AutoModerator on a made up post or comment (authored by the
+// logged in user, or by the user in the username field). It returns the rules
+// that match, without taking any actions. If the rules field of the body is
+// missing, the saved rules are used.
+func (s *Server) testCommunityAutomod(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		core.AutomodTestInput
+		Username string `json:"username"`
+	}{}
+	body.Type = core.ContentTypePost
+	if err := r.unmarshalJSONBody(&body); err != nil {
+		return err
+	}
+	body.Author = *r.viewer
+	if body.Username != "" {
+		user, err := core.GetUserByUsername(r.ctx, s.db, body.Username, nil)
+		if err != nil {
+			return err
+		}
+		body.Author = user.ID
+	}
+
+	matched, err := comm.TestAutomod(r.ctx, s.db, &body.AutomodTestInput)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(struct {
+		Matched []*core.AutomodRule `json:"matched"`
+	}{matched})
+}
@@ -15,9 +15,20 @@ func (s *Server) getPostComments(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	query := r.urlQueryParams()
 
+	sort := core.CommentSortDefault
+	if text := query.Get("sort"); text != "" {
+		sort = core.CommentSort(text)
+		if !sort.Valid() {
+			return core.ErrInvalidCommentSort
+		}
+	}
+
 	// Reply comments.
 	parentIDText := query.Get("parentId")
 	if parentIDText != "" {
@@ -25,7 +36,7 @@ func (s *Server) getPostComments(w *responseWriter, r *request) error {
 		if err != nil {
 			return err
 		}
-		comments, err := post.GetCommentReplies(r.ctx, s.db, r.viewer, parentID)
+		comments, err := post.GetCommentReplies(r.ctx, s.db, r.viewer, parentID, sort)
 		if err != nil {
 			return err
 		}
@@ -45,11 +56,11 @@ func (s *Server) getPostComments(w *responseWriter, r *request) error {
 	var cursor *core.CommentsCursor
 	if nextID != nil {
 		cursor = new(core.CommentsCursor)
-		cursor.Upvotes = nextPoints
+		cursor.Score = nextPoints
 		cursor.NextID = *nextID
 	}
 
-	if _, err = post.GetComments(r.ctx, s.db, r.viewer, cursor); err != nil {
+	if _, err = post.GetComments(r.ctx, s.db, r.viewer, cursor, sort); err != nil {
 		return err
 	}
 
@@ -75,10 +86,43 @@ func (s *Server) getComment(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := comment.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	return w.writeJSON(comment)
 }
 
+// /api/comments/:commentID/revisions [GET]
+func (s *Server) getCommentRevisions(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	commentID, err := strToID(r.muxVar("commentID"))
+	if err != nil {
+		return err
+	}
+
+	comment, err := core.GetComment(r.ctx, s.db, commentID, r.viewer)
+	if err != nil {
+		return err
+	}
+	if err := comment.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+
+	revs, err := comment.GetRevisions(r.ctx, s.db, *r.viewer)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSON(struct {
+		Revisions []*core.CommentRevision `json:"revisions"`
+		Diffs     []*core.RevisionDiff    `json:"diffs"`
+	}{revs, core.CommentRevisionsDiffs(revs)})
+}
+
 // /api/posts/:postID/comments [POST]
 func (s *Server) addComment(w *responseWriter, r *request) error {
 	if !r.loggedIn {
@@ -105,6 +149,9 @@ func (s *Server) addComment(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	var as core.UserGroup = core.UserGroupNormal
 	if _as := r.urlQueryParams().Get("userGroup"); _as != "" {
@@ -147,6 +194,9 @@ func (s *Server) updateComment(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := comment.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	query := r.urlQueryParams()
 	action := query.Get("action")
@@ -208,6 +258,9 @@ func (s *Server) deleteComment(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := comment.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	query := r.urlQueryParams()
 	deleteAs := core.UserGroupNormal
@@ -246,6 +299,9 @@ func (s *Server) commentVote(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := comment.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	if comment.ViewerVoted.Bool {
 		if req.Up == comment.ViewerVotedUp.Bool {
@@ -198,6 +198,10 @@ func (s *Server) updateCommunity(w *responseWriter, r *request) error {
 	comm.NSFW = rcomm.NSFW
 	comm.About = rcomm.About
 	comm.PostingRestricted = rcomm.PostingRestricted
+	if rcomm.PostApproval != "" {
+		comm.PostApproval = rcomm.PostApproval
+	}
+	comm.ModLogPublic = rcomm.ModLogPublic
 
 	if err = comm.Update(r.ctx, s.db, *r.viewer); err != nil {
 		return err
@@ -569,6 +573,11 @@ func (s *Server) getCommunityReports(w *responseWriter, r *request) error {
 		return errInvalidFeedFilter
 	}
 
+	state := core.ReportState(r.urlQueryParamsValueString("state", string(core.ReportStateOpen)))
+	if !state.Valid() {
+		return httperr.NewBadRequest("invalid_state", "Invalid report state.")
+	}
+
 	response := struct {
 		Details core.CommunityReportsDetails `json:"details"`
 		Reports []*core.Report               `json:"reports"`
@@ -581,7 +590,7 @@ func (s *Server) getCommunityReports(w *responseWriter, r *request) error {
 		return err
 	}
 
-	response.Reports, err = core.GetReports(r.ctx, s.db, cid, t, limit, page)
+	response.Reports, err = core.GetReports(r.ctx, s.db, cid, t, state, limit, page)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
@@ -589,45 +598,108 @@ func (s *Server) getCommunityReports(w *responseWriter, r *request) error {
 	return w.writeJSON(response)
 }
 
-// /api/communities/{communityID}/reports/{reportID} [DELETE]
-func (s *Server) deleteReport(w *responseWriter, r *request) error {
+// getCommunityReport returns the report with the ID in the URL. It returns an
+// error if the viewer is neither a mod of the community nor an admin, or if the
+// report is not of the community.
+func (s *Server) getCommunityReport(r *request) (*core.Report, error) {
 	if !r.loggedIn {
-		return errNotLoggedIn
+		return nil, errNotLoggedIn
 	}
 
-	vars := mux.Vars(r.req)
-	cid, err := strToID(vars["communityID"])
+	cid, err := strToID(r.muxVar("communityID"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Only mods and admins have access.
 	if ok, err := userModOrAdmin(r.ctx, s.db, *r.viewer, comm); err != nil {
-		return err
+		return nil, err
 	} else if !ok {
-		return errNotAdminNorMod
+		return nil, errNotAdminNorMod
 	}
 
-	reportID, err := strconv.Atoi(vars["reportID"])
+	reportID, err := strconv.Atoi(r.muxVar("reportID"))
 	if err != nil {
-		return httperr.NewBadRequest("invalid_report_id", "Invalid report ID.")
+		return nil, httperr.NewBadRequest("invalid_report_id", "Invalid report ID.")
 	}
 	report, err := core.GetReport(r.ctx, s.db, reportID)
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, httperr.NewNotFound("report_not_found", "Report not found.")
+		}
+		return nil, err
+	}
+	if report.CommunityID != comm.ID {
+		return nil, httperr.NewNotFound("report_not_found", "Report not found.")
 	}
 	if err = report.FetchTarget(r.ctx, s.db); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// /api/communities/{communityID}/reports/{reportID} [PUT]
+func (s *Server) resolveReport(w *responseWriter, r *request) error {
+	report, err := s.getCommunityReport(r)
+	if err != nil {
 		return err
 	}
-	if err = report.Delete(r.ctx, s.db, *r.viewer); err != nil {
+
+	body := struct {
+		Action core.ReportAction `json:"action"`
+	}{}
+	if err := r.unmarshalJSONBody(&body); err != nil {
 		return err
 	}
 
+	if err = report.TakeAction(r.ctx, s.db, body.Action, *r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(report)
+}
+
+// /api/communities/{communityID}/reports/{reportID} [POST]
+//
+// Takes moderation actions (delete, lock, ban author) on the target of the
+// report and resolves the report, along with all other open reports on the
+// same target.
+func (s *Server) actOnReport(w *responseWriter, r *request) error {
+	report, err := s.getCommunityReport(r)
+	if err != nil {
+		return err
+	}
+
+	actions := &core.ReportActions{}
+	if err := r.unmarshalJSONBody(actions); err != nil {
+		return err
+	}
+
+	if err = report.Act(r.ctx, s.db, *r.viewer, actions); err != nil {
+		return err
+	}
+	if err = report.FetchTarget(r.ctx, s.db); err != nil {
+		return err
+	}
+	return w.writeJSON(report)
+}
+
+// /api/communities/{communityID}/reports/{reportID} [DELETE]
+//
+// Dismisses the report. The report is kept as resolved, with the action
+// "dismissed".
+func (s *Server) deleteReport(w *responseWriter, r *request) error {
+	report, err := s.getCommunityReport(r)
+	if err != nil {
+		return err
+	}
+	if err = report.TakeAction(r.ctx, s.db, core.ReportActionDismissed, *r.viewer); err != nil {
+		return err
+	}
 	return w.writeJSON(report)
 }
 
@@ -688,7 +760,11 @@ func (s *Server) handleCommunityBanned(w *responseWriter, r *request) error {
 		}
 
 		var expires *time.Time
-		if expiresText, ok := values["expires"]; ok {
+		expiresText, ok := values["expiresAt"]
+		if !ok {
+			expiresText, ok = values["expires"] // Older clients.
+		}
+		if ok {
 			expires = new(time.Time)
 			if err = expires.UnmarshalText([]byte(expiresText)); err != nil {
 				return httperr.NewBadRequest("invalid_expires", "Invalid expires.")
@@ -696,7 +772,7 @@ func (s *Server) handleCommunityBanned(w *responseWriter, r *request) error {
 		}
 
 		if r.req.Method == "POST" {
-			err = comm.BanUser(r.ctx, s.db, *r.viewer, user.ID, expires)
+			err = comm.BanUser(r.ctx, s.db, *r.viewer, user.ID, expires, values["reason"])
 		} else {
 			// Unban user.
 			err = comm.UnbanUser(r.ctx, s.db, *r.viewer, user.ID)
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	msql "github.com/discuitnet/discuit/internal/sql"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/users/{username}/custom_feeds [GET, POST]
+//
+// A GET request returns the custom feeds of the user (only the public ones,
+// unless the user is the viewer). A POST request creates a new custom feed for
+// the logged in user.
+func (s *Server) handleCustomFeeds(w *responseWriter, r *request) error {
+	user, err := core.GetUserByUsername(r.ctx, s.db, r.muxVar("username"), r.viewer)
+	if err != nil {
+		return err
+	}
+	userIsViewer := r.loggedIn && user.ID == *r.viewer
+
+	if r.req.Method == "POST" {
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		if !userIsViewer {
+			return httperr.NewForbidden("not-custom-feed-owner", "Not custom feed owner.")
+		}
+		if err := s.rateLimit(r, "custom_feed_c_1_"+r.viewer.String(), time.Second*2, 1); err != nil {
+			return err
+		}
+
+		form := struct {
+			Name        string          `json:"name"`
+			Description msql.NullString `json:"description"`
+			Public      bool            `json:"public"`
+			Communities []uid.ID        `json:"communities"` // Optional.
+		}{}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		feed, err := core.CreateCustomFeed(r.ctx, s.db, *r.viewer, form.Name, form.Description, form.Public)
+		if err != nil {
+			return err
+		}
+		for _, community := range form.Communities {
+			if err := feed.AddCommunity(r.ctx, s.db, *r.viewer, community); err != nil {
+				return err
+			}
+		}
+		if err := feed.FetchCommunities(r.ctx, s.db, r.viewer); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusCreated)
+		return w.writeJSON(feed)
+	}
+
+	feeds, err := core.GetUsersCustomFeeds(r.ctx, s.db, user.ID, !userIsViewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(feeds)
+}
+
+// getCustomFeed returns the custom feed in the URL, if the viewer can view it.
+func (s *Server) getCustomFeed(r *request) (*core.CustomFeed, error) {
+	id, err := strconv.Atoi(r.muxVar("feedID"))
+	if err != nil {
+		return nil, httperr.NewBadRequest("invalid-custom-feed-id", "Invalid custom feed id.")
+	}
+	feed, err := core.GetCustomFeed(r.ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if !feed.CanView(r.viewer) {
+		return nil, httperr.NewNotFound("custom-feed-not-found", "Custom feed not found.")
+	}
+	return feed, nil
+}
+
+// /api/custom_feeds/{feedID} [GET, PUT, DELETE]
+//
+// The posts of the custom feed are at /api/posts?feed=custom&id={feedID}.
+func (s *Server) handleCustomFeed(w *responseWriter, r *request) error {
+	feed, err := s.getCustomFeed(r)
+	if err != nil {
+		return err
+	}
+	if r.req.Method != "GET" && !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		form := struct {
+			Name        string          `json:"name"`
+			Description msql.NullString `json:"description"`
+			Public      bool            `json:"public"`
+		}{feed.Name, feed.Description, feed.Public}
+		if err := r.unmarshalJSONBody(&form); err != nil {
+			return err
+		}
+		feed.Name, feed.Description, feed.Public = form.Name, form.Description, form.Public
+		if err := feed.Update(r.ctx, s.db, *r.viewer); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := feed.Delete(r.ctx, s.db, *r.viewer); err != nil {
+			return err
+		}
+		return w.writeJSON(feed)
+	}
+
+	if err := feed.FetchCommunities(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(feed)
+}
+
+// /api/custom_feeds/{feedID}/communities [POST, DELETE]
+//
+// Adds or removes, with body {"communityId": "..."}, a community to or from the
+// custom feed.
+func (s *Server) handleCustomFeedCommunities(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+	feed, err := s.getCustomFeed(r)
+	if err != nil {
+		return err
+	}
+
+	form := struct {
+		CommunityID uid.ID `json:"communityId"`
+	}{}
+	if err := r.unmarshalJSONBody(&form); err != nil {
+		return err
+	}
+	if r.req.Method == "POST" {
+		err = feed.AddCommunity(r.ctx, s.db, *r.viewer, form.CommunityID)
+	} else {
+		err = feed.RemoveCommunity(r.ctx, s.db, *r.viewer, form.CommunityID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := feed.FetchCommunities(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(feed)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/mailer"
+)
+
+// maxDigestNotifications is the maximum number of notifications listed in a
+// digest email.
+const maxDigestNotifications = 20
+
+var errEmailDisabled = httperr.NewNotFound("email_disabled", "Emails are not enabled on this site.")
+
+// emailEnabled reports whether emails can be sent (see config.Config.SMTPAddr).
+func (s *Server) emailEnabled() bool {
+	return s.mailer != nil
+}
+
+// siteURL returns the public URL of the site (without a trailing slash), as
+// set in the config. It's never derived from a request, since the Host header
+// cannot be trusted. It's empty only if emails are not actually sent (see
+// config.Config.SiteURL).
+func (s *Server) siteURL() string {
+	return strings.TrimSuffix(s.config.SiteURL, "/")
+}
+
+// sendEmail sends an email in the background, logging any error.
+func (s *Server) sendEmail(to, subject, body string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.mailer.Send(ctx, &mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+			log.Printf("Error sending email (subject: %q): %v\n", subject, err)
+		}
+	}()
+}
+
+// sendConfirmationEmail sends an email with a link that confirms the email
+// address of user.
+func (s *Server) sendConfirmationEmail(ctx context.Context, user *core.User) error {
+	if !s.emailEnabled() {
+		return errEmailDisabled
+	}
+	token, err := user.NewEmailConfirmationToken(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	link := s.siteURL() + "/confirm-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi @%s,\n\n"+
+		"To confirm that this is your email address, open the following link:\n\n%s\n\n"+
+		"The link expires in 48 hours. If you did not create an account on %s, you can ignore this email.\n",
+		user.Username, link, s.config.SiteName)
+	s.sendEmail(user.Email.String, "Confirm your email address", body)
+	return nil
+}
+
+// sendPasswordResetEmail sends an email with a link to reset the password of
+// user.
+func (s *Server) sendPasswordResetEmail(ctx context.Context, user *core.User) error {
+	if !s.emailEnabled() {
+		return errEmailDisabled
+	}
+	token, err := user.NewPasswordResetToken(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	link := s.siteURL() + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi @%s,\n\n"+
+		"Someone (hopefully you) asked to reset the password of your %s account. To choose a new password, open the following link:\n\n%s\n\n"+
+		"The link expires in an hour. If you did not ask for a password reset, you can ignore this email.\n",
+		user.Username, s.config.SiteName, link)
+	s.sendEmail(user.Email.String, "Reset your password", body)
+	return nil
+}
+
+// SendNotificationDigests emails a digest of unseen notifications to the users
+// who have opted in to it. It returns the number of digests sent.
+func (s *Server) SendNotificationDigests(ctx context.Context) (int, error) {
+	if !s.emailEnabled() {
+		return 0, nil
+	}
+
+	users, err := core.GetDigestRecipients(ctx, s.db, 500)
+	if err != nil {
+		return 0, err
+	}
+
+	base := s.siteURL()
+	n := 0
+	for _, user := range users {
+		views, err := user.GetDigestNotifications(ctx, s.db, maxDigestNotifications)
+		if err != nil {
+			return n, err
+		}
+		// Record the digest as sent even if there's nothing to send, so that
+		// the user is not looked at again until the next interval.
+		if err := user.SetDigestSent(ctx, s.db); err != nil {
+			return n, err
+		}
+		if len(views) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Hi @%s,\n\nHere's what you missed on %s:\n\n", user.Username, s.config.SiteName)
+		for _, view := range views {
+			b.WriteString("- " + view.Title + "\n")
+			if view.ToURL != "" {
+				b.WriteString("  " + base + view.ToURL + "\n")
+			}
+		}
+		fmt.Fprintf(&b, "\nTo stop receiving these emails, turn off the notification digest in your settings:\n%s/settings\n", base)
+
+		subject := fmt.Sprintf("You have %d unread notifications", user.NumNewNotifications)
+		if user.NumNewNotifications == 1 {
+			subject = "You have 1 unread notification"
+		}
+		s.sendEmail(user.Email.String, subject, b.String())
+		n++
+	}
+	return n, nil
+}
@@ -123,7 +123,10 @@ func (s *Server) feed(w *responseWriter, r *request) error {
 			}
 			cid = &c
 		}
-		var feed core.FeedType
+		var (
+			feed         core.FeedType
+			customFeedID *int
+		)
 		switch feedParam := query.Get("feed"); feedParam {
 		case "all", "":
 			feed = core.FeedTypeAll
@@ -136,18 +139,45 @@ func (s *Server) feed(w *responseWriter, r *request) error {
 			}
 		case "moderating":
 			feed = core.FeedTypeModerating
+		case "custom":
+			feed = core.FeedTypeCustom
+			id, err := strconv.Atoi(query.Get("id"))
+			if err != nil {
+				return httperr.NewBadRequest("invalid-custom-feed-id", "Invalid custom feed id.")
+			}
+			customFeed, err := core.GetCustomFeed(r.ctx, s.db, id)
+			if err != nil {
+				return err
+			}
+			if !customFeed.CanView(r.viewer) {
+				return httperr.NewNotFound("custom-feed-not-found", "Custom feed not found.")
+			}
+			customFeedID = &id
 		default:
 			return httperr.NewBadRequest("invalid-feed-type", "Invalid feed type.")
 		}
 		if cid != nil {
 			feed = core.FeedTypeCommunity
 		}
+		var flair *int
+		if flairText := query.Get("flair"); flairText != "" {
+			if feed != core.FeedTypeCommunity {
+				return httperr.NewBadRequest("flair-without-community", "Flair filter is only supported on community feeds.")
+			}
+			id, err := strconv.Atoi(flairText)
+			if err != nil {
+				return httperr.NewBadRequest("invalid_flair_id", "Invalid flair ID.")
+			}
+			flair = &id
+		}
 		set, err = core.GetFeed(r.ctx, s.db, &core.FeedOptions{
 			Feed:        feed,
 			Sort:        sort,
 			DefaultSort: sort == s.config.DefaultFeedSort,
 			Viewer:      r.viewer,
 			Community:   cid,
+			CustomFeed:  customFeedID,
+			Flair:       flair,
 			Limit:       limit,
 			Next:        nextText,
 		})
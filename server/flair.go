@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// /api/communities/{communityID}/flairs [GET, POST]
+//
+// Anyone can list the flairs of a community, but only the mods (and admins)
+// can create them.
+func (s *Server) handleCommunityFlairs(w *responseWriter, r *request) error {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		flairs, err := core.GetFlairs(r.ctx, s.db, comm.ID)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(flairs)
+	}
+
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+	opts := &core.FlairOpts{}
+	if err := r.unmarshalJSONBody(opts); err != nil {
+		return err
+	}
+	flair, err := comm.CreateFlair(r.ctx, s.db, *r.viewer, opts)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return w.writeJSON(flair)
+}
+
+// /api/communities/{communityID}/flairs/{flairID} [PUT, DELETE]
+func (s *Server) handleCommunityFlair(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(r.muxVar("flairID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_flair_id", "Invalid flair ID.")
+	}
+	flair, err := core.GetFlair(r.ctx, s.db, comm.ID, id)
+	if err != nil {
+		return err
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		opts := &core.FlairOpts{}
+		if err := r.unmarshalJSONBody(opts); err != nil {
+			return err
+		}
+		if err := flair.Update(r.ctx, s.db, *r.viewer, opts); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := flair.Delete(r.ctx, s.db, *r.viewer); err != nil {
+			return err
+		}
+	}
+	return w.writeJSON(flair)
+}
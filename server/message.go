@@ -0,0 +1,275 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// getConversationOfRequest returns the conversation in the URL of r, as seen
+// by the logged in user.
+func (s *Server) getConversationOfRequest(r *request) (*core.Conversation, error) {
+	if !r.loggedIn {
+		return nil, errNotLoggedIn
+	}
+	id, err := strToID(r.muxVar("conversationID"))
+	if err != nil {
+		return nil, err
+	}
+	return core.GetConversation(r.ctx, s.db, id, *r.viewer)
+}
+
+// /api/conversations [GET, POST]
+//
+// A POST request sends a message to a user, starting a conversation with them
+// if there isn't one already.
+func (s *Server) handleConversations(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			Username string `json:"username"`
+			Body     string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+			return err
+		}
+		// Limit the number of people that a user can message in a short
+		// span of time (spam).
+		if err := s.rateLimit(r, "new_messages_1_"+r.viewer.String(), time.Minute*5, 30); err != nil {
+			return err
+		}
+
+		from, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+		if err != nil {
+			return err
+		}
+		to, err := core.GetUserByUsername(r.ctx, s.db, body.Username, r.viewer)
+		if err != nil {
+			return err
+		}
+		message, err := core.SendMessage(r.ctx, s.db, from, to, body.Body)
+		if err != nil {
+			return err
+		}
+		conv, err := core.GetConversation(r.ctx, s.db, message.ConversationID, *r.viewer)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(conv)
+	}
+
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		Conversations []*core.Conversation `json:"conversations"`
+		Next          *string              `json:"next"`
+		NumUnread     int                  `json:"noUnread"`
+	}{}
+	if res.Conversations, res.Next, err = core.GetConversations(r.ctx, s.db, *r.viewer, limit, nextPtr); err != nil {
+		return err
+	}
+	if res.NumUnread, err = core.NumUnreadConversations(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(res)
+}
+
+// /api/conversations/{conversationID} [GET, PUT]
+//
+// A PUT request with the query parameter action=markAsRead marks all the
+// messages received in the conversation as read.
+func (s *Server) handleConversation(w *responseWriter, r *request) error {
+	conv, err := s.getConversationOfRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "PUT" {
+		switch r.urlQueryParamsValue("action") {
+		case "markAsRead":
+			if err := conv.MarkAsRead(r.ctx, s.db); err != nil {
+				return err
+			}
+		default:
+			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+		}
+	}
+	return w.writeJSON(conv)
+}
+
+// /api/conversations/{conversationID}/messages [GET, POST]
+func (s *Server) handleConversationMessages(w *responseWriter, r *request) error {
+	conv, err := s.getConversationOfRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			Body string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+			return err
+		}
+		message, err := conv.Send(r.ctx, s.db, body.Body)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(message)
+	}
+
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		Messages []*core.Message `json:"messages"`
+		Next     *string         `json:"next"`
+	}{}
+	if res.Messages, res.Next, err = conv.GetMessages(r.ctx, s.db, limit, nextPtr); err != nil {
+		return err
+	}
+	if res.Messages == nil {
+		res.Messages = []*core.Message{}
+	}
+	return w.writeJSON(res)
+}
+
+// getMessageOfRequest returns the message in the URL of r, provided that the
+// logged in user is a participant in its conversation.
+func (s *Server) getMessageOfRequest(r *request) (*core.Message, error) {
+	if !r.loggedIn {
+		return nil, errNotLoggedIn
+	}
+	id, err := strToID(r.muxVar("messageID"))
+	if err != nil {
+		return nil, err
+	}
+	message, err := core.GetMessage(r.ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := core.GetConversation(r.ctx, s.db, message.ConversationID, *r.viewer); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// /api/messages/{messageID} [DELETE]
+func (s *Server) deleteMessage(w *responseWriter, r *request) error {
+	message, err := s.getMessageOfRequest(r)
+	if err != nil {
+		return err
+	}
+	if err := message.Delete(r.ctx, s.db, *r.viewer); err != nil {
+		return err
+	}
+	return w.writeJSON(message)
+}
+
+// /api/messages/{messageID}/reports [POST]
+func (s *Server) reportMessage(w *responseWriter, r *request) error {
+	message, err := s.getMessageOfRequest(r)
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		ReasonID int `json:"reason"`
+	}{}
+	if err := r.unmarshalJSONBody(&body); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "report_message_1_"+r.viewer.String(), time.Minute, 10); err != nil {
+		return err
+	}
+
+	if _, err := core.NewMessageReport(r.ctx, s.db, message, body.ReasonID, *r.viewer); err != nil {
+		return err
+	}
+	w.writeString(`{"success": true}`)
+	return nil
+}
+
+// /api/message_reports [GET]
+func (s *Server) getMessageReports(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	page := 1
+	if spage := query.Get("page"); spage != "" {
+		if page, err = strconv.Atoi(spage); err != nil || page < 1 {
+			return httperr.NewBadRequest("invalid_page", "Invalid page.")
+		}
+	}
+	state := core.ReportState(r.urlQueryParamsValueString("state", string(core.ReportStateOpen)))
+	if !state.Valid() {
+		return httperr.NewBadRequest("invalid_state", "Invalid report state.")
+	}
+
+	reports, err := core.GetMessageReports(r.ctx, s.db, state, limit, page)
+	if err != nil {
+		return err
+	}
+	if reports == nil {
+		reports = []*core.MessageReport{}
+	}
+	return w.writeJSON(reports)
+}
+
+// /api/message_reports/{reportID} [PUT]
+func (s *Server) resolveMessageReport(w *responseWriter, r *request) error {
+	admin, err := getLoggedInAdmin(s.db, r)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(r.muxVar("reportID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_id", "Invalid report ID.")
+	}
+	report, err := core.GetMessageReport(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		Action core.ReportAction `json:"action"`
+	}{}
+	if err := r.unmarshalJSONBody(&body); err != nil {
+		return err
+	}
+	if err := report.TakeAction(r.ctx, s.db, body.Action, admin.ID); err != nil {
+		return err
+	}
+	return w.writeJSON(report)
+}
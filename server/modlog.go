@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// parseModLogOptions parses the filters and the pagination parameters common to
+// all the modlog endpoints.
+func (s *Server) parseModLogOptions(query url.Values) (*core.ModLogOptions, error) {
+	opts := &core.ModLogOptions{
+		Action:     core.ModLogAction(query.Get("action")),
+		TargetType: core.ModLogTargetType(query.Get("targetType")),
+		TargetID:   query.Get("targetId"),
+	}
+
+	var err error
+	if opts.Limit, err = getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax); err != nil {
+		return nil, err
+	}
+
+	if next := query.Get("next"); next != "" {
+		n, err := strconv.Atoi(next)
+		if err != nil {
+			return nil, httperr.NewBadRequest("invalid_cursor", "Invalid pagination cursor.")
+		}
+		opts.Next = &n
+	}
+	return opts, nil
+}
+
+// /api/communities/{communityID}/modlog [GET]
+func (s *Server) getCommunityModLog(w *responseWriter, r *request) error {
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return err
+	}
+
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	// Unless the community has made its modlog public, only mods and admins
+	// have access.
+	if !comm.ModLogPublic {
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		if ok, err := userModOrAdmin(r.ctx, s.db, *r.viewer, comm); err != nil {
+			return err
+		} else if !ok {
+			return errNotAdminNorMod
+		}
+	}
+
+	opts, err := s.parseModLogOptions(r.urlQueryParams())
+	if err != nil {
+		return err
+	}
+	opts.Community = &comm.ID
+
+	set, err := core.GetModLog(r.ctx, s.db, opts)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
+
+// /api/modlog [GET]
+func (s *Server) getModLog(w *responseWriter, r *request) error {
+	if _, err := getLoggedInAdmin(s.db, r); err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	opts, err := s.parseModLogOptions(query)
+	if err != nil {
+		return err
+	}
+
+	if communityID := query.Get("communityId"); communityID != "" {
+		cid, err := strToID(communityID)
+		if err != nil {
+			return err
+		}
+		opts.Community = &cid
+	}
+	if username := query.Get("actor"); username != "" {
+		actor, err := core.GetUserByUsername(r.ctx, s.db, username, nil)
+		if err != nil {
+			return err
+		}
+		opts.Actor = &actor.ID
+	}
+
+	set, err := core.GetModLog(r.ctx, s.db, opts)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/modmail [GET, POST]
+//
+// A GET request returns the modmail threads opened by the logged in user. A
+// POST request opens a new thread with the moderators of a community.
+func (s *Server) handleModmail(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			CommunityID uid.ID `json:"communityId"`
+			Subject     string `json:"subject"`
+			Body        string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+			return err
+		}
+		if err := s.rateLimit(r, "modmail_new_1_"+r.viewer.String(), time.Hour, 10); err != nil {
+			return err
+		}
+
+		user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+		if err != nil {
+			return err
+		}
+		comm, err := core.GetCommunityByID(r.ctx, s.db, body.CommunityID, r.viewer)
+		if err != nil {
+			return err
+		}
+		thread, err := core.NewModmailThread(r.ctx, s.db, comm, user, body.Subject, body.Body)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(thread)
+	}
+
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		Threads []*core.ModmailThread `json:"threads"`
+		Next    *string               `json:"next"`
+	}{}
+	if res.Threads, res.Next, err = core.GetUserModmailThreads(r.ctx, s.db, *r.viewer, limit, nextPtr); err != nil {
+		return err
+	}
+	if res.Threads == nil {
+		res.Threads = []*core.ModmailThread{}
+	}
+	return w.writeJSON(res)
+}
+
+// writeModmailThread writes thread along with a page of its messages (latest
+// first).
+func (s *Server) writeModmailThread(w *responseWriter, r *request, thread *core.ModmailThread, forMod bool) error {
+	limit, err := getFeedLimit(r.urlQueryParams(), s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := r.urlQueryParamsValue("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		*core.ModmailThread
+		Messages []*core.ModmailMessage `json:"messages"`
+		Next     *string                `json:"next"`
+	}{ModmailThread: thread}
+	if res.Messages, res.Next, err = thread.GetMessages(r.ctx, s.db, forMod, limit, nextPtr); err != nil {
+		return err
+	}
+	return w.writeJSON(res)
+}
+
+// /api/modmail/{threadID} [GET, POST]
+//
+// For the user who opened the thread. A POST request adds a reply.
+func (s *Server) handleModmailThread(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strToID(r.muxVar("threadID"))
+	if err != nil {
+		return err
+	}
+	thread, err := core.GetModmailThread(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+	if thread.UserID != *r.viewer {
+		return core.ErrModmailThreadNotFound
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			Body string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+			return err
+		}
+		user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := thread.Reply(r.ctx, s.db, user, false, body.Body); err != nil {
+			return err
+		}
+	}
+	return s.writeModmailThread(w, r, thread, false)
+}
+
+// /api/communities/{communityID}/modmail [GET]
+func (s *Server) getCommunityModmail(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := query.Get("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		Threads []*core.ModmailThread `json:"threads"`
+		Next    *string               `json:"next"`
+		NumNew  int                   `json:"noNew"`
+	}{}
+	state := core.ModmailState(query.Get("state"))
+	if res.Threads, res.Next, err = core.GetCommunityModmailThreads(r.ctx, s.db, comm.ID, state, limit, nextPtr); err != nil {
+		return err
+	}
+	if res.Threads == nil {
+		res.Threads = []*core.ModmailThread{}
+	}
+	if res.NumNew, err = core.NumNewModmailThreads(r.ctx, s.db, comm.ID); err != nil {
+		return err
+	}
+	return w.writeJSON(res)
+}
+
+// /api/communities/{communityID}/modmail/{threadID} [GET, POST, PUT]
+//
+// For the moderators. A POST request adds a reply on behalf of the moderators,
+// and a PUT request (with body {"state": "..."}) changes the state of the
+// thread.
+func (s *Server) handleCommunityModmailThread(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	id, err := strToID(r.muxVar("threadID"))
+	if err != nil {
+		return err
+	}
+	thread, err := core.GetModmailThread(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+	if thread.CommunityID != comm.ID {
+		return core.ErrModmailThreadNotFound
+	}
+
+	switch r.req.Method {
+	case "POST":
+		body := struct {
+			Body string `json:"body"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := s.rateLimitUpdateContent(r, *r.viewer); err != nil {
+			return err
+		}
+		mod, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := thread.Reply(r.ctx, s.db, mod, true, body.Body); err != nil {
+			return err
+		}
+	case "PUT":
+		body := struct {
+			State core.ModmailState `json:"state"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if err := thread.SetState(r.ctx, s.db, body.State); err != nil {
+			return err
+		}
+	}
+	return s.writeModmailThread(w, r, thread, true)
+}
@@ -26,17 +26,34 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 			return err
 		}
 
+		keywordMutes, err := core.GetMutedKeywords(r.ctx, s.db, *r.viewer)
+		if err != nil {
+			return err
+		}
+		domainMutes, err := core.GetMutedDomains(r.ctx, s.db, *r.viewer)
+		if err != nil {
+			return err
+		}
+
 		if commMutes == nil {
 			commMutes = []*core.Mute{}
 		}
 		if userMutes == nil {
 			userMutes = []*core.Mute{}
 		}
+		if keywordMutes == nil {
+			keywordMutes = []*core.Mute{}
+		}
+		if domainMutes == nil {
+			domainMutes = []*core.Mute{}
+		}
 
 		response := struct {
 			CommunityMutes []*core.Mute `json:"communityMutes"`
 			UserMutes      []*core.Mute `json:"userMutes"`
-		}{commMutes, userMutes}
+			KeywordMutes   []*core.Mute `json:"keywordMutes"`
+			DomainMutes    []*core.Mute `json:"domainMutes"`
+		}{commMutes, userMutes, keywordMutes, domainMutes}
 
 		return json.NewEncoder(w).Encode(response)
 	}
@@ -50,6 +67,8 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 		request := struct {
 			UserID      uid.ID `json:"userId"`
 			CommunityID uid.ID `json:"communityId"`
+			Keyword     string `json:"keyword"`
+			Domain      string `json:"domain"` // A domain or a URL.
 		}{}
 		if err := r.unmarshalJSONBody(&request); err != nil {
 			return err
@@ -64,6 +83,16 @@ func (s *Server) handleMutes(w *responseWriter, r *request) error {
 				return err
 			}
 		}
+		if request.Keyword != "" {
+			if err := core.MuteKeyword(r.ctx, s.db, *r.viewer, request.Keyword); err != nil {
+				return err
+			}
+		}
+		if request.Domain != "" {
+			if err := core.MuteDomain(r.ctx, s.db, *r.viewer, request.Domain); err != nil {
+				return err
+			}
+		}
 		if err := writeMutes(w); err != nil {
 			return err
 		}
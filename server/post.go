@@ -6,12 +6,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/discuitnet/discuit/core"
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/images"
+	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/internal/utils"
 )
@@ -38,6 +40,16 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		UserGroup core.UserGroup      `json:"userGroup"`
 		ImageId   string              `json:"imageId"`
 		Images    []*core.ImageUpload `json:"images"`
+		Poll      struct {
+			Options        []string   `json:"options"`
+			MultipleChoice bool       `json:"multipleChoice"`
+			ClosesAt       *time.Time `json:"closesAt"`
+		} `json:"poll"`
+
+		// If set, the post is scheduled to be published at this time, and
+		// pinned to the community then if Pin is true.
+		PublishAt *time.Time `json:"publishAt"`
+		Pin       bool       `json:"pin"`
 	}{
 		PostType:  core.PostTypeText,
 		UserGroup: core.UserGroupNormal,
@@ -66,12 +78,8 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		}
 	}
 
-	var post *core.Post
-	switch req.PostType {
-	case core.PostTypeText:
-		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body)
-	case core.PostTypeImage:
-		var images []*core.ImageUpload
+	var images []*core.ImageUpload
+	if req.PostType == core.PostTypeImage {
 		if req.Images != nil {
 			images = req.Images
 		} else {
@@ -86,9 +94,49 @@ func (s *Server) addPost(w *responseWriter, r *request) error {
 		if len(images) > s.config.MaxImagesPerPost {
 			return httperr.NewBadRequest("too-many-images", "Maximum images count exceeded.")
 		}
-		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, images)
+	}
+
+	if req.PublishAt != nil {
+		scheduled := &core.ScheduledPost{
+			AuthorID:    *r.viewer,
+			CommunityID: comm.ID,
+			PostedAs:    req.UserGroup,
+			Type:        req.PostType,
+			Title:       req.Title,
+			Body:        msql.NewNullString(req.Body),
+			Images:      images,
+			Pin:         req.Pin,
+			PublishAt:   *req.PublishAt,
+		}
+		switch req.PostType {
+		case core.PostTypeImage:
+			scheduled.Body = msql.NullString{}
+		case core.PostTypeLink:
+			scheduled.Body = msql.NullString{}
+			scheduled.URL = msql.NewNullString(req.URL)
+		case core.PostTypePoll:
+			scheduled.Poll = &core.ScheduledPoll{
+				Options:        req.Poll.Options,
+				MultipleChoice: req.Poll.MultipleChoice,
+				ClosesAt:       req.Poll.ClosesAt,
+			}
+		}
+		if scheduled, err = core.NewScheduledPost(r.ctx, s.db, scheduled); err != nil {
+			return err
+		}
+		return w.writeJSON(scheduled)
+	}
+
+	var post *core.Post
+	switch req.PostType {
+	case core.PostTypeText:
+		post, err = core.CreateTextPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+	case core.PostTypeImage:
+		post, err = core.CreateImagePost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, images, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
 	case core.PostTypeLink:
-		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.URL)
+		post, err = core.CreateLinkPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.URL, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+	case core.PostTypePoll:
+		post, err = core.CreatePollPost(r.ctx, s.db, *r.viewer, comm.ID, req.Title, req.Body, req.Poll.Options, req.Poll.MultipleChoice, req.Poll.ClosesAt, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
 	default:
 		return httperr.NewBadRequest("invalid_post_type", "Invalid post type.")
 	}
@@ -114,8 +162,15 @@ func (s *Server) getPost(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+
+	if _, err = post.GetComments(r.ctx, s.db, r.viewer, nil, core.CommentSortDefault); err != nil {
+		return err
+	}
 
-	if _, err = post.GetComments(r.ctx, s.db, r.viewer, nil); err != nil {
+	if err = post.FetchCrossposts(r.ctx, s.db); err != nil {
 		return err
 	}
 
@@ -136,6 +191,87 @@ func (s *Server) getPost(w *responseWriter, r *request) error {
 	return w.writeJSON(post)
 }
 
+// /api/posts/:postID/crossposts [GET, POST]
+//
+// A GET request returns the crossposts of the post. A POST request, with body
+// {"community": "...", "title": "..."} (title is optional), crossposts the post
+// to community.
+func (s *Server) handlePostCrossposts(w *responseWriter, r *request) error {
+	post, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, r.req.Method == "GET")
+	if err != nil {
+		return err
+	}
+
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		crossposts, err := post.GetCrossposts(r.ctx, s.db)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(crossposts)
+	}
+
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+	// Crossposts count towards the same limits as new posts.
+	if err := s.rateLimit(r, "add_post_1_"+r.viewer.String(), time.Second*10, 1); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "add_post_2_"+r.viewer.String(), time.Hour*24, 70); err != nil {
+		return err
+	}
+
+	req := struct {
+		Community string `json:"community"`
+		Title     string `json:"title"`
+	}{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+	comm, err := core.GetCommunityByName(r.ctx, s.db, req.Community, nil)
+	if err != nil {
+		return err
+	}
+
+	crosspost, err := core.CreateCrosspost(r.ctx, s.db, *r.viewer, comm.ID, post.ID, req.Title, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+	if err != nil {
+		return err
+	}
+
+	// +1 your own post.
+	crosspost.Vote(r.ctx, s.db, *r.viewer, true, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+	return w.writeJSON(crosspost)
+}
+
+// /api/posts/:postID/revisions [GET]
+func (s *Server) getPostRevisions(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	post, err := core.GetPost(r.ctx, s.db, nil, r.muxVar("postID"), r.viewer, true)
+	if err != nil {
+		return err
+	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+
+	revs, err := post.GetRevisions(r.ctx, s.db, *r.viewer)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSON(struct {
+		Revisions []*core.PostRevision `json:"revisions"`
+		Diffs     []*core.RevisionDiff `json:"diffs"`
+	}{revs, core.PostRevisionsDiffs(revs)})
+}
+
 // /api/posts/:postID [PUT]
 func (s *Server) updatePost(w *responseWriter, r *request) error {
 	postID := r.muxVar("postID") // public post id
@@ -151,6 +287,9 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	query := r.urlQueryParams()
 	action := query.Get("action")
@@ -165,7 +304,7 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 
 		// override updatable fields
 		needSaving := false
-		if post.Type == core.PostTypeText && !post.DeletedContent {
+		if (post.Type == core.PostTypeText || post.Type == core.PostTypePoll) && !post.DeletedContent {
 			if post.Body != tpost.Body {
 				needSaving = true
 				post.Body = tpost.Body
@@ -213,6 +352,19 @@ func (s *Server) updatePost(w *responseWriter, r *request) error {
 			if err := post.AnnounceToAllUsers(r.ctx, s.db, *r.viewer); err != nil {
 				return err
 			}
+		case "changeFlair":
+			// An empty flairId removes the flair.
+			var flairID *int
+			if text := query.Get("flairId"); text != "" {
+				id, err := strconv.Atoi(text)
+				if err != nil {
+					return httperr.NewBadRequest("invalid_flair_id", "Invalid flair ID.")
+				}
+				flairID = &id
+			}
+			if err = post.SetFlair(r.ctx, s.db, *r.viewer, flairID); err != nil {
+				return err
+			}
 		default:
 			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 		}
@@ -236,6 +388,9 @@ func (s *Server) deletePost(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 	query := r.urlQueryParams()
 
 	var as core.UserGroup
@@ -279,6 +434,9 @@ func (s *Server) postVote(w *responseWriter, r *request) error {
 	if err != nil {
 		return err
 	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
 
 	if post.ViewerVoted.Bool {
 		if req.Up == post.ViewerVotedUp.Bool {
@@ -296,6 +454,38 @@ func (s *Server) postVote(w *responseWriter, r *request) error {
 	return w.writeJSON(post)
 }
 
+// /api/_pollVote [POST]
+func (s *Server) pollVote(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	if err := s.rateLimitVoting(r, *r.viewer); err != nil {
+		return err
+	}
+
+	req := struct {
+		PostID  uid.ID `json:"postId"`
+		Options []int  `json:"options"`
+	}{}
+	if err := r.unmarshalJSONBody(&req); err != nil {
+		return err
+	}
+
+	post, err := core.GetPost(r.ctx, s.db, &req.PostID, "", r.viewer, false)
+	if err != nil {
+		return err
+	}
+	if err := post.CheckViewable(r.ctx, s.db, r.viewer); err != nil {
+		return err
+	}
+	if err := post.VotePoll(r.ctx, s.db, *r.viewer, req.Options); err != nil {
+		return err
+	}
+
+	return w.writeJSON(post)
+}
+
 // /api/_uploads [ POST ]
 func (s *Server) imageUpload(w *responseWriter, r *request) error {
 	if s.config.DisableImagePosts {
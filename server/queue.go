@@ -0,0 +1,105 @@
+package server
+
+import (
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+// /api/communities/{communityID}/queue [GET, POST]
+//
+// A GET request returns the posts (or, with the query parameter type=comments,
+// the comments) of the community that are held for approval, oldest first. A
+// POST request, with body {"type": "post" | "comment", "id": "...", "action":
+// "approve" | "reject"}, approves or rejects a post or a comment.
+func (s *Server) handleCommunityQueue(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "POST" {
+		body := struct {
+			Type   core.ContentType `json:"type"`
+			ID     uid.ID           `json:"id"`
+			Action string           `json:"action"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if !(body.Action == "approve" || body.Action == "reject") {
+			return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+		}
+
+		switch body.Type {
+		case core.ContentTypePost:
+			post, err := core.GetPost(r.ctx, s.db, &body.ID, "", r.viewer, true)
+			if err != nil {
+				return err
+			}
+			if post.CommunityID != comm.ID {
+				return httperr.NewNotFound("post/not-found", "Post not found.")
+			}
+			if body.Action == "approve" {
+				err = post.Approve(r.ctx, s.db, *r.viewer)
+			} else {
+				err = post.Reject(r.ctx, s.db, *r.viewer)
+			}
+			if err != nil {
+				return err
+			}
+			return w.writeJSON(post)
+		case core.ContentTypeComment:
+			comment, err := core.GetComment(r.ctx, s.db, body.ID, r.viewer)
+			if err != nil {
+				return err
+			}
+			if comment.CommunityID != comm.ID {
+				return httperr.NewNotFound("comment/not-found", "Comment not found.")
+			}
+			if body.Action == "approve" {
+				err = comment.Approve(r.ctx, s.db, *r.viewer)
+			} else {
+				err = comment.Reject(r.ctx, s.db, *r.viewer)
+			}
+			if err != nil {
+				return err
+			}
+			return w.writeJSON(comment)
+		}
+		return httperr.NewBadRequest("invalid_type", "Invalid content type.")
+	}
+
+	query := r.urlQueryParams()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var nextPtr *string
+	if next := query.Get("next"); next != "" {
+		nextPtr = &next
+	}
+
+	res := struct {
+		Posts              []*core.Post    `json:"posts"`
+		Comments           []*core.Comment `json:"comments"`
+		Next               *string         `json:"next"`
+		NumPendingPosts    int             `json:"noPendingPosts"`
+		NumPendingComments int             `json:"noPendingComments"`
+	}{}
+	switch query.Get("type") {
+	case "", "posts":
+		res.Posts, res.Next, err = core.GetPendingPosts(r.ctx, s.db, comm.ID, *r.viewer, limit, nextPtr)
+	case "comments":
+		res.Comments, res.Next, err = core.GetPendingComments(r.ctx, s.db, comm.ID, *r.viewer, limit, nextPtr)
+	default:
+		return httperr.NewBadRequest("invalid_type", "Invalid content type.")
+	}
+	if err != nil {
+		return err
+	}
+	if res.NumPendingPosts, res.NumPendingComments, err = core.NumPending(r.ctx, s.db, comm.ID); err != nil {
+		return err
+	}
+	return w.writeJSON(res)
+}
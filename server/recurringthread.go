@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// /api/communities/{communityID}/recurring_threads [GET, POST]
+func (s *Server) handleCommunityRecurringThreads(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		threads, err := core.GetRecurringThreads(r.ctx, s.db, comm.ID)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(threads)
+	}
+
+	opts := &core.RecurringThreadOpts{}
+	if err := r.unmarshalJSONBody(opts); err != nil {
+		return err
+	}
+	thread, err := comm.CreateRecurringThread(r.ctx, s.db, *r.viewer, opts)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return w.writeJSON(thread)
+}
+
+// /api/communities/{communityID}/recurring_threads/{threadID} [GET, PUT, DELETE]
+func (s *Server) handleCommunityRecurringThread(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(r.muxVar("threadID"))
+	if err != nil {
+		return httperr.NewBadRequest("invalid_thread_id", "Invalid recurring thread ID.")
+	}
+	thread, err := core.GetRecurringThread(r.ctx, s.db, comm.ID, id)
+	if err != nil {
+		return err
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		opts := &core.RecurringThreadOpts{}
+		if err := r.unmarshalJSONBody(opts); err != nil {
+			return err
+		}
+		if err := thread.Update(r.ctx, s.db, opts); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := thread.Delete(r.ctx, s.db); err != nil {
+			return err
+		}
+	}
+	return w.writeJSON(thread)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	msql "github.com/discuitnet/discuit/internal/sql"
+)
+
+// /api/scheduled_posts [GET]
+//
+// Returns the logged in user's posts that are yet to be published (or that
+// failed to be published). Posts are scheduled with a POST request to
+// /api/posts with the publishAt field set.
+func (s *Server) getScheduledPosts(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+	posts, err := core.GetScheduledPosts(r.ctx, s.db, *r.viewer)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(posts)
+}
+
+// /api/scheduled_posts/{scheduledPostID} [GET, PUT, DELETE]
+//
+// A PUT request updates the title, the body, and the publish time of the post.
+// A DELETE request cancels the post.
+func (s *Server) handleScheduledPost(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	id, err := strToID(r.muxVar("scheduledPostID"))
+	if err != nil {
+		return err
+	}
+	post, err := core.GetScheduledPost(r.ctx, s.db, id)
+	if err != nil {
+		return err
+	}
+	if post.AuthorID != *r.viewer {
+		return core.ErrScheduledPostNotFound
+	}
+
+	switch r.req.Method {
+	case "PUT":
+		body := struct {
+			Title     *string    `json:"title"`
+			Body      *string    `json:"body"`
+			PublishAt *time.Time `json:"publishAt"`
+		}{}
+		if err := r.unmarshalJSONBody(&body); err != nil {
+			return err
+		}
+		if body.Title != nil {
+			post.Title = *body.Title
+		}
+		if body.Body != nil && (post.Type == core.PostTypeText || post.Type == core.PostTypePoll) {
+			post.Body = msql.NewNullString(*body.Body)
+		}
+		if body.PublishAt != nil {
+			post.PublishAt = *body.PublishAt
+		}
+		if err := post.Update(r.ctx, s.db); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := post.Delete(r.ctx, s.db); err != nil {
+			return err
+		}
+	}
+	return w.writeJSON(post)
+}
+
+// PublishScheduledPosts publishes the scheduled posts that are due. It returns
+// the number of posts published.
+func (s *Server) PublishScheduledPosts(ctx context.Context) (int, error) {
+	posts, err := core.GetDueScheduledPosts(ctx, s.db, 100)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, sp := range posts {
+		post, err := sp.Publish(ctx, s.db, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+		if err != nil {
+			// The error is recorded on the scheduled post; carry on with the
+			// rest.
+			log.Printf("Error publishing scheduled post %v: %v\n", sp.ID, err)
+			continue
+		}
+		// +1 your own post.
+		post.Vote(ctx, s.db, sp.AuthorID, true, s.config.NewUserPointsThreshold, time.Second*time.Duration(s.config.NewUserAgeThreshold))
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/httputil"
+)
+
+// parseSearchTime parses an RFC 3339 formatted time (or a date of the form
+// 2006-01-02).
+func parseSearchTime(s string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, s); err != nil {
+			return nil, httperr.NewBadRequest("invalid-date", "Invalid date (expected RFC 3339 or YYYY-MM-DD).")
+		}
+	}
+	return &t, nil
+}
+
+// /api/search [GET]
+func (s *Server) search(w *responseWriter, r *request) error {
+	bucket := "search_" + httputil.GetIP(r.req)
+	if r.loggedIn {
+		bucket = "search_" + r.viewer.String()
+	}
+	if err := s.rateLimit(r, bucket, time.Second, 2); err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	opts := &core.SearchOptions{
+		Query:  query.Get("q"),
+		Type:   core.SearchType(r.urlQueryParamsValueString("type", string(core.SearchTypePosts))),
+		Sort:   core.FeedSortLatest,
+		Viewer: r.viewer,
+		Next:   query.Get("next"),
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if err := opts.Sort.UnmarshalText([]byte(sort)); err != nil {
+			return core.ErrInvalidSearchSort
+		}
+	}
+
+	var err error
+	if opts.Limit, err = getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax); err != nil {
+		return err
+	}
+
+	if communityID := query.Get("communityId"); communityID != "" {
+		cid, err := strToID(communityID)
+		if err != nil {
+			return err
+		}
+		opts.Community = &cid
+	}
+	if username := query.Get("author"); username != "" {
+		author, err := core.GetUserByUsername(r.ctx, s.db, username, nil)
+		if err != nil {
+			return err
+		}
+		opts.Author = &author.ID
+	}
+	if postType := query.Get("postType"); postType != "" {
+		opts.PostType = new(core.PostType)
+		if err := opts.PostType.UnmarshalText([]byte(postType)); err != nil {
+			return httperr.NewBadRequest("invalid-post-type", "Invalid post type.")
+		}
+	}
+	if from := query.Get("from"); from != "" {
+		if opts.From, err = parseSearchTime(from); err != nil {
+			return err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if opts.To, err = parseSearchTime(to); err != nil {
+			return err
+		}
+	}
+
+	set, err := core.Search(r.ctx, s.db, opts)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(set)
+}
@@ -25,8 +25,10 @@ import (
 	"github.com/discuitnet/discuit/internal/httperr"
 	"github.com/discuitnet/discuit/internal/httputil"
 	"github.com/discuitnet/discuit/internal/images"
+	"github.com/discuitnet/discuit/internal/mailer"
 	"github.com/discuitnet/discuit/internal/ratelimits"
 	"github.com/discuitnet/discuit/internal/sessions"
+	msql "github.com/discuitnet/discuit/internal/sql"
 	"github.com/discuitnet/discuit/internal/uid"
 	"github.com/discuitnet/discuit/internal/utils"
 	"github.com/gomodule/redigo/redis"
@@ -71,6 +73,8 @@ type Server struct {
 	http500LoggerFile *os.File
 
 	webPushVAPIDKeys core.VAPIDKeys
+
+	mailer mailer.Mailer // Nil if emails are disabled.
 }
 
 func New(db *sql.DB, conf *config.Config) (*Server, error) {
@@ -105,6 +109,21 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 		core.EnablePushNotifications(keys, conf.WebPushSubscriberEmail)
 	}
 
+	if conf.SMTPAddr != "" {
+		s.mailer = &mailer.SMTP{
+			Addr:     conf.SMTPAddr,
+			Username: conf.SMTPUsername,
+			Password: conf.SMTPPassword,
+			From:     conf.MailFrom,
+		}
+	} else if conf.IsDevelopment {
+		s.mailer = &mailer.File{Dir: conf.MailDir, From: conf.MailFrom}
+	} else {
+		// Emails are never written to disk in production, since they contain
+		// password reset links.
+		log.Println("Config.SMTPAddr is empty; email features are disabled.")
+	}
+
 	s.openLoggers()
 
 	// API routes.
@@ -112,6 +131,12 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/_login", s.withHandler(s.login)).Methods("POST")
 	r.Handle("/api/_signup", s.withHandler(s.signup)).Methods("POST")
 	r.Handle("/api/_user", s.withHandler(s.getLoggedInUser)).Methods("GET")
+	r.Handle("/api/_confirm_email", s.withHandler(s.confirmEmail)).Methods("POST")
+	r.Handle("/api/_forgot_password", s.withHandler(s.forgotPassword)).Methods("POST")
+	r.Handle("/api/_reset_password", s.withHandler(s.resetPassword)).Methods("POST")
+	r.Handle("/api/_two_factor", s.withHandler(s.handleTwoFactor)).Methods("GET", "POST")
+	r.Handle("/api/_sessions", s.withHandler(s.handleSessions)).Methods("GET", "DELETE")
+	r.Handle("/api/_sessions/{sessionID}", s.withHandler(s.deleteSession)).Methods("DELETE")
 
 	r.Handle("/api/users/{username}", s.withHandler(s.getUser)).Methods("GET")
 	r.Handle("/api/users/{username}", s.withHandler(s.deleteUser)).Methods("DELETE")
@@ -130,6 +155,10 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/lists/{listId}/items", s.withHandler(s.withListByID(s.handleListItems))).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/lists/{listId}/items/{itemId}", s.withHandler(s.withListByID(s.deleteListItem))).Methods("DELETE")
 
+	r.Handle("/api/users/{username}/custom_feeds", s.withHandler(s.handleCustomFeeds)).Methods("GET", "POST")
+	r.Handle("/api/custom_feeds/{feedID}", s.withHandler(s.handleCustomFeed)).Methods("GET", "PUT", "DELETE")
+	r.Handle("/api/custom_feeds/{feedID}/communities", s.withHandler(s.handleCustomFeedCommunities)).Methods("POST", "DELETE")
+
 	r.Handle("/api/mutes", s.withHandler(s.handleMutes)).Methods("GET", "POST", "DELETE")
 	r.Handle("/api/mutes/users/{mutedUserID}", s.withHandler(s.deleteUserMute)).Methods("DELETE")
 	r.Handle("/api/mutes/communities/{mutedCommunityID}", s.withHandler(s.deleteCommunityMute)).Methods("DELETE")
@@ -140,7 +169,10 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/posts/{postID}", s.withHandler(s.getPost)).Methods("GET")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.updatePost)).Methods("PUT")
 	r.Handle("/api/posts/{postID}", s.withHandler(s.deletePost)).Methods("DELETE")
+	r.Handle("/api/posts/{postID}/revisions", s.withHandler(s.getPostRevisions)).Methods("GET")
+	r.Handle("/api/posts/{postID}/crossposts", s.withHandler(s.handlePostCrossposts)).Methods("GET", "POST")
 	r.Handle("/api/_postVote", s.withHandler(s.postVote)).Methods("POST")
+	r.Handle("/api/_pollVote", s.withHandler(s.pollVote)).Methods("POST")
 	r.Handle("/api/_uploads", s.withHandler(s.imageUpload)).Methods("POST")
 	r.Handle("/api/images/{imageID}", s.withHandler(s.updateImage)).Methods("PUT")
 
@@ -149,6 +181,7 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/posts/{postID}/comments/{commentID}", s.withHandler(s.updateComment)).Methods("PUT")
 	r.Handle("/api/posts/{postID}/comments/{commentID}", s.withHandler(s.deleteComment)).Methods("DELETE")
 	r.Handle("/api/comments/{commentID}", s.withHandler(s.getComment)).Methods("GET")
+	r.Handle("/api/comments/{commentID}/revisions", s.withHandler(s.getCommentRevisions)).Methods("GET")
 	r.Handle("/api/_commentVote", s.withHandler(s.commentVote)).Methods("POST")
 
 	r.Handle("/api/communities", s.withHandler(s.getCommunities)).Methods("GET")
@@ -163,12 +196,33 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.updateCommunityRule)).Methods("PUT")
 	r.Handle("/api/communities/{communityID}/rules/{ruleID}", s.withHandler(s.deleteCommunityRule)).Methods("DELETE")
 
+	r.Handle("/api/communities/{communityID}/flairs", s.withHandler(s.handleCommunityFlairs)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/flairs/{flairID}", s.withHandler(s.handleCommunityFlair)).Methods("PUT", "DELETE")
+
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.getCommunityMods)).Methods("GET")
 	r.Handle("/api/communities/{communityID}/mods", s.withHandler(s.addCommunityMod)).Methods("POST")
 	r.Handle("/api/communities/{communityID}/mods/{mod}", s.withHandler(s.removeCommunityMod)).Methods("DELETE")
 
 	r.Handle("/api/communities/{communityID}/reports", s.withHandler(s.getCommunityReports)).Methods("GET")
+	r.Handle("/api/communities/{communityID}/reports/{reportID}", s.withHandler(s.resolveReport)).Methods("PUT")
+	r.Handle("/api/communities/{communityID}/reports/{reportID}", s.withHandler(s.actOnReport)).Methods("POST")
 	r.Handle("/api/communities/{communityID}/reports/{reportID}", s.withHandler(s.deleteReport)).Methods("DELETE")
+	r.Handle("/api/communities/{communityID}/modlog", s.withHandler(s.getCommunityModLog)).Methods("GET")
+
+	r.Handle("/api/communities/{communityID}/webhooks", s.withHandler(s.handleCommunityWebhooks)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/webhooks/{webhookID}", s.withHandler(s.deleteCommunityWebhook)).Methods("DELETE")
+	r.Handle("/api/communities/{communityID}/webhooks/{webhookID}/deliveries", s.withHandler(s.getWebhookDeliveries)).Methods("GET")
+
+	r.Handle("/api/communities/{communityID}/modmail", s.withHandler(s.getCommunityModmail)).Methods("GET")
+	r.Handle("/api/communities/{communityID}/modmail/{threadID}", s.withHandler(s.handleCommunityModmailThread)).Methods("GET", "POST", "PUT")
+
+	r.Handle("/api/communities/{communityID}/recurring_threads", s.withHandler(s.handleCommunityRecurringThreads)).Methods("GET", "POST")
+	r.Handle("/api/communities/{communityID}/recurring_threads/{threadID}", s.withHandler(s.handleCommunityRecurringThread)).Methods("GET", "PUT", "DELETE")
+
+	r.Handle("/api/communities/{communityID}/automod", s.withHandler(s.handleCommunityAutomod)).Methods("GET", "PUT")
+	r.Handle("/api/communities/{communityID}/automod/test", s.withHandler(s.testCommunityAutomod)).Methods("POST")
+
+	r.Handle("/api/communities/{communityID}/queue", s.withHandler(s.handleCommunityQueue)).Methods("GET", "POST")
 
 	r.Handle("/api/communities/{communityID}/banned", s.withHandler(s.handleCommunityBanned)).Methods("GET", "POST", "DELETE")
 
@@ -180,6 +234,18 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/notifications/{notificationID}", s.withHandler(s.getNotification)).Methods("GET", "PUT")
 	r.Handle("/api/notifications/{notificationID}", s.withHandler(s.deleteNotification)).Methods("DELETE")
 
+	r.Handle("/api/conversations", s.withHandler(s.handleConversations)).Methods("GET", "POST")
+	r.Handle("/api/conversations/{conversationID}", s.withHandler(s.handleConversation)).Methods("GET", "PUT")
+	r.Handle("/api/conversations/{conversationID}/messages", s.withHandler(s.handleConversationMessages)).Methods("GET", "POST")
+	r.Handle("/api/messages/{messageID}", s.withHandler(s.deleteMessage)).Methods("DELETE")
+	r.Handle("/api/messages/{messageID}/reports", s.withHandler(s.reportMessage)).Methods("POST")
+
+	r.Handle("/api/modmail", s.withHandler(s.handleModmail)).Methods("GET", "POST")
+	r.Handle("/api/modmail/{threadID}", s.withHandler(s.handleModmailThread)).Methods("GET", "POST")
+
+	r.Handle("/api/scheduled_posts", s.withHandler(s.getScheduledPosts)).Methods("GET")
+	r.Handle("/api/scheduled_posts/{scheduledPostID}", s.withHandler(s.handleScheduledPost)).Methods("GET", "PUT", "DELETE")
+
 	r.Handle("/api/push_subscriptions", s.withHandler(s.pushSubscriptions)).Methods("POST")
 
 	r.Handle("/api/community_requests", s.withHandler(s.createCommunityRequest)).Methods("POST")
@@ -189,13 +255,20 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 	r.Handle("/api/_report", s.withHandler(s.report)).Methods("POST")
 
 	r.Handle("/api/_settings", s.withHandler(s.updateUserSettings)).Methods("POST")
+	r.Handle("/api/api_tokens", s.withHandler(s.handleAPITokens)).Methods("GET", "POST")
+	r.Handle("/api/api_tokens/{tokenID}", s.withHandler(s.deleteAPIToken)).Methods("DELETE")
 
 	r.Handle("/api/_admin", s.withHandler(s.adminActions)).Methods("POST")
 	r.Handle("/api/users", s.withHandler(s.getUsers)).Methods("GET")
 	r.Handle("/api/comments", s.withHandler(s.getComments)).Methods("GET")
+	r.Handle("/api/message_reports", s.withHandler(s.getMessageReports)).Methods("GET")
+	r.Handle("/api/message_reports/{reportID}", s.withHandler(s.resolveMessageReport)).Methods("PUT")
 
 	r.Handle("/api/_link_info", s.withHandler(s.getLinkInfo)).Methods("GET")
 
+	r.Handle("/api/search", s.withHandler(s.search)).Methods("GET")
+	r.Handle("/api/modlog", s.withHandler(s.getModLog)).Methods("GET")
+
 	r.Handle("/api/analytics", s.withHandler(s.handleAnalytics)).Methods("POST")
 	r.Handle("/api/analytics/bss", s.withHandler(s.getBasicSiteStats)).Methods("GET")
 	r.Handle("/api/site_settings", s.withHandler(s.handleSiteSettings)).Methods("GET", "PUT")
@@ -213,6 +286,10 @@ func New(db *sql.DB, conf *config.Config) (*Server, error) {
 		EnableCORS:    true,
 	})
 
+	s.staticRouter.HandleFunc("/feed.{format:rss|atom}", s.serveSiteSyndicationFeed).Methods("GET")
+	s.staticRouter.HandleFunc("/c/{communityName}.{format:rss|atom}", s.serveCommunitySyndicationFeed).Methods("GET")
+	s.staticRouter.HandleFunc("/@{username}.{format:rss|atom}", s.serveUserSyndicationFeed).Methods("GET")
+
 	if conf.UIProxy != "" {
 		s.staticRouter.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ses, err := s.sessions.Get(r)
@@ -292,6 +369,7 @@ func updateUserLastSeen(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 	update := func() error {
 		ses.Values["last_seen"] = time.Now().Unix()
+		ses.Values["ip"] = httputil.GetIP(r)
 		if err := ses.Save(w, r); err != nil {
 			return err
 		}
@@ -315,6 +393,11 @@ func updateUserLastSeen(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 func (s *Server) withHandler(h handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			s.serveWithAPIToken(w, r, h, token)
+			return
+		}
+
 		ses, err := s.sessions.Get(r)
 		if err != nil {
 			s.writeError(w, r, err)
@@ -338,7 +421,13 @@ func (s *Server) withHandler(h handler) http.Handler {
 			}
 		}
 
-		if err = h(&responseWriter{w: w}, newRequest(r, ses)); err != nil {
+		req := newRequest(r, ses)
+		if err := s.checkTwoFactorPolicy(w, req); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		if err = h(&responseWriter{w: w}, req); err != nil {
 			s.writeError(w, r, err)
 			return
 		}
@@ -815,7 +904,7 @@ func (s *Server) insertMetaTags(doc *html.Node, r *http.Request) {
 	} else if len(list) == 3 && list[1] == "post" {
 		// post page
 		post, err := core.GetPost(ctx, s.db, nil, list[2], nil, true)
-		if err == nil {
+		if err == nil && !post.Pending {
 			appendTitle(post.Title, "")
 			sep := " • "
 			upVotes := strconv.Itoa(post.Upvotes) + " upvote"
@@ -996,7 +1085,15 @@ func userSessionsSetRedisKey(username string) string {
 // loginUser persists the authenticated user onto the session.
 func (s *Server) loginUser(u *core.User, ses *sessions.Session, w http.ResponseWriter, r *http.Request) error {
 	if u.Banned {
-		return httperr.NewForbidden("account_suspended", "User account suspended.")
+		return &httperr.Error{
+			HTTPStatus: http.StatusForbidden,
+			Code:       "account_suspended",
+			Message:    "User account suspended.",
+			Details: struct {
+				Reason      msql.NullString `json:"reason"`
+				BannedUntil msql.NullTime   `json:"bannedUntil"`
+			}{u.BanReason, u.BannedUntil},
+		}
 	}
 
 	conn := s.redisPool.Get()
@@ -1007,6 +1104,7 @@ func (s *Server) loginUser(u *core.User, ses *sessions.Session, w http.ResponseW
 	}
 
 	ses.Values["uid"] = u.ID.String()
+	setSessionMetadata(ses, r)
 	return ses.Save(w, r)
 }
 
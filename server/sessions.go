@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/httputil"
+	"github.com/discuitnet/discuit/internal/sessions"
+	"github.com/discuitnet/discuit/internal/utils"
+	"github.com/gomodule/redigo/redis"
+)
+
+const maxSessionUserAgentLength = 512
+
+var errSessionNotFound = httperr.NewNotFound("session-not-found", "Session not found.")
+
+// activeSession is a logged in session of a user, as shown to the user.
+type activeSession struct {
+	// ID is derived from, but is not, the session ID (which is the value of the
+	// session cookie, and so is never exposed).
+	ID        string     `json:"id"`
+	CreatedAt *time.Time `json:"createdAt"` // Null for sessions created before this was recorded.
+	LastSeen  *time.Time `json:"lastSeen"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"userAgent"`
+	Current   bool       `json:"current"`
+
+	sessionID string
+}
+
+// publicSessionID returns the ID of the session, with ID sessionID, that is
+// safe to show to the user.
+func publicSessionID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// setSessionMetadata records the creation time, the IP address, and the user
+// agent of r in the session (to be saved along with it).
+func setSessionMetadata(ses *sessions.Session, r *http.Request) {
+	ses.Values["created_at"] = time.Now().Unix()
+	ses.Values["ip"] = httputil.GetIP(r)
+	ses.Values["user_agent"] = utils.TruncateUnicodeString(r.UserAgent(), maxSessionUserAgentLength)
+}
+
+// sessionTime parses the unix timestamp in session values under key.
+func sessionTime(values map[string]any, key string) *time.Time {
+	ts, ok := values[key].(float64)
+	if !ok {
+		return nil
+	}
+	t := time.Unix(int64(ts), 0)
+	return &t
+}
+
+// getActiveSessions returns all the logged in sessions of user, latest seen
+// first. The session with ID current is marked as such.
+func (s *Server) getActiveSessions(user *core.User, current string) ([]*activeSession, error) {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	setKey := userSessionsSetRedisKey(user.UsernameLowerCase)
+	sessionIDs, err := redis.Strings(conn.Do("SMEMBERS", setKey))
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*activeSession{}
+	for _, id := range sessionIDs {
+		data, err := redis.String(conn.Do("GET", s.sessions.RedisKey(id)))
+		if err != nil {
+			if err == redis.ErrNil {
+				// The session expired.
+				if _, err := conn.Do("SREM", setKey, id); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		values := make(map[string]any)
+		if err := json.Unmarshal([]byte(data), &values); err != nil {
+			return nil, err
+		}
+		if uid, _ := values["uid"].(string); uid != user.ID.String() {
+			continue // Logged out.
+		}
+		ses := &activeSession{
+			ID:        publicSessionID(id),
+			CreatedAt: sessionTime(values, "created_at"),
+			LastSeen:  sessionTime(values, "last_seen"),
+			Current:   id == current,
+			sessionID: id,
+		}
+		ses.IP, _ = values["ip"].(string)
+		ses.UserAgent, _ = values["user_agent"].(string)
+		list = append(list, ses)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LastSeen == nil || list[j].LastSeen == nil {
+			return list[j].LastSeen == nil && list[i].LastSeen != nil
+		}
+		return list[i].LastSeen.After(*list[j].LastSeen)
+	})
+	return list, nil
+}
+
+// revokeSession logs out the session with ID sessionID of user.
+func (s *Server) revokeSession(r *request, user *core.User, sessionID string) error {
+	if err := core.DeleteWebPushSubscription(r.ctx, s.db, sessionID); err != nil {
+		return err
+	}
+
+	conn := s.redisPool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", s.sessions.RedisKey(sessionID)); err != nil {
+		return err
+	}
+	_, err := conn.Do("SREM", userSessionsSetRedisKey(user.UsernameLowerCase), sessionID)
+	return err
+}
+
+// revokeOtherSessions logs out all sessions of user except the session of r.
+func (s *Server) revokeOtherSessions(r *request, user *core.User) error {
+	list, err := s.getActiveSessions(user, r.ses.ID)
+	if err != nil {
+		return err
+	}
+	for _, ses := range list {
+		if !ses.Current {
+			if err := s.revokeSession(r, user, ses.sessionID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// /api/_sessions [GET, DELETE]
+//
+// A DELETE request logs out all sessions except the current one.
+func (s *Server) handleSessions(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "DELETE" {
+		if err := s.revokeOtherSessions(r, user); err != nil {
+			return err
+		}
+	}
+
+	list, err := s.getActiveSessions(user, r.ses.ID)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(list)
+}
+
+// /api/_sessions/{sessionID} [DELETE]
+func (s *Server) deleteSession(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+	if err != nil {
+		return err
+	}
+
+	list, err := s.getActiveSessions(user, r.ses.ID)
+	if err != nil {
+		return err
+	}
+	id := r.muxVar("sessionID")
+	for _, ses := range list {
+		if ses.ID == id {
+			if ses.Current {
+				err = s.logoutUser(user, r.ses, w, r.req)
+			} else {
+				err = s.revokeSession(r, user, ses.sessionID)
+			}
+			if err != nil {
+				return err
+			}
+			w.writeString(`{"success": true}`)
+			return nil
+		}
+	}
+	return errSessionNotFound
+}
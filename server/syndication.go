@@ -0,0 +1,493 @@
+package server
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/images"
+	"github.com/discuitnet/discuit/internal/uid"
+	"github.com/gorilla/mux"
+	"github.com/russross/blackfriday/v2"
+)
+
+// syndicationItem is a single entry of an RSS or an Atom feed.
+type syndicationItem struct {
+	ID        string // A permanent, unique URL.
+	Title     string
+	Link      string
+	Comments  string // Empty unless Link points to an external page.
+	Author    string
+	Content   string // HTML.
+	Published time.Time
+	Updated   time.Time
+}
+
+// syndicationFeed is an RSS or an Atom feed, before it is encoded.
+type syndicationFeed struct {
+	Title       string
+	Description string
+	Link        string // The HTML page of the feed.
+	Self        string // The URL of the feed itself.
+	Items       []*syndicationItem
+}
+
+// updated returns the time of the most recent update to any item of f.
+func (f *syndicationFeed) updated() time.Time {
+	var t time.Time
+	for _, item := range f.Items {
+		if item.Updated.After(t) {
+			t = item.Updated
+		}
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      rssLink   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Comments    string  `xml:"comments,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f *syndicationFeed) rss() *rssFeed {
+	feed := &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			AtomLink:      rssLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			LastBuildDate: f.updated().UTC().Format(time.RFC1123Z),
+			Items:         []rssItem{},
+		},
+	}
+	for _, item := range f.Items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Comments:    item.Comments,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.ID},
+			Creator:     item.Author,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Description: item.Content,
+		})
+	}
+	return feed
+}
+
+func (f *syndicationFeed) atom() *atomFeed {
+	feed := &atomFeed{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Self,
+		Updated:  f.updated().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Self, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []atomEntry{},
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.ID,
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Href: item.Link, Rel: "alternate"}},
+			Content:   atomContent{Type: "html", Body: item.Content},
+		}
+		if item.Comments != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.Comments, Rel: "replies", Type: "text/html"})
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// syndicationBaseURL returns the base of the (absolute) links in the
+// syndication feeds. The links are never derived from the request, since its
+// Host header cannot be trusted and the feeds are publicly cacheable. So the
+// feeds are not served if the site URL is not configured.
+func (s *Server) syndicationBaseURL() (string, error) {
+	base := s.siteURL()
+	if base == "" {
+		return "", httperr.NewNotFound("syndication_disabled", "Syndication feeds are not enabled on this site.")
+	}
+	return base, nil
+}
+
+// absoluteURL prefixes path with base, if path is not already an absolute URL.
+func absoluteURL(base, path string) string {
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") {
+		return base + path
+	}
+	return path
+}
+
+// feedMarkdownRenderer renders markdown into HTML the way the UI does (see
+// ui/src/components/MarkdownBody.jsx): raw HTML is skipped, links open in a new
+// tab with rel="nofollow noreferrer", and images are shown as links. Relative
+// URLs are made absolute with base.
+type feedMarkdownRenderer struct {
+	*blackfriday.HTMLRenderer
+}
+
+func newFeedMarkdownRenderer(base string) *feedMarkdownRenderer {
+	return &feedMarkdownRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			AbsolutePrefix: base,
+			Flags: blackfriday.SkipHTML | blackfriday.Safelink | blackfriday.NofollowLinks |
+				blackfriday.NoreferrerLinks | blackfriday.HrefTargetBlank,
+		}),
+	}
+}
+
+func (r *feedMarkdownRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.Image {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	if entering {
+		dest := html.EscapeString(absoluteURL(r.AbsolutePrefix, string(node.LinkData.Destination)))
+		if u, err := url.Parse(string(node.LinkData.Destination)); err == nil && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https") {
+			io.WriteString(w, `<a href="`+dest+`" target="_blank" rel="nofollow noreferrer">`+dest+`</a>`)
+		} else {
+			io.WriteString(w, dest)
+		}
+	}
+	return blackfriday.SkipChildren
+}
+
+// renderFeedText converts markdown text into HTML. Relative URLs in text are
+// made absolute with base.
+func renderFeedText(base, text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return string(blackfriday.Run([]byte(text),
+		blackfriday.WithExtensions(blackfriday.CommonExtensions),
+		blackfriday.WithRenderer(newFeedMarkdownRenderer(base))))
+}
+
+// renderFeedImage returns an img tag for image, or an empty string if image
+// has no URL.
+func renderFeedImage(base string, image *images.Image) string {
+	if image == nil {
+		return ""
+	}
+	image.SetURL()
+	if image.URL == nil {
+		return ""
+	}
+	src := absoluteURL(base, *image.URL)
+	alt := ""
+	if image.AltText != nil {
+		alt = *image.AltText
+	}
+	return `<p><img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt) + `"></p>`
+}
+
+func postSyndicationItem(base string, post *core.Post) *syndicationItem {
+	postURL := base + "/" + url.PathEscape(post.CommunityName) + "/post/" + post.PublicID
+	item := &syndicationItem{
+		ID:        postURL,
+		Title:     post.Title,
+		Link:      postURL,
+		Author:    "@" + post.AuthorUsername,
+		Published: post.CreatedAt,
+		Updated:   post.CreatedAt,
+	}
+	if post.EditedAt.Valid {
+		item.Updated = post.EditedAt.Time
+	}
+
+	var content strings.Builder
+	switch post.Type {
+	case core.PostTypeLink:
+		if post.Link != nil {
+			item.Link = post.Link.URL
+			item.Comments = postURL
+			content.WriteString(`<p><a href="` + html.EscapeString(post.Link.URL) + `">` + html.EscapeString(post.Link.Hostname) + `</a></p>`)
+			if post.Link.Image != nil {
+				content.WriteString(renderFeedImage(base, post.Link.Image))
+			}
+		}
+	case core.PostTypeImage:
+		if len(post.Images) > 0 {
+			for _, image := range post.Images {
+				content.WriteString(renderFeedImage(base, image))
+			}
+		} else {
+			content.WriteString(renderFeedImage(base, post.Image))
+		}
+	case core.PostTypePoll:
+		if post.Poll != nil {
+			content.WriteString("<ul>")
+			for _, option := range post.Poll.Options {
+				content.WriteString("<li>" + html.EscapeString(option.Text) + "</li>")
+			}
+			content.WriteString("</ul>")
+		}
+	}
+	if post.Body.Valid {
+		content.WriteString(renderFeedText(base, post.Body.String))
+	}
+	if item.Comments != "" {
+		content.WriteString(`<p><a href="` + html.EscapeString(postURL) + `">Comments</a></p>`)
+	}
+	item.Content = content.String()
+	return item
+}
+
+func commentSyndicationItem(base string, comment *core.Comment) *syndicationItem {
+	commentURL := base + "/" + url.PathEscape(comment.CommunityName) + "/post/" + comment.PostPublicID + "/" + comment.ID.String()
+	item := &syndicationItem{
+		ID:        commentURL,
+		Title:     "Comment on " + comment.PostTitle,
+		Link:      commentURL,
+		Author:    "@" + comment.AuthorUsername,
+		Content:   renderFeedText(base, comment.Body),
+		Published: comment.CreatedAt,
+		Updated:   comment.CreatedAt,
+	}
+	if comment.EditedAt.Valid {
+		item.Updated = comment.EditedAt.Time
+	}
+	return item
+}
+
+// writeSyndicationFeed writes feed to w in the format given by the format
+// route variable (either rss or atom).
+func (s *Server) writeSyndicationFeed(w http.ResponseWriter, r *http.Request, feed *syndicationFeed) {
+	var v any
+	switch mux.Vars(r)["format"] {
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=UTF-8")
+		v = feed.atom()
+	default:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=UTF-8")
+		v = feed.rss()
+	}
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// syndicationPostsFeed returns the posts of the site-wide feed (if community is
+// nil) or of a community, sorted as per the sort query parameter.
+func (s *Server) syndicationPostsFeed(r *http.Request, community *uid.ID) ([]*core.Post, error) {
+	query := r.URL.Query()
+	sort := core.FeedSortLatest
+	if query.Get("sort") != "" {
+		if err := sort.UnmarshalText([]byte(query.Get("sort"))); err != nil {
+			return nil, core.ErrInvalidFeedSort
+		}
+	}
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return nil, err
+	}
+	opts := &core.FeedOptions{
+		Feed:        core.FeedTypeAll,
+		Sort:        sort,
+		DefaultSort: sort == s.config.DefaultFeedSort,
+		Community:   community,
+		Limit:       limit,
+	}
+	if community != nil {
+		opts.Feed = core.FeedTypeCommunity
+	}
+	set, err := core.GetFeed(r.Context(), s.db, opts)
+	if err != nil {
+		return nil, err
+	}
+	return set.Posts, nil
+}
+
+// /feed.rss, /feed.atom [GET]
+func (s *Server) serveSiteSyndicationFeed(w http.ResponseWriter, r *http.Request) {
+	posts, err := s.syndicationPostsFeed(r, nil)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	base, err := s.syndicationBaseURL()
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	feed := &syndicationFeed{
+		Title:       s.config.SiteName,
+		Description: s.config.SiteDescription,
+		Link:        base + "/",
+		Self:        base + r.URL.Path,
+	}
+	for _, post := range posts {
+		feed.Items = append(feed.Items, postSyndicationItem(base, post))
+	}
+	s.writeSyndicationFeed(w, r, feed)
+}
+
+// /c/{communityName}.rss, /c/{communityName}.atom [GET]
+func (s *Server) serveCommunitySyndicationFeed(w http.ResponseWriter, r *http.Request) {
+	community, err := core.GetCommunityByName(r.Context(), s.db, mux.Vars(r)["communityName"], nil)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	posts, err := s.syndicationPostsFeed(r, &community.ID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	base, err := s.syndicationBaseURL()
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	feed := &syndicationFeed{
+		Title:       community.Name + " - " + s.config.SiteName,
+		Description: community.About.String,
+		Link:        base + "/" + url.PathEscape(community.Name),
+		Self:        base + r.URL.Path,
+	}
+	for _, post := range posts {
+		feed.Items = append(feed.Items, postSyndicationItem(base, post))
+	}
+	s.writeSyndicationFeed(w, r, feed)
+}
+
+// /@{username}.rss, /@{username}.atom [GET]
+func (s *Server) serveUserSyndicationFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := core.GetUserByUsername(r.Context(), s.db, mux.Vars(r)["username"], nil)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if user.Banned {
+		s.writeError(w, r, httperr.NewForbidden("user_banned", "User is banned."))
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	set, err := core.GetUserFeed(r.Context(), s.db, nil, user.ID, query.Get("filter"), limit, nil)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	base, err := s.syndicationBaseURL()
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	feed := &syndicationFeed{
+		Title:       "@" + user.Username + " - " + s.config.SiteName,
+		Description: user.About.String,
+		Link:        base + "/@" + url.PathEscape(user.Username),
+		Self:        base + r.URL.Path,
+	}
+	for _, item := range set.Items {
+		switch v := item.Item.(type) {
+		case *core.Post:
+			if !v.Deleted {
+				feed.Items = append(feed.Items, postSyndicationItem(base, v))
+			}
+		case *core.Comment:
+			if !v.Deleted {
+				feed.Items = append(feed.Items, commentSyndicationItem(base, v))
+			}
+		}
+	}
+	s.writeSyndicationFeed(w, r, feed)
+}
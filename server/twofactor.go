@@ -0,0 +1,228 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/core/sitesettings"
+	"github.com/discuitnet/discuit/internal/httperr"
+	"github.com/discuitnet/discuit/internal/uid"
+)
+
+const (
+	// Session keys of a login that awaits a two-factor authentication code.
+	sessionKeyPending2FAUser = "2fa_uid"
+	sessionKeyPending2FAAt   = "2fa_at"
+
+	// pending2FALoginTTL is how long a user has to enter the two-factor
+	// authentication code after entering the password.
+	pending2FALoginTTL = 5 * time.Minute
+
+	// Session key of the user, and the time, that last passed the two-factor
+	// authentication policy check (of the form "userID:unixTime").
+	sessionKey2FAPolicyPassed = "2fa_policy_passed"
+
+	// twoFactorPolicyCacheTTL is how long a passed two-factor authentication
+	// policy check is remembered in the session.
+	twoFactorPolicyCacheTTL = 5 * time.Minute
+)
+
+var (
+	errTwoFactorRequired     = httperr.NewForbidden("2fa-required", "Enable two-factor authentication to perform this action.")
+	errTwoFactorLoginExpired = &httperr.Error{HTTPStatus: http.StatusUnauthorized, Code: "2fa-login-expired", Message: "Login expired. Please enter your password again."}
+)
+
+// setPending2FALogin records in the session of r that user has entered the
+// correct password, and that the login awaits a two-factor authentication code.
+func setPending2FALogin(w http.ResponseWriter, r *request, user uid.ID) error {
+	r.ses.Values[sessionKeyPending2FAUser] = user.String()
+	r.ses.Values[sessionKeyPending2FAAt] = strconv.FormatInt(time.Now().Unix(), 10)
+	return r.ses.Save(w, r.req)
+}
+
+// pending2FALogin returns the user whose login, in the session of r, awaits a
+// two-factor authentication code.
+func pending2FALogin(r *request) (uid.ID, error) {
+	userText, _ := r.ses.Values[sessionKeyPending2FAUser].(string)
+	atText, _ := r.ses.Values[sessionKeyPending2FAAt].(string)
+	at, err := strconv.ParseInt(atText, 10, 64)
+	if userText == "" || err != nil || time.Since(time.Unix(at, 0)) > pending2FALoginTTL {
+		return uid.ID{}, errTwoFactorLoginExpired
+	}
+	id, err := uid.FromString(userText)
+	if err != nil {
+		return uid.ID{}, errTwoFactorLoginExpired
+	}
+	return id, nil
+}
+
+func clearPending2FALogin(r *request) {
+	delete(r.ses.Values, sessionKeyPending2FAUser)
+	delete(r.ses.Values, sessionKeyPending2FAAt)
+}
+
+// checkTwoFactorPolicy returns errTwoFactorRequired if the route of r is an
+// admin or a moderator action and the logged in user, who is required to have
+// two-factor authentication enabled as per the site settings, does not.
+//
+// A passed check is remembered, for twoFactorPolicyCacheTTL, in the session of
+// r (if it's not the transient session of an API token request), so that the
+// user is not looked up on each request.
+func (s *Server) checkTwoFactorPolicy(w http.ResponseWriter, r *request) error {
+	if !r.loggedIn {
+		return nil
+	}
+	if scope, ok := apiTokenScope(r.req); !ok || (scope != core.APITokenScopeModerate && scope != core.APITokenScopeAdmin) {
+		return nil
+	}
+	settings, err := sitesettings.GetSiteSettings(r.ctx, s.db)
+	if err != nil {
+		return err
+	}
+	if !settings.Require2FAForAdmins && settings.Require2FAForModsMinMembers <= 0 {
+		return nil
+	}
+
+	cacheable := r.ses.Store() != nil
+	if cacheable && twoFactorPolicyPassed(r) {
+		return nil
+	}
+	user, err := core.GetUser(r.ctx, s.db, *r.viewer, nil)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		required, err := user.TwoFactorRequired(r.ctx, s.db, settings.Require2FAForAdmins, settings.Require2FAForModsMinMembers)
+		if err != nil {
+			return err
+		}
+		if required {
+			return errTwoFactorRequired
+		}
+	}
+	if cacheable {
+		r.ses.Values[sessionKey2FAPolicyPassed] = r.viewer.String() + ":" + strconv.FormatInt(time.Now().Unix(), 10)
+		return r.ses.Save(w, r.req)
+	}
+	return nil
+}
+
+// twoFactorPolicyPassed reports whether the logged in user passed the
+// two-factor authentication policy check in the last twoFactorPolicyCacheTTL.
+func twoFactorPolicyPassed(r *request) bool {
+	text, _ := r.ses.Values[sessionKey2FAPolicyPassed].(string)
+	user, atText, ok := strings.Cut(text, ":")
+	if !ok || user != r.viewer.String() {
+		return false
+	}
+	at, err := strconv.ParseInt(atText, 10, 64)
+	return err == nil && time.Since(time.Unix(at, 0)) < twoFactorPolicyCacheTTL
+}
+
+// /api/_two_factor [GET, POST]
+func (s *Server) handleTwoFactor(w *responseWriter, r *request) error {
+	if !r.loggedIn {
+		return errNotLoggedIn
+	}
+
+	user, err := core.GetUser(r.ctx, s.db, *r.viewer, r.viewer)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		settings, err := sitesettings.GetSiteSettings(r.ctx, s.db)
+		if err != nil {
+			return err
+		}
+		required, err := user.TwoFactorRequired(r.ctx, s.db, settings.Require2FAForAdmins, settings.Require2FAForModsMinMembers)
+		if err != nil {
+			return err
+		}
+		res := struct {
+			Enabled           bool `json:"enabled"`
+			Required          bool `json:"required"`
+			RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+		}{Enabled: user.TwoFactorEnabled, Required: required}
+		if user.TwoFactorEnabled {
+			if res.RecoveryCodesLeft, err = user.RecoveryCodesLeft(r.ctx, s.db); err != nil {
+				return err
+			}
+		}
+		return w.writeJSON(res)
+	}
+
+	if err := s.rateLimit(r, "two_factor_1_"+r.viewer.String(), time.Minute, 10); err != nil {
+		return err
+	}
+
+	values, err := r.unmarshalJSONBodyToStringsMap(true)
+	if err != nil {
+		return err
+	}
+
+	// All changes to an account's two-factor authentication require the
+	// password, so that a hijacked session cannot be used to lock the owner
+	// out of the account. Once enabled, they also require a code.
+	verifyPassword := func() error {
+		if _, err := core.MatchLoginCredentials(r.ctx, s.db, user.Username, values["password"]); err != nil {
+			if err == core.ErrWrongPassword {
+				return httperr.NewForbidden("wrong_password", "Wrong password.")
+			}
+			return err
+		}
+		return nil
+	}
+	verify := func() error {
+		if err := verifyPassword(); err != nil {
+			return err
+		}
+		return user.VerifyTwoFactorCode(r.ctx, s.db, values["code"])
+	}
+
+	switch r.urlQueryParamsValue("action") {
+	case "enroll":
+		if err := verifyPassword(); err != nil {
+			return err
+		}
+		enrollment, err := user.BeginTOTPEnrollment(r.ctx, s.db, s.config.SiteName)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(enrollment)
+	case "enable":
+		if err := verifyPassword(); err != nil {
+			return err
+		}
+		codes, err := user.EnableTOTP(r.ctx, s.db, values["code"])
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(map[string]any{"recoveryCodes": codes})
+	case "disable":
+		if err := verify(); err != nil {
+			return err
+		}
+		if err := user.DisableTOTP(r.ctx, s.db); err != nil {
+			return err
+		}
+		delete(r.ses.Values, sessionKey2FAPolicyPassed)
+		if err := r.ses.Save(w.w, r.req); err != nil {
+			return err
+		}
+		return w.writeJSON(user)
+	case "newRecoveryCodes":
+		if err := verify(); err != nil {
+			return err
+		}
+		codes, err := user.NewRecoveryCodes(r.ctx, s.db)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(map[string]any{"recoveryCodes": codes})
+	}
+	return httperr.NewBadRequest("invalid_action", "Unsupported action.")
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -240,13 +241,40 @@ func (s *Server) login(w *responseWriter, r *request) error {
 	if err := s.rateLimit(r, "login_1_"+ip, time.Second, 10); err != nil {
 		return err
 	}
-	if err := s.rateLimit(r, "login_2_"+ip+username, time.Hour, 20); err != nil {
-		return err
-	}
 
-	user, err := core.MatchLoginCredentials(r.ctx, s.db, username, password)
-	if err != nil {
-		return err
+	var user *core.User
+	if code, ok := values["code"]; ok && username == "" {
+		// The second step of a login with two-factor authentication.
+		id, err := pending2FALogin(r)
+		if err != nil {
+			return err
+		}
+		if err := s.rateLimit(r, "login_2fa_1_"+id.String(), time.Minute, 5); err != nil {
+			return err
+		}
+		if err := s.rateLimit(r, "login_2fa_2_"+id.String(), time.Hour, 20); err != nil {
+			return err
+		}
+		if user, err = core.GetUser(r.ctx, s.db, id, nil); err != nil {
+			return err
+		}
+		if err := user.VerifyTwoFactorCode(r.ctx, s.db, code); err != nil {
+			return err
+		}
+		clearPending2FALogin(r)
+	} else {
+		if err := s.rateLimit(r, "login_2_"+ip+username, time.Hour, 20); err != nil {
+			return err
+		}
+		if user, err = core.MatchLoginCredentials(r.ctx, s.db, username, password); err != nil {
+			return err
+		}
+		if user.TwoFactorEnabled {
+			if err := setPending2FALogin(w, r, user.ID); err != nil {
+				return err
+			}
+			return w.writeJSON(map[string]any{"twoFactorRequired": true})
+		}
 	}
 
 	if err = s.loginUser(user, r.ses, w, r.req); err != nil {
@@ -301,6 +329,12 @@ func (s *Server) signup(w *responseWriter, r *request) error {
 		return err
 	}
 
+	if user.Email.Valid && user.Email.String != "" && s.emailEnabled() {
+		if err := s.sendConfirmationEmail(r.ctx, user); err != nil {
+			log.Printf("Error sending confirmation email to new user (%s): %v\n", user.Username, err)
+		}
+	}
+
 	// Try logging in user.
 	s.loginUser(user, r.ses, w, r.req)
 
@@ -498,27 +532,52 @@ func (s *Server) updateUserSettings(w *responseWriter, r *request) error {
 	query := r.urlQueryParams()
 	switch query.Get("action") {
 	case "updateProfile":
+		previousEmail := user.Email
 		if err = r.unmarshalJSONBody(&user); err != nil {
 			return err
 		}
 
+		emailChanged := user.EmailPublic != nil && *user.EmailPublic != "" && *user.EmailPublic != previousEmail.String
+		if emailChanged {
+			if err := s.rateLimit(r, "confirm_email_1_"+r.viewer.String(), time.Hour, 5); err != nil {
+				return err
+			}
+		}
+
 		if err = user.Update(r.ctx, s.db); err != nil {
 			return err
 		}
+		if emailChanged && s.emailEnabled() {
+			if err := s.sendConfirmationEmail(r.ctx, user); err != nil {
+				return err
+			}
+		}
 	case "changePassword":
-		values, err := r.unmarshalJSONBodyToStringsMap(true)
-		if err != nil {
+		reqBody := struct {
+			Password       string `json:"password"`
+			NewPassword    string `json:"newPassword"`
+			RepeatPassword string `json:"repeatPassword"`
+
+			// If true, all other sessions of the user are logged out.
+			RevokeOtherSessions bool `json:"revokeOtherSessions"`
+		}{}
+		if err = r.unmarshalJSONBody(&reqBody); err != nil {
 			return err
 		}
-		password := values["password"]
-		newPassword := values["newPassword"]
-		repeatPassword := values["repeatPassword"]
+		password := strings.TrimSpace(reqBody.Password)
+		newPassword := strings.TrimSpace(reqBody.NewPassword)
+		repeatPassword := strings.TrimSpace(reqBody.RepeatPassword)
 		if newPassword != repeatPassword {
 			return httperr.NewBadRequest("password_not_match", "Passwords do not match.")
 		}
 		if err = user.ChangePassword(r.ctx, s.db, password, newPassword); err != nil {
 			return err
 		}
+		if reqBody.RevokeOtherSessions {
+			if err = s.revokeOtherSessions(r, user); err != nil {
+				return err
+			}
+		}
 	default:
 		return httperr.NewBadRequest("invalid_action", "Unsupported action.")
 	}
@@ -526,6 +585,131 @@ func (s *Server) updateUserSettings(w *responseWriter, r *request) error {
 	return w.writeJSON(user)
 }
 
+// /api/_confirm_email [POST]
+//
+// If the request body contains a token, the email address the token was sent
+// to is confirmed. Otherwise, a confirmation email is (re)sent to the logged
+// in user.
+func (s *Server) confirmEmail(w *responseWriter, r *request) error {
+	reqBody := struct {
+		Token string `json:"token"`
+	}{}
+	if err := r.unmarshalJSONBody(&reqBody); err != nil {
+		return err
+	}
+
+	if reqBody.Token == "" {
+		if !r.loggedIn {
+			return errNotLoggedIn
+		}
+		if err := s.rateLimit(r, "confirm_email_1_"+r.viewer.String(), time.Hour, 5); err != nil {
+			return err
+		}
+		user, err := core.GetUser(r.ctx, s.db, *r.viewer, r.viewer)
+		if err != nil {
+			return err
+		}
+		if err := s.sendConfirmationEmail(r.ctx, user); err != nil {
+			return err
+		}
+		w.writeString(`{"success": true}`)
+		return nil
+	}
+
+	if err := s.rateLimit(r, "confirm_email_2_"+httputil.GetIP(r.req), time.Minute, 10); err != nil {
+		return err
+	}
+	user, err := core.ConfirmEmail(r.ctx, s.db, reqBody.Token)
+	if err != nil {
+		return err
+	}
+	if r.loggedIn && *r.viewer == user.ID {
+		if user, err = core.GetUser(r.ctx, s.db, user.ID, r.viewer); err != nil {
+			return err
+		}
+		return w.writeJSON(user)
+	}
+	w.writeString(`{"success": true}`)
+	return nil
+}
+
+// /api/_forgot_password [POST]
+//
+// Sends a password reset link to all the accounts with the (confirmed) email
+// address in the request body. For privacy, the response is the same whether or
+// not such an account exists.
+func (s *Server) forgotPassword(w *responseWriter, r *request) error {
+	if r.loggedIn {
+		return httperr.NewBadRequest("already_logged_in", "You are already logged in")
+	}
+	if !s.emailEnabled() {
+		return errEmailDisabled
+	}
+
+	values, err := r.unmarshalJSONBodyToStringsMap(true)
+	if err != nil {
+		return err
+	}
+	email := values["email"]
+	if email == "" {
+		return httperr.NewBadRequest("no_email", "Email address cannot be empty.")
+	}
+
+	ip := httputil.GetIP(r.req)
+	if err := s.rateLimit(r, "forgot_pass_1_"+ip, time.Minute, 2); err != nil {
+		return err
+	}
+	if err := s.rateLimit(r, "forgot_pass_2_"+strings.ToLower(email), time.Hour, 3); err != nil {
+		return err
+	}
+
+	users, err := core.GetUsersByConfirmedEmail(r.ctx, s.db, email)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		// The response is the same whether or not there's an account with
+		// the email address, so errors are only logged.
+		if err := s.sendPasswordResetEmail(r.ctx, user); err != nil {
+			log.Printf("Error sending password reset email to user %v: %v\n", user.Username, err)
+		}
+	}
+
+	w.writeString(`{"success": true}`)
+	return nil
+}
+
+// /api/_reset_password [POST]
+func (s *Server) resetPassword(w *responseWriter, r *request) error {
+	values, err := r.unmarshalJSONBodyToStringsMap(true)
+	if err != nil {
+		return err
+	}
+	token := values["token"]
+	newPassword := values["newPassword"]
+	repeatPassword := values["repeatPassword"]
+	if newPassword != repeatPassword {
+		return httperr.NewBadRequest("password_not_match", "Passwords do not match.")
+	}
+
+	if err := s.rateLimit(r, "reset_pass_1_"+httputil.GetIP(r.req), time.Minute, 10); err != nil {
+		return err
+	}
+
+	user, err := core.ResetPassword(r.ctx, s.db, token, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// Whoever had access to the account before the reset should not anymore.
+	if err := s.LogoutAllSessionsOfUser(user); err != nil {
+		return err
+	}
+
+	w.writeString(`{"success": true}`)
+	return nil
+}
+
 // /api/users/{username}/pro_pic [POST, DELETE]
 func (s *Server) handleUserProPic(w *responseWriter, r *request) error {
 	if !r.loggedIn {
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/discuitnet/discuit/core"
+	"github.com/discuitnet/discuit/internal/httperr"
+)
+
+// getModdedCommunity returns the community in the URL. It returns an error if
+// the viewer is neither a mod of the community nor an admin.
+func (s *Server) getModdedCommunity(r *request) (*core.Community, error) {
+	if !r.loggedIn {
+		return nil, errNotLoggedIn
+	}
+
+	cid, err := strToID(r.muxVar("communityID"))
+	if err != nil {
+		return nil, err
+	}
+
+	comm, err := core.GetCommunityByID(r.ctx, s.db, cid, r.viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := userModOrAdmin(r.ctx, s.db, *r.viewer, comm); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errNotAdminNorMod
+	}
+	return comm, nil
+}
+
+// getCommunityWebhook returns the webhook in the URL.
+func (s *Server) getCommunityWebhook(r *request) (*core.Webhook, error) {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(r.muxVar("webhookID"))
+	if err != nil {
+		return nil, httperr.NewBadRequest("invalid_webhook_id", "Invalid webhook ID.")
+	}
+	return core.GetWebhook(r.ctx, s.db, comm.ID, id)
+}
+
+// /api/communities/{communityID}/webhooks [GET, POST]
+func (s *Server) handleCommunityWebhooks(w *responseWriter, r *request) error {
+	comm, err := s.getModdedCommunity(r)
+	if err != nil {
+		return err
+	}
+
+	if r.req.Method == "GET" {
+		webhooks, err := core.GetWebhooks(r.ctx, s.db, comm.ID)
+		if err != nil {
+			return err
+		}
+		return w.writeJSON(webhooks)
+	}
+
+	body := struct {
+		URL    string              `json:"url"`
+		Events []core.WebhookEvent `json:"events"`
+	}{}
+	if err := r.unmarshalJSONBody(&body); err != nil {
+		return err
+	}
+
+	webhook, err := comm.CreateWebhook(r.ctx, s.db, *r.viewer, body.URL, body.Events)
+	if err != nil {
+		return err
+	}
+
+	// The secret is returned only this once.
+	w.WriteHeader(http.StatusCreated)
+	return w.writeJSON(struct {
+		*core.Webhook
+		Secret string `json:"secret"`
+	}{webhook, webhook.Secret})
+}
+
+// /api/communities/{communityID}/webhooks/{webhookID} [DELETE]
+func (s *Server) deleteCommunityWebhook(w *responseWriter, r *request) error {
+	webhook, err := s.getCommunityWebhook(r)
+	if err != nil {
+		return err
+	}
+	if err := webhook.Delete(r.ctx, s.db); err != nil {
+		return err
+	}
+	return w.writeJSON(webhook)
+}
+
+// /api/communities/{communityID}/webhooks/{webhookID}/deliveries [GET]
+func (s *Server) getWebhookDeliveries(w *responseWriter, r *request) error {
+	webhook, err := s.getCommunityWebhook(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.urlQueryParams()
+	limit, err := getFeedLimit(query, s.config.PaginationLimit, s.config.PaginationLimitMax)
+	if err != nil {
+		return err
+	}
+	var next *int
+	if snext := query.Get("next"); snext != "" {
+		n, err := strconv.Atoi(snext)
+		if err != nil {
+			return httperr.NewBadRequest("invalid_cursor", "Invalid pagination cursor.")
+		}
+		next = &n
+	}
+
+	res := struct {
+		Deliveries []*core.WebhookDelivery `json:"deliveries"`
+		Next       *int                    `json:"next"`
+	}{}
+	if res.Deliveries, res.Next, err = webhook.GetDeliveries(r.ctx, s.db, limit, next); err != nil {
+		return err
+	}
+	return w.writeJSON(res)
+}
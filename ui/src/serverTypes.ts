@@ -21,7 +21,10 @@ export interface User {
   embedsOff: boolean;
   hideUserProfilePictures: boolean;
   requireAltText: boolean;
+  emailDigest: boolean;
+  twoFactorEnabled: boolean | null; // Null, unless the viewer is the user or an admin.
   bannedAt: string | null; // A datetime.
+  bannedUntil: string | null; // A datetime. If null, the ban (if any) is permanent.
   isBanned: boolean;
   notificationsNewCount: number;
   moddingList: Community[] | null;
@@ -70,6 +73,7 @@ export interface Community {
   proPic: Image | null;
   bannerImage: Image | null;
   postingRestricted: boolean;
+  postApproval: 'off' | 'new_users' | 'all';
   createdAt: string; // A datetime.
   isDefault?: boolean;
   userJoined: boolean | null;
@@ -94,9 +98,25 @@ export interface CommunityRule {
   createdA: string; // A datetime.
 }
 
+export interface PollOption {
+  id: number;
+  text: string;
+  noVotes: number | null; // Null if the results are hidden.
+}
+
+export interface Poll {
+  multipleChoice: boolean;
+  closesAt: string | null; // A datetime.
+  closed: boolean;
+  options: PollOption[];
+  resultsVisible: boolean;
+  noVoters: number | null;
+  viewerVotes: number[];
+}
+
 export interface Post {
   id: string;
-  type: 'text' | 'image' | 'link';
+  type: 'text' | 'image' | 'link' | 'poll';
   publicId: string;
   userId: string;
   username: string;
@@ -118,6 +138,10 @@ export interface Post {
     hostname: string;
     image?: Image;
   };
+  poll?: Poll;
+  flair: Flair | null;
+  crosspostOf: AbridgedPost | null; // The original post, if the post is a crosspost.
+  crossposts?: AbridgedPost[];
   locked: boolean;
   lockedBy: string | null;
   lockedByGroup?: UserGroup;
@@ -133,6 +157,7 @@ export interface Post {
   deletedAs?: UserGroup;
   deletedContent: boolean;
   deletedContentAs?: UserGroup;
+  pending: boolean; // Held for approval by the mods.
   noComments: number;
   comments?: Comment[] | null;
   commentsNext?: string | null;
@@ -146,6 +171,91 @@ export interface Post {
   author?: User;
 }
 
+export interface AbridgedPost {
+  id: string;
+  type: Post['type'];
+  publicId: string;
+  userId: string;
+  username: string;
+  userGhostId?: string;
+  communityId: string;
+  communityName: string;
+  title: string;
+  link?: Post['link'];
+  upvotes: number;
+  downvotes: number;
+  noComments: number;
+  createdAt: string; // A datetime.
+  deleted: boolean;
+}
+
+export interface ScheduledPost {
+  id: string;
+  userId: string;
+  communityId: string;
+  communityName: string;
+  userGroup: UserGroup;
+  type: 'text' | 'image' | 'link' | 'poll';
+  title: string;
+  body: string | null;
+  url: string | null;
+  images: { imageId: string; caption: string }[] | null;
+  poll: { options: string[]; multipleChoice: boolean; closesAt: string | null } | null;
+  pin: boolean;
+  publishAt: string; // A datetime.
+  publishedAt: string | null; // A datetime.
+  postId: string | null;
+  error: string | null;
+  createdAt: string; // A datetime.
+}
+
+export interface AutomodConfig {
+  communityId: string;
+  rules: string; // YAML or JSON.
+  updatedBy: string | null;
+  updatedAt: string | null; // A datetime.
+}
+
+export interface CustomFeed {
+  id: number;
+  userId: string;
+  username: string;
+  name: string;
+  description: string | null;
+  public: boolean;
+  numCommunities: number;
+  createdAt: string; // A datetime.
+  lastUpdatedAt: string; // A datetime.
+  communities?: Community[];
+}
+
+export interface Flair {
+  id: number;
+  communityId: string;
+  name: string;
+  color: string; // Of the form rgb(r,g,b).
+  modOnly: boolean; // If true, only mods can assign the flair.
+  zIndex: number;
+  createdBy: string;
+  createdAt: string; // A datetime.
+}
+
+export interface RecurringThread {
+  id: number;
+  communityId: string;
+  title: string; // May contain the {date} placeholder.
+  body: string | null;
+  frequency: 'daily' | 'weekly';
+  weekday: number; // 0 is Sunday.
+  hour: number; // In UTC.
+  minute: number;
+  nextRunAt: string; // A datetime.
+  lastPostId: string | null;
+  lastError: string | null;
+  createdBy: string;
+  createdAt: string; // A datetime.
+}
+
 export interface Comment {
   id: string;
   postId: string;
@@ -182,6 +292,7 @@ export interface Comment {
   lockedBy: string | null;
   lockedByGroup?: UserGroup;
   lockedAt: string | null;
+  pending: boolean; // Held for approval by the mods.
 }
 
 export type ListSort = 'addedDsc' | 'addedAsc' | 'createdDsc' | 'createdAsc';
@@ -218,7 +329,11 @@ export type NotificationType =
   | 'new_badge'
   | 'welcome'
   | 'announcement'
-  | 'denied_comm';
+  | 'denied_comm'
+  | 'report_resolved'
+  | 'banned'
+  | 'new_message'
+  | 'modmail';
 
 export interface Notification {
   id: number;
@@ -317,13 +432,15 @@ export interface NotificationView {
   updatedAt: string;
 }
 
-export type MuteType = 'user' | 'community';
+export type MuteType = 'user' | 'community' | 'keyword' | 'domain';
 
 export interface Mute {
   id: string;
   type: MuteType;
   mutedUserId?: string;
   mutedCommunityId?: string;
+  mutedKeyword?: string;
+  mutedDomain?: string;
   createdAt: string; // A datetime.
   mutedUser?: User;
   mutedCommunity?: Community;
@@ -332,6 +449,8 @@ export interface Mute {
 export interface Mutes {
   userMutes: Mute[] | null;
   communityMutes: Mute[] | null;
+  keywordMutes: Mute[] | null;
+  domainMutes: Mute[] | null;
 }
 
 export interface SiteSettings {
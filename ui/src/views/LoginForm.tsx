@@ -43,7 +43,16 @@ const LoginForm = ({ isModal = false }: { isModal?: boolean }) => {
         } else if (res.status === 403) {
           const json = await res.json();
           if (json.code === 'account_suspended') {
-            setLoginError(`@${username} is suspended.`);
+            const { reason, bannedUntil } = json.details || {};
+            let error = `@${username} is suspended`;
+            if (bannedUntil) {
+              error += ` until ${new Date(bannedUntil).toLocaleString()}`;
+            }
+            error += '.';
+            if (reason) {
+              error += ` Reason: ${reason}`;
+            }
+            setLoginError(error);
           } else {
             throw new APIError(res.status, json);
           }
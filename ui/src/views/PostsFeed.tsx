@@ -21,6 +21,7 @@ type SortOption = {
 
 const sortOptions: SortOption[] = [
   { text: 'Hot', id: 'hot' },
+  { text: 'Rising', id: 'rising' },
   { text: 'Activity', id: 'activity' },
   { text: 'New', id: 'latest' },
   { text: 'Top Day', id: 'day' },
@@ -28,6 +29,11 @@ const sortOptions: SortOption[] = [
   { text: 'Top Month', id: 'month' },
   { text: 'Top Year', id: 'year' },
   { text: 'Top All', id: 'all' },
+  { text: 'Controversial Day', id: 'controversial-day' },
+  { text: 'Controversial Week', id: 'controversial-week' },
+  { text: 'Controversial Month', id: 'controversial-month' },
+  { text: 'Controversial Year', id: 'controversial-year' },
+  { text: 'Controversial All', id: 'controversial-all' },
 ];
 const sortDefault = import.meta.env.VITE_DEFAULTFEEDSORT;
 const baseURL = '/api/posts';